@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/user/blocker/internal/ca"
+	"github.com/user/blocker/internal/config"
+)
+
+// caCmd creates the ca command and its subcommands
+func caCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ca",
+		Short: "Manage the local CA used to show the block page for HTTPS sites",
+		Long: `Blocked HTTPS sites are refused at the CONNECT request, which browsers show
+as a generic proxy error. With a local certificate authority the proxy can
+answer them with the block page instead, using a certificate it issues for
+the blocked host. Allowed HTTPS traffic is never intercepted.
+
+Create the CA with "ca init", trust the certificate from "ca export" in the
+system or browser certificate store, then set proxy.https_block_page in the
+config and restart.`,
+	}
+
+	var force bool
+	initCmd := &cobra.Command{
+		Use:   "init",
+		Short: "Generate the local CA",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			certPath, keyPath := caPaths()
+			err := ca.Init(certPath, keyPath, force)
+			if errors.Is(err, ca.ErrExists) {
+				return fmt.Errorf("CA already exists at %s, use --force to replace it", certPath)
+			}
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("CA certificate written to %s\n", certPath)
+			fmt.Println("Trust it in your system or browser certificate store, then set")
+			fmt.Println("proxy.https_block_page: true in the config and restart.")
+			return nil
+		},
+	}
+	initCmd.Flags().BoolVar(&force, "force", false, "replace an existing CA")
+	cmd.AddCommand(initCmd)
+
+	var output string
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Print the CA certificate for manual trust",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			certPath, _ := caPaths()
+			data, err := os.ReadFile(certPath)
+			if errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("no CA found, run \"ca init\" first")
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read CA certificate: %w", err)
+			}
+
+			if output == "" {
+				_, err = os.Stdout.Write(data)
+				return err
+			}
+			if err := os.WriteFile(output, data, 0644); err != nil {
+				return fmt.Errorf("failed to write certificate: %w", err)
+			}
+			fmt.Printf("CA certificate written to %s\n", output)
+			return nil
+		},
+	}
+	exportCmd.Flags().StringVarP(&output, "output", "o", "", "write the certificate to a file instead of stdout")
+	cmd.AddCommand(exportCmd)
+
+	return cmd
+}
+
+// caPaths returns the CA certificate and key paths next to the config file
+func caPaths() (certPath, keyPath string) {
+	if configPath == "" {
+		configPath = config.GetConfigPath()
+	}
+	return ca.CertPath(configPath), ca.KeyPath(configPath)
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/user/blocker/internal/blocker"
+	"github.com/user/blocker/internal/blocklist"
+	"github.com/user/blocker/internal/config"
+	"github.com/user/blocker/internal/quota"
+	"github.com/user/blocker/internal/state"
+)
+
+// resolveTimeout bounds host lookups when resolve_ips is enabled
+const resolveTimeout = 5 * time.Second
+
+// checkResult is the JSON output of the check command for one input
+type checkResult struct {
+	Input string `json:"input"`
+	Error string `json:"error,omitempty"` // Why the input could not be checked
+	*blocker.Explanation
+}
+
+// checkCmd creates the check command
+func checkCmd() *cobra.Command {
+	var (
+		file    string
+		method  string
+		jsonOut bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "check [host-or-url]",
+		Short: "Explain why a host or URL is blocked or allowed",
+		Long: `Run the current rules offline against a host or URL and show the verdict,
+every rule that matched and which one decided the outcome.
+
+A bare host ("reddit.com" or "reddit.com:8443") is checked like an HTTPS
+tunnel, which only carries the host and port. Use an http:// URL to include
+path rules.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if file == "" {
+				return cobra.ExactArgs(1)(cmd, args)
+			}
+			return cobra.NoArgs(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			inputs := args
+			if file != "" {
+				var err error
+				if inputs, err = readHosts(file); err != nil {
+					return err
+				}
+			}
+
+			b, err := loadBlocker()
+			if err != nil {
+				return err
+			}
+
+			// In batch mode, inputs that cannot be parsed are reported along
+			// with the others instead of ending the run
+			var results []checkResult
+			invalid := 0
+			for _, input := range inputs {
+				req, err := parseTarget(input, method)
+				if err != nil {
+					if file == "" {
+						return err
+					}
+					results = append(results, checkResult{Input: input, Error: err.Error()})
+					invalid++
+					continue
+				}
+				req.Addrs = resolveTarget(b, req.Host)
+				explanation := b.Explain(req)
+				results = append(results, checkResult{Input: input, Explanation: &explanation})
+			}
+
+			switch {
+			case jsonOut && file == "":
+				return printJSON(results[0])
+			case jsonOut:
+				if err := printJSON(results); err != nil {
+					return err
+				}
+			case file == "":
+				printExplanation(results[0])
+			default:
+				blocked := 0
+				for _, r := range results {
+					if r.Error != "" {
+						fmt.Printf("%-7s %s (%s)\n", "ERROR", r.Input, r.Error)
+						continue
+					}
+					if r.Decision.Blocked {
+						blocked++
+					}
+					fmt.Printf("%-7s %s %s\n", verdict(r.Decision), r.Input, describeDecision(r.Decision))
+				}
+				fmt.Printf("\n%d of %d blocked\n", blocked, len(results)-invalid)
+			}
+
+			if invalid > 0 {
+				// The results are printed already, so skip the usage text
+				cmd.SilenceUsage = true
+				return fmt.Errorf("%d of %d inputs could not be checked", invalid, len(results))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "", "check every host or URL in a file, one per line")
+	cmd.Flags().StringVarP(&method, "method", "X", http.MethodGet, "HTTP method for http:// URLs")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "print the result as JSON")
+
+	return cmd
+}
+
+// loadBlocker builds a blocker with the same rules the running service uses:
+// the config, snoozes and pauses, cached list subscriptions and quota usage
+func loadBlocker() (*blocker.Blocker, error) {
+	if configPath == "" {
+		configPath = config.GetConfigPath()
+	}
+
+	cfgManager = config.NewManager(configPath)
+	if err := cfgManager.Load(); err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	cfg := cfgManager.Get()
+
+	st, err := state.Load(state.Path(configPath))
+	if err != nil {
+		return nil, err
+	}
+
+	rs, err := buildRuleset(cfg, st, loadCachedLists(cfg))
+	if err != nil {
+		return nil, err
+	}
+
+	usage := quota.NewTracker(quota.Path(configPath))
+	if err := usage.Load(); err != nil {
+		return nil, err
+	}
+	usage.SetLimits(quotaLimits(cfg))
+
+	// The blocker logs rule set changes, which is noise here
+	log.SetOutput(io.Discard)
+
+	b := blocker.New()
+	b.SetUsageTracker(usage)
+	b.Apply(rs)
+	return b, nil
+}
+
+// loadCachedLists loads the cached copy of each enabled list subscription
+func loadCachedLists(cfg *config.Config) map[string]*blocklist.Result {
+	fetcher := blocklist.NewFetcher(blocklist.DefaultCacheDir())
+	lists := make(map[string]*blocklist.Result)
+	for _, l := range cfg.Lists {
+		if !l.Enabled {
+			continue
+		}
+		sub, err := l.Subscription()
+		if err != nil {
+			continue
+		}
+		if result, err := fetcher.Load(sub); err == nil {
+			lists[l.Name] = result
+		}
+	}
+	return lists
+}
+
+// parseTarget converts a host, host:port or URL into a request. Hosts and
+// https:// URLs are checked as CONNECT tunnels, http:// URLs with their path.
+func parseTarget(input, method string) (blocker.Request, error) {
+	input = strings.TrimSpace(input)
+	if !strings.Contains(input, "://") {
+		if !strings.Contains(input, "/") {
+			return blocker.Request{Host: input, Method: http.MethodConnect}, nil
+		}
+		input = "http://" + input
+	}
+
+	u, err := url.Parse(input)
+	if err != nil || u.Host == "" {
+		return blocker.Request{}, fmt.Errorf("invalid URL %q", input)
+	}
+
+	switch u.Scheme {
+	case "http":
+		return blocker.Request{Host: u.Host, Method: strings.ToUpper(method), Path: blocker.RequestPath(u)}, nil
+	case "https":
+		return blocker.Request{Host: u.Host, Method: http.MethodConnect}, nil
+	default:
+		return blocker.Request{}, fmt.Errorf("unsupported scheme %q in %q", u.Scheme, input)
+	}
+}
+
+// resolveTarget looks up a host when resolve_ips is enabled, like the proxy
+// does. A failed lookup leaves the host to be checked by name only.
+func resolveTarget(b *blocker.Blocker, hostport string) []netip.Addr {
+	if !b.ResolveIPs() {
+		return nil
+	}
+	host, _ := blocker.SplitHostPort(hostport)
+	if _, err := netip.ParseAddr(host); err == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to resolve %s: %v\n", host, err)
+		return nil
+	}
+	return addrs
+}
+
+// readHosts reads the non-empty, non-comment lines of a file
+func readHosts(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open hosts file: %w", err)
+	}
+	defer f.Close()
+
+	var hosts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hosts = append(hosts, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read hosts file: %w", err)
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no hosts in %s", path)
+	}
+	return hosts, nil
+}
+
+// printJSON prints v as indented JSON
+func printJSON(v interface{}) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printExplanation prints the verdict and every matching rule, marking the
+// one that decided the outcome with ">"
+func printExplanation(r checkResult) {
+	d := r.Decision
+	fmt.Printf("%s: %s %s\n", r.Input, verdict(d), describeDecision(d))
+
+	if len(r.Matches) == 0 {
+		fmt.Println("No rule matches")
+		return
+	}
+
+	fmt.Println("Matching rules:")
+	for _, m := range r.Matches {
+		marker := " "
+		if m.Won {
+			marker = ">"
+		}
+		fmt.Printf("  %s %-24s %s%s\n", marker, matchSource(m), m.Pattern, matchNote(m))
+	}
+}
+
+// verdict returns BLOCKED or ALLOWED
+func verdict(d blocker.Decision) string {
+	if d.Blocked {
+		return "BLOCKED"
+	}
+	return "ALLOWED"
+}
+
+// describeDecision explains the reason of a decision in a few words
+func describeDecision(d blocker.Decision) string {
+	switch d.Reason {
+	case "":
+		if d.Quota != "" {
+			return fmt.Sprintf("(quota %s has budget left)", d.Quota)
+		}
+		return "(no blocking rule matches)"
+	case blocker.ReasonIPLiteral:
+		return "(IP literal)"
+	case blocker.ReasonSnoozed, blocker.ReasonPaused:
+		return fmt.Sprintf("(%s until %s, matched: %s)", d.Reason, d.Until.Local().Format("15:04:05"), d.Pattern)
+	}
+
+	detail := fmt.Sprintf("%s: %s", d.Reason, d.Pattern)
+	switch {
+	case d.Group != "":
+		detail += ", group " + d.Group
+	case d.List != "":
+		detail += ", list " + d.List
+	}
+	if d.ResolvedIP != "" {
+		detail += ", resolved " + d.ResolvedIP
+	}
+	return "(" + detail + ")"
+}
+
+// matchSource describes where a matching rule comes from
+func matchSource(m blocker.Match) string {
+	switch {
+	case m.Group != "":
+		return "group " + m.Group
+	case m.List != "":
+		return m.Source + " (list " + m.List + ")"
+	default:
+		return m.Source
+	}
+}
+
+// matchNote describes why a matching rule did or did not take effect
+func matchNote(m blocker.Match) string {
+	switch {
+	case m.Source == blocker.ReasonQuota && m.Active:
+		return " (budget used up)"
+	case m.Source == blocker.ReasonQuota:
+		return " (budget left)"
+	case !m.Until.IsZero() && m.Active:
+		return " (until " + m.Until.Local().Format("15:04:05") + ")"
+	case !m.Until.IsZero():
+		return " (expired)"
+	case m.Source == blocker.ReasonGroup && !m.Active:
+		return " (outside schedule)"
+	default:
+		return ""
+	}
+}
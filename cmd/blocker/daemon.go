@@ -0,0 +1,480 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/user/blocker/internal/admin"
+	"github.com/user/blocker/internal/blocker"
+	"github.com/user/blocker/internal/blocklist"
+	"github.com/user/blocker/internal/config"
+	"github.com/user/blocker/internal/passphrase"
+	"github.com/user/blocker/internal/quota"
+	"github.com/user/blocker/internal/state"
+)
+
+// daemon applies configuration and runtime state to the blocker of the running proxy
+type daemon struct {
+	blocker   *blocker.Blocker
+	statePath string
+	usage     *quota.Tracker
+	fetcher   *blocklist.Fetcher
+	applied   *config.Config               // Config the current rules were built from
+	state     *state.State                 // State the current exemptions were built from
+	lists     map[string]*blocklist.Result // Latest copy of each subscribed list
+	refresh   chan struct{}                // Signals that list subscriptions changed
+	focusEnd  *time.Timer                  // Fires when the focus session ends
+	mu        sync.Mutex
+}
+
+// newDaemon creates a new daemon for the given blocker
+func newDaemon(b *blocker.Blocker, statePath string, usage *quota.Tracker, fetcher *blocklist.Fetcher) *daemon {
+	return &daemon{
+		blocker:   b,
+		statePath: statePath,
+		usage:     usage,
+		fetcher:   fetcher,
+		lists:     make(map[string]*blocklist.Result),
+		refresh:   make(chan struct{}, 1),
+	}
+}
+
+// reload re-reads the state and config files and applies them. approved
+// is set if the admin passphrase was verified, see reloadConfig.
+func (d *daemon) reload(approved bool) error {
+	if err := d.reloadState(); err != nil {
+		return err
+	}
+	return d.reloadConfig(approved)
+}
+
+// reloadConfig re-reads the config file and applies it to the blocker.
+// If the new config is invalid, the last good rule set stays active. While
+// a passphrase is set, changes that weaken blocking are ignored unless
+// approved is set because the passphrase was verified.
+func (d *daemon) reloadConfig(approved bool) error {
+	if err := cfgManager.Load(); err != nil {
+		return err
+	}
+
+	cfg := cfgManager.Get()
+	if approved {
+		d.approve(cfg)
+	} else {
+		cfg = d.guardPassphrase(cfg)
+	}
+	return d.apply(cfg, nil)
+}
+
+// start applies the config and state the service starts with. Config
+// changes that weaken blocking since the passphrase last approved a config
+// are ignored, so editing the file and restarting cannot get around it.
+func (d *daemon) start(cfg *config.Config, st *state.State) error {
+	return d.apply(d.guardPassphrase(cfg), st)
+}
+
+// guardPassphrase returns the approved config instead of cfg if a passphrase
+// is set and cfg weakens blocking, so hand edits cannot get around it. The
+// approved config is the applied one, or after a restart the copy saved when
+// the passphrase last approved a config.
+func (d *daemon) guardPassphrase(cfg *config.Config) *config.Config {
+	dir := filepath.Dir(d.statePath)
+	if !passphrase.IsSet(filepath.Join(dir, passphrase.FileName)) {
+		return cfg
+	}
+
+	d.mu.Lock()
+	baseline := d.applied
+	d.mu.Unlock()
+	if baseline == nil {
+		var err error
+		baseline, err = config.ReadFile(filepath.Join(dir, passphrase.ApprovedConfigFileName))
+		if err != nil || baseline.Validate() != nil {
+			// Nothing approved yet, e.g. after upgrading, so start from cfg
+			d.approve(cfg)
+			return cfg
+		}
+	}
+
+	if weaker := config.Weakens(baseline, cfg); len(weaker) > 0 {
+		log.Printf("[passphrase] Ignoring config changes made without the passphrase: %s", strings.Join(weaker, ", "))
+		return baseline
+	}
+	d.approve(cfg)
+	return cfg
+}
+
+// approve saves cfg as the approved config if a passphrase is set, so a
+// restarted service compares later edits with it
+func (d *daemon) approve(cfg *config.Config) {
+	dir := filepath.Dir(d.statePath)
+	if !passphrase.IsSet(filepath.Join(dir, passphrase.FileName)) {
+		return
+	}
+
+	if err := config.WriteFile(filepath.Join(dir, passphrase.ApprovedConfigFileName), cfg); err != nil {
+		log.Printf("[passphrase] Failed to save the approved config: %v", err)
+	}
+}
+
+// reloadState re-reads the state file and applies it to the blocker
+func (d *daemon) reloadState() error {
+	st, err := state.Load(d.statePath)
+	if err != nil {
+		return err
+	}
+
+	return d.apply(nil, st)
+}
+
+// apply builds a rule set from cfg and st, logs what changed and applies it.
+// A nil cfg or st keeps the currently applied one.
+func (d *daemon) apply(cfg *config.Config, st *state.State) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if cfg == nil {
+		cfg = d.applied
+	}
+	if st == nil {
+		st = d.state
+	}
+	if st == nil {
+		st = &state.State{}
+	}
+	cfg, st = d.enforceFocus(cfg, st)
+
+	if d.applied != nil {
+		changes := config.Changes(d.applied, cfg)
+		changes = append(changes, stateChanges(d.state, st)...)
+		if len(changes) == 0 {
+			return nil
+		}
+		for _, change := range changes {
+			log.Printf("[config] %s", change)
+		}
+	}
+
+	listsChanged := d.applied == nil || !reflect.DeepEqual(d.applied.Lists, cfg.Lists)
+	if err := d.rebuild(cfg, st); err != nil {
+		return err
+	}
+
+	if listsChanged {
+		select {
+		case d.refresh <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// rebuild applies the rule set built from cfg, st and the subscribed lists.
+// d.mu must be held.
+func (d *daemon) rebuild(cfg *config.Config, st *state.State) error {
+	rs, err := buildRuleset(cfg, st, d.lists)
+	if err != nil {
+		return err
+	}
+
+	d.usage.SetLimits(quotaLimits(cfg))
+	d.blocker.Apply(rs)
+	d.applied = cfg
+	d.state = st
+	return nil
+}
+
+// setList stores the latest copy of a subscribed list and re-applies the rules
+func (d *daemon) setList(name string, result *blocklist.Result) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.lists[name] = result
+	log.Printf("[lists] %s: %d entries", name, len(result.Block)+len(result.Allow))
+
+	if d.applied != nil {
+		if err := d.rebuild(d.applied, d.state); err != nil {
+			log.Printf("[lists] Failed to apply %s: %v", name, err)
+		}
+	}
+}
+
+// runLists keeps subscribed lists up to date until stop is closed
+func (d *daemon) runLists(stop <-chan struct{}) {
+	ticker := time.NewTicker(listCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		d.refreshLists()
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-d.refresh:
+		}
+	}
+}
+
+// refreshLists loads cached copies of lists not loaded yet and downloads
+// the lists that are due for a refresh
+func (d *daemon) refreshLists() {
+	d.mu.Lock()
+	cfg := d.applied
+	d.mu.Unlock()
+	if cfg == nil {
+		return
+	}
+
+	for _, l := range cfg.Lists {
+		if !l.Enabled {
+			continue
+		}
+
+		sub, err := l.Subscription()
+		if err != nil {
+			log.Printf("[lists] %s: %v", l.Name, err)
+			continue
+		}
+
+		d.mu.Lock()
+		loaded := d.lists[l.Name] != nil
+		d.mu.Unlock()
+
+		// Start from the cached copy so a slow download doesn't delay blocking
+		if !loaded {
+			if result, err := d.fetcher.Load(sub); err == nil {
+				d.setList(l.Name, result)
+			}
+		}
+
+		status, _ := blocklist.ReadStatus(d.fetcher.Dir(), l.Name)
+		if !status.Due(sub, time.Now()) {
+			continue
+		}
+
+		result, err := d.fetcher.Refresh(sub)
+		if err != nil {
+			log.Printf("[lists] %v", err)
+		}
+		if result != nil {
+			d.setList(l.Name, result)
+		}
+	}
+}
+
+// stateChanges describes the snoozes and pauses that differ between two states
+func stateChanges(old, new *state.State) []string {
+	if old == nil {
+		old = &state.State{}
+	}
+
+	var changes []string
+	oldFocus, newFocus := old.Focus != nil, new.Focus != nil
+	switch {
+	case newFocus && (!oldFocus || !old.Focus.Until.Equal(new.Focus.Until)):
+		changes = append(changes, fmt.Sprintf("focus session until %s", new.Focus.Until.Local().Format("15:04:05")))
+	case oldFocus && !newFocus:
+		changes = append(changes, "focus session ended")
+	}
+	if old.Profile != new.Profile {
+		if new.Profile == "" {
+			changes = append(changes, "profile cleared, using the base rules")
+		} else {
+			changes = append(changes, fmt.Sprintf("switched to profile %s", new.Profile))
+		}
+	}
+	if !old.PausedUntil.Equal(new.PausedUntil) {
+		if new.PausedUntil.IsZero() {
+			changes = append(changes, "pause ended")
+		} else {
+			changes = append(changes, fmt.Sprintf("blocking paused until %s", new.PausedUntil.Local().Format("15:04:05")))
+		}
+	}
+
+	oldSnoozes := make(map[string]time.Time, len(old.Snoozes))
+	for _, sn := range old.Snoozes {
+		oldSnoozes[sn.Pattern] = sn.Until
+	}
+	newSnoozes := make(map[string]bool, len(new.Snoozes))
+	for _, sn := range new.Snoozes {
+		newSnoozes[sn.Pattern] = true
+		if until, ok := oldSnoozes[sn.Pattern]; !ok || !until.Equal(sn.Until) {
+			changes = append(changes, fmt.Sprintf("snoozed %s until %s", sn.Pattern, sn.Until.Local().Format("15:04:05")))
+		}
+	}
+	for _, sn := range old.Snoozes {
+		if !newSnoozes[sn.Pattern] {
+			changes = append(changes, fmt.Sprintf("snooze of %s ended", sn.Pattern))
+		}
+	}
+
+	return changes
+}
+
+// buildRuleset builds the complete rule set from a config, the runtime
+// state and the latest copy of each subscribed list
+func buildRuleset(cfg *config.Config, st *state.State, lists map[string]*blocklist.Result) (blocker.Ruleset, error) {
+	rs, err := rulesetFromConfig(cfg)
+	if err != nil {
+		return rs, err
+	}
+
+	if profile := st.ActiveProfile(time.Now()); profile != "" {
+		blacklist, whitelist, err := cfg.ProfileRules(profile)
+		if err != nil {
+			// A removed profile must not keep the base rules from applying
+			log.Printf("[config] Ignoring active profile: %v", err)
+		}
+		rs.Blacklist = append(append([]string(nil), rs.Blacklist...), blacklist...)
+		rs.Whitelist = append(append([]string(nil), rs.Whitelist...), whitelist...)
+	}
+
+	for _, sn := range st.Snoozes {
+		rs.Exemptions = append(rs.Exemptions, blocker.Exemption{Pattern: sn.Pattern, Until: sn.Until})
+	}
+	rs.PausedUntil = st.PausedUntil
+
+	for _, l := range cfg.Lists {
+		if result := lists[l.Name]; l.Enabled && result != nil {
+			rs.Lists = append(rs.Lists, blocker.List{Name: l.Name, Block: result.Block, Allow: result.Allow})
+		}
+	}
+
+	return rs, nil
+}
+
+// rulesetFromConfig builds the blocker rule set from a config
+func rulesetFromConfig(cfg *config.Config) (blocker.Ruleset, error) {
+	rs := blocker.Ruleset{
+		Blacklist:  cfg.Blacklist,
+		Whitelist:  cfg.Whitelist,
+		LogBlocked: cfg.Logging.LogBlocked,
+		LogAllowed: cfg.Logging.LogAllowed,
+
+		BlockIPLiterals: cfg.BlockIPLiterals,
+		ResolveIPs:      cfg.ResolveIPs,
+	}
+
+	for _, q := range cfg.Quotas {
+		rs.Quotas = append(rs.Quotas, q.Pattern)
+	}
+
+	for _, p := range cfg.Profiles {
+		rs.ProfilePatterns = append(rs.ProfilePatterns, p.Blacklist...)
+	}
+
+	for _, g := range cfg.Groups {
+		sched, err := g.Schedule.Parse()
+		if err != nil {
+			return rs, fmt.Errorf("rule group %q: %w", g.Name, err)
+		}
+		rs.Groups = append(rs.Groups, blocker.Group{
+			Name:     g.Name,
+			Patterns: g.Patterns,
+			Schedule: sched,
+		})
+	}
+
+	return rs, nil
+}
+
+// quotaLimits returns the daily limits of the configured quotas, keyed by
+// the pattern reported in blocker decisions
+func quotaLimits(cfg *config.Config) map[string]quota.Limit {
+	limits := make(map[string]quota.Limit, len(cfg.Quotas))
+	for _, q := range cfg.Quotas {
+		pattern := blocker.CreateMatcher(q.Pattern).Pattern()
+		limits[pattern] = quota.Limit{Time: q.Time, Visits: q.Visits}
+	}
+	return limits
+}
+
+// connectDaemon returns a client for the admin API of the running daemon,
+// or nil if the admin API is disabled or the daemon is not reachable
+func connectDaemon(cfg *config.Config) *admin.Client {
+	if cfg == nil || !cfg.Admin.Enabled {
+		return nil
+	}
+
+	token, err := admin.LoadToken(admin.TokenPath(configPath))
+	if err != nil {
+		return nil
+	}
+
+	client := admin.NewClient(cfg.Admin.Port, token)
+	client.SetPassphrase(verifiedPassphrase)
+	if _, err := client.Status(); err != nil {
+		return nil
+	}
+	return client
+}
+
+// printGroups prints each rule group with its current state and next transition
+func printGroups(groups []config.RuleGroup, now time.Time) {
+	for _, g := range groups {
+		sched, err := g.Schedule.Parse()
+		if err != nil {
+			fmt.Printf("  %s (invalid schedule: %v)\n", g.Name, err)
+			continue
+		}
+
+		state := "inactive"
+		change := "starts"
+		if sched.Active(now) {
+			state = "active"
+			change = "ends"
+		}
+
+		if next := sched.NextTransition(now); next.IsZero() {
+			fmt.Printf("  %s (%s): %s\n", g.Name, state, strings.Join(g.Patterns, ", "))
+		} else {
+			fmt.Printf("  %s (%s, %s %s): %s\n", g.Name, state, change,
+				next.Local().Format("Mon 15:04"), strings.Join(g.Patterns, ", "))
+		}
+	}
+}
+
+// printQuotas prints the used and remaining budget of each quota
+func printQuotas(usage []quota.Usage) {
+	for _, u := range usage {
+		var parts []string
+		if u.Limit.Time > 0 {
+			parts = append(parts, fmt.Sprintf("%s of %s used, %s left",
+				u.Used.Truncate(time.Second), u.Limit.Time, u.Remaining().Truncate(time.Second)))
+		}
+		if u.Limit.Visits > 0 {
+			parts = append(parts, fmt.Sprintf("%d of %d visits", u.Visits, u.Limit.Visits))
+		}
+		fmt.Printf("  %s: %s\n", u.Pattern, strings.Join(parts, ", "))
+	}
+}
+
+// printLists prints each subscribed list with its entry count and last refresh
+func printLists(lists []config.ListConfig, cacheDir string) {
+	for _, l := range lists {
+		if !l.Enabled {
+			fmt.Printf("  %s (disabled)\n", l.Name)
+			continue
+		}
+
+		status, err := blocklist.ReadStatus(cacheDir, l.Name)
+		switch {
+		case err != nil:
+			fmt.Printf("  %s: %v\n", l.Name, err)
+		case status.LastRefresh.IsZero():
+			fmt.Printf("  %s: never refreshed\n", l.Name)
+		default:
+			fmt.Printf("  %s: %d entries, refreshed %s\n", l.Name, status.Entries,
+				status.LastRefresh.Local().Format("2006-01-02 15:04"))
+		}
+		if err == nil && status.LastError != "" {
+			fmt.Printf("    last refresh failed: %s\n", status.LastError)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/user/blocker/internal/blocker"
+	"github.com/user/blocker/internal/blocklist"
+	"github.com/user/blocker/internal/config"
+	"github.com/user/blocker/internal/passphrase"
+	"github.com/user/blocker/internal/quota"
+	"github.com/user/blocker/internal/state"
+)
+
+func TestDaemonStartKeepsApprovedConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+
+	// The passphrase approved blocking both sites, then the file was edited
+	approved := []byte("blacklist:\n  - facebook.com\n  - reddit.com\n")
+	if err := os.WriteFile(passphrase.ApprovedConfigPath(path), approved, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("blacklist:\n  - facebook.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := passphrase.Set(passphrase.Path(path), "open sesame"); err != nil {
+		t.Fatal(err)
+	}
+
+	cfgManager = config.NewManager(path)
+	if err := cfgManager.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	b := blocker.New()
+	d := newDaemon(b, state.Path(path), quota.NewTracker(quota.Path(path)), blocklist.NewFetcher(t.TempDir()))
+	if err := d.start(cfgManager.Get(), nil); err != nil {
+		t.Fatalf("start() error = %v", err)
+	}
+	if !b.IsBlocked("reddit.com") {
+		t.Error("reddit.com unblocked by an edit made without the passphrase")
+	}
+
+	// Stricter edits still apply and become the approved config
+	if err := os.WriteFile(path, []byte("blacklist:\n  - facebook.com\n  - reddit.com\n  - twitter.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.reloadConfig(false); err != nil {
+		t.Fatalf("reloadConfig() error = %v", err)
+	}
+	if !b.IsBlocked("twitter.com") {
+		t.Error("twitter.com not blocked after a stricter edit")
+	}
+	saved, err := config.ReadFile(passphrase.ApprovedConfigPath(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.Blacklist) != 3 {
+		t.Errorf("approved blacklist = %v, want 3 patterns", saved.Blacklist)
+	}
+
+	// An edit approved with the passphrase is applied
+	if err := os.WriteFile(path, []byte("blacklist:\n  - facebook.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.reloadConfig(true); err != nil {
+		t.Fatalf("reloadConfig(approved) error = %v", err)
+	}
+	if b.IsBlocked("reddit.com") {
+		t.Error("reddit.com still blocked after an approved edit")
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/user/blocker/internal/config"
+	"github.com/user/blocker/internal/state"
+)
+
+// focusCmd creates the focus command
+func focusCmd() *cobra.Command {
+	var (
+		duration time.Duration
+		profile  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "focus",
+		Short: "Lock the rules for a while, optionally with a stricter profile",
+		Long: `Start a focus session, e.g. 'blocker focus --for 90m --profile deep-work'.
+Until it ends, remove, uninstall, restart, pause, snooze, profile switches and
+config edits that weaken blocking are refused, and the running service ignores
+them.
+The session survives service restarts and cannot be ended early; running
+focus again can only extend it.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if duration <= 0 {
+				return fmt.Errorf("--for must be a positive duration, e.g. 90m")
+			}
+
+			if _, err := loadConfig(); err != nil {
+				return err
+			}
+			if profile != "" {
+				if _, _, err := cfgManager.Get().ProfileRules(profile); err != nil {
+					return err
+				}
+			}
+
+			now := time.Now()
+			until := now.Add(duration)
+
+			err := updateState(func(st *state.State) error {
+				if st.Locked(now) {
+					if profile == "" {
+						profile = st.Focus.Profile
+					}
+					if profile != st.Focus.Profile {
+						return fmt.Errorf("cannot change the profile of the focus session running until %s", st.Focus.Until.Local().Format("15:04"))
+					}
+					if until.Before(st.Focus.Until) {
+						return fmt.Errorf("a focus session is already running until %s and can only be extended", st.Focus.Until.Local().Format("15:04"))
+					}
+				} else {
+					if err := saveFocusConfig(); err != nil {
+						return err
+					}
+					// The session starts with nothing exempted
+					st.PausedUntil = time.Time{}
+					st.Snoozes = nil
+				}
+
+				st.Focus = &state.Focus{Until: until, Profile: profile}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			if profile != "" {
+				fmt.Printf("Focus session with profile '%s' until %s\n", profile, until.Format("15:04"))
+			} else {
+				fmt.Printf("Focus session until %s\n", until.Format("15:04"))
+			}
+			fmt.Println("Rules are locked: changes that weaken blocking are refused until then")
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&duration, "for", 0, "how long to lock the rules, e.g. 90m")
+	cmd.Flags().StringVarP(&profile, "profile", "p", "", "profile to enforce during the session")
+
+	return cmd
+}
+
+// saveFocusConfig copies the config file, so a restarted service can tell
+// which edits made during the focus session weaken blocking
+func saveFocusConfig() error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	return os.WriteFile(state.FocusConfigPath(configPath), data, 0644)
+}
+
+// checkUnlocked returns an error if a focus session is active, naming the refused action
+func checkUnlocked(action string) error {
+	if configPath == "" {
+		configPath = config.GetConfigPath()
+	}
+
+	st, err := state.Load(state.Path(configPath))
+	if err != nil {
+		return err
+	}
+	if st.Locked(time.Now()) {
+		return fmt.Errorf("cannot %s during a focus session (locked until %s)", action, st.Focus.Until.Local().Format("15:04"))
+	}
+	return nil
+}
+
+// printFocus prints the active focus session
+func printFocus(st *state.State, now time.Time) {
+	if !st.Locked(now) {
+		return
+	}
+
+	until := st.Focus.Until.Local().Format("15:04")
+	if st.Focus.Profile != "" {
+		fmt.Printf("Focus: locked until %s (profile %s)\n", until, st.Focus.Profile)
+	} else {
+		fmt.Printf("Focus: locked until %s\n", until)
+	}
+}
+
+// enforceFocus keeps an active focus session from being weakened. State
+// changes that end or shorten it, pause, snooze or switch profiles and config
+// changes that weaken blocking are ignored until it ends. d.mu must be held.
+func (d *daemon) enforceFocus(cfg *config.Config, st *state.State) (*config.Config, *state.State) {
+	now := time.Now()
+	if old := d.state; old != nil && old.Locked(now) {
+		st = lockState(old, st)
+	}
+	if !st.Locked(now) {
+		return cfg, st
+	}
+	d.scheduleFocusEnd(st.Focus.Until)
+
+	// After a restart, compare with the config the session started with
+	baseline := d.applied
+	if baseline == nil {
+		var err error
+		baseline, err = config.ReadFile(filepath.Join(filepath.Dir(d.statePath), state.FocusConfigFileName))
+		if err != nil || baseline.Validate() != nil {
+			return cfg, st
+		}
+	}
+
+	if weaker := config.Weakens(baseline, cfg); len(weaker) > 0 {
+		log.Printf("[focus] Ignoring config changes until %s: %s",
+			st.Focus.Until.Local().Format("15:04"), strings.Join(weaker, ", "))
+		return baseline, st
+	}
+	return cfg, st
+}
+
+// lockState returns new with the changes that weaken the focus session of
+// old undone: an ended or shortened session, a longer pause, new or longer
+// snoozes and profile switches
+func lockState(old, new *state.State) *state.State {
+	locked := *new
+
+	if new.Focus == nil || new.Focus.Until.Before(old.Focus.Until) || new.Focus.Profile != old.Focus.Profile {
+		locked.Focus = old.Focus
+	}
+	if new.PausedUntil.After(old.PausedUntil) {
+		locked.PausedUntil = old.PausedUntil
+	}
+	locked.Profile = old.Profile
+
+	oldSnoozes := make(map[string]time.Time, len(old.Snoozes))
+	for _, sn := range old.Snoozes {
+		oldSnoozes[sn.Pattern] = sn.Until
+	}
+	locked.Snoozes = nil
+	for _, sn := range new.Snoozes {
+		if until, ok := oldSnoozes[sn.Pattern]; ok {
+			if sn.Until.After(until) {
+				sn.Until = until
+			}
+			locked.Snoozes = append(locked.Snoozes, sn)
+		}
+	}
+
+	if !reflect.DeepEqual(&locked, new) {
+		log.Printf("[focus] Ignoring state changes until %s", locked.Focus.Until.Local().Format("15:04"))
+	}
+	return &locked
+}
+
+// scheduleFocusEnd re-applies the rules when the focus session ends.
+// d.mu must be held.
+func (d *daemon) scheduleFocusEnd(until time.Time) {
+	if d.focusEnd != nil {
+		d.focusEnd.Stop()
+	}
+	d.focusEnd = time.AfterFunc(time.Until(until), d.endFocus)
+}
+
+// endFocus drops the focus session's profile and applies the config and
+// state changes that were ignored during the session
+func (d *daemon) endFocus() {
+	log.Printf("[focus] Focus session ended")
+
+	d.mu.Lock()
+	if d.applied != nil {
+		if err := d.rebuild(d.applied, d.state); err != nil {
+			log.Printf("[focus] Failed to apply rules: %v", err)
+		}
+	}
+	d.mu.Unlock()
+
+	if err := d.reload(false); err != nil {
+		log.Printf("[focus] Reload failed: %v", err)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/user/blocker/internal/state"
+)
+
+func TestLockState(t *testing.T) {
+	now := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	focus := &state.Focus{Until: now.Add(time.Hour), Profile: "deep-work"}
+	old := &state.State{
+		Profile:     "work",
+		PausedUntil: now.Add(-time.Minute),
+		Focus:       focus,
+		Snoozes:     []state.Snooze{{Pattern: "docs.example.com", Until: now.Add(10 * time.Minute)}},
+	}
+
+	tests := []struct {
+		name string
+		new  state.State
+		want state.State
+	}{
+		{
+			name: "unchanged",
+			new:  *old,
+			want: *old,
+		},
+		{
+			name: "session ended",
+			new:  state.State{Profile: "work", PausedUntil: old.PausedUntil, Snoozes: old.Snoozes},
+			want: *old,
+		},
+		{
+			name: "session shortened",
+			new: state.State{Profile: "work", PausedUntil: old.PausedUntil, Snoozes: old.Snoozes,
+				Focus: &state.Focus{Until: now.Add(time.Minute), Profile: "deep-work"}},
+			want: *old,
+		},
+		{
+			name: "session extended",
+			new: state.State{Profile: "work", PausedUntil: old.PausedUntil, Snoozes: old.Snoozes,
+				Focus: &state.Focus{Until: now.Add(2 * time.Hour), Profile: "deep-work"}},
+			want: state.State{Profile: "work", PausedUntil: old.PausedUntil, Snoozes: old.Snoozes,
+				Focus: &state.Focus{Until: now.Add(2 * time.Hour), Profile: "deep-work"}},
+		},
+		{
+			name: "session profile switched",
+			new: state.State{Profile: "work", PausedUntil: old.PausedUntil, Snoozes: old.Snoozes,
+				Focus: &state.Focus{Until: now.Add(2 * time.Hour), Profile: "relaxed"}},
+			want: *old,
+		},
+		{
+			name: "profile switched",
+			new:  state.State{Profile: "relaxed", PausedUntil: old.PausedUntil, Snoozes: old.Snoozes, Focus: focus},
+			want: *old,
+		},
+		{
+			name: "longer pause",
+			new:  state.State{Profile: "work", PausedUntil: now.Add(30 * time.Minute), Snoozes: old.Snoozes, Focus: focus},
+			want: *old,
+		},
+		{
+			name: "pause cleared",
+			new:  state.State{Profile: "work", Snoozes: old.Snoozes, Focus: focus},
+			want: state.State{Profile: "work", Snoozes: old.Snoozes, Focus: focus},
+		},
+		{
+			name: "new snooze",
+			new: state.State{Profile: "work", PausedUntil: old.PausedUntil, Focus: focus, Snoozes: []state.Snooze{
+				{Pattern: "docs.example.com", Until: now.Add(10 * time.Minute)},
+				{Pattern: "reddit.com", Until: now.Add(10 * time.Minute)},
+			}},
+			want: *old,
+		},
+		{
+			name: "longer snooze",
+			new: state.State{Profile: "work", PausedUntil: old.PausedUntil, Focus: focus, Snoozes: []state.Snooze{
+				{Pattern: "docs.example.com", Until: now.Add(time.Hour)},
+			}},
+			want: *old,
+		},
+		{
+			name: "snooze ended",
+			new:  state.State{Profile: "work", PausedUntil: old.PausedUntil, Focus: focus},
+			want: state.State{Profile: "work", PausedUntil: old.PausedUntil, Focus: focus},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lockState(old, &tt.new)
+			if !reflect.DeepEqual(*got, tt.want) {
+				t.Errorf("lockState() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
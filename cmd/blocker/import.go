@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+	"github.com/user/blocker/internal/blocklist"
+	"github.com/user/blocker/internal/config"
+)
+
+// maxSkippedExamples is the number of skipped lines shown per reason
+const maxSkippedExamples = 3
+
+// importCmd creates the import command
+func importCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "import [file]",
+		Short: "Import a blocklist file into the blacklist",
+		Long: `Import a blocklist file into the blacklist. Supported formats:
+  hosts    Hosts files like StevenBlack's ("0.0.0.0 example.com")
+  adblock  Domain-only Adblock Plus rules ("||example.com^", "@@||allowed.com^")
+  plain    One pattern per line
+
+Adblock exception rules ("@@") are added to the whitelist. Unsupported
+lines are skipped and summarized.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := blocklist.ParseFormat(format)
+			if err != nil {
+				return err
+			}
+
+			file, err := os.Open(args[0])
+			if err != nil {
+				return fmt.Errorf("failed to open blocklist: %w", err)
+			}
+			defer file.Close()
+
+			result, err := blocklist.Parse(file, f)
+			if err != nil {
+				return err
+			}
+
+			if len(result.Allow) > 0 {
+				if err := checkUnlocked("import whitelist entries"); err != nil {
+					return err
+				}
+				if err := requirePassphrase("import whitelist entries"); err != nil {
+					return err
+				}
+			}
+
+			if configPath == "" {
+				configPath = config.GetConfigPath()
+			}
+
+			cfgManager = config.NewManager(configPath)
+			if err := cfgManager.Load(); err != nil {
+				return fmt.Errorf("failed to load config: %w", err)
+			}
+
+			addedBlack, addedWhite, err := cfgManager.AddPatterns(result.Block, result.Allow)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Added %d of %d patterns to blacklist\n", addedBlack, len(result.Block))
+			if len(result.Allow) > 0 {
+				fmt.Printf("Added %d of %d patterns to whitelist\n", addedWhite, len(result.Allow))
+			}
+			printSkipped(result.Skipped)
+
+			if client := connectDaemon(cfgManager.Get()); client != nil && client.Reload() == nil {
+				fmt.Println("Applied")
+				return nil
+			}
+			printApplyHint()
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "f", "plain", "blocklist format: hosts, adblock or plain")
+
+	return cmd
+}
+
+// printSkipped summarizes skipped lines grouped by reason
+func printSkipped(skipped []blocklist.Skipped) {
+	if len(skipped) == 0 {
+		return
+	}
+
+	byReason := make(map[string][]blocklist.Skipped)
+	for _, s := range skipped {
+		byReason[s.Reason] = append(byReason[s.Reason], s)
+	}
+
+	reasons := make([]string, 0, len(byReason))
+	for reason := range byReason {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	fmt.Printf("Skipped %d unsupported lines:\n", len(skipped))
+	for _, reason := range reasons {
+		lines := byReason[reason]
+		fmt.Printf("  %s (%d)\n", reason, len(lines))
+		for i, s := range lines {
+			if i == maxSkippedExamples {
+				fmt.Printf("    ...\n")
+				break
+			}
+			fmt.Printf("    line %d: %s\n", s.Line, s.Text)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/user/blocker/internal/config"
+)
+
+// lintCmd creates the lint command
+func lintCmd() *cobra.Command {
+	var jsonOut bool
+
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Find duplicate, shadowed, malformed and overly broad patterns",
+		Long: `Analyze the blacklist, whitelist and rule groups for problems:
+duplicate entries, patterns already covered by another one (like
+www.facebook.com under facebook.com), malformed patterns and patterns that
+match far more than one site (like *.com.*).`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if configPath == "" {
+				configPath = config.GetConfigPath()
+			}
+
+			// Read without validating, so invalid patterns are reported too
+			cfg, err := config.ReadFile(configPath)
+			if err != nil {
+				return err
+			}
+
+			issues := cfg.Lint()
+			if jsonOut {
+				if issues == nil {
+					issues = []config.LintIssue{}
+				}
+				return printJSON(issues)
+			}
+
+			if len(issues) == 0 {
+				fmt.Println("No issues found")
+				return nil
+			}
+
+			list := ""
+			for _, issue := range issues {
+				if issue.List != list {
+					if list != "" {
+						fmt.Println()
+					}
+					list = issue.List
+					fmt.Printf("%s:\n", list)
+				}
+				fmt.Printf("  %-10s %s\n", issue.Kind, issue.Issue)
+			}
+			fmt.Printf("\n%d issues found\n", len(issues))
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "print the issues as JSON")
+
+	return cmd
+}
@@ -3,17 +3,27 @@ package main
 import (
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"os/exec"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/user/blocker/internal/admin"
 	"github.com/user/blocker/internal/blocker"
+	"github.com/user/blocker/internal/blocklist"
+	"github.com/user/blocker/internal/ca"
 	"github.com/user/blocker/internal/config"
+	"github.com/user/blocker/internal/dns"
 	"github.com/user/blocker/internal/logger"
+	"github.com/user/blocker/internal/passphrase"
 	"github.com/user/blocker/internal/proxy"
+	"github.com/user/blocker/internal/quota"
 	"github.com/user/blocker/internal/service"
+	"github.com/user/blocker/internal/state"
 )
 
 var (
@@ -21,6 +31,17 @@ var (
 	cfgManager *config.Manager
 )
 
+const (
+	// reloadInterval is how often the running proxy checks the config file for changes
+	reloadInterval = 2 * time.Second
+
+	// usageSaveInterval is how often quota usage is written to disk
+	usageSaveInterval = time.Minute
+
+	// listCheckInterval is how often subscribed lists are checked for a due refresh
+	listCheckInterval = time.Minute
+)
+
 func main() {
 	rootCmd := &cobra.Command{
 		Use:   "blocker",
@@ -41,7 +62,17 @@ and blocks access to websites in your blacklist.`,
 	rootCmd.AddCommand(addCmd())
 	rootCmd.AddCommand(removeCmd())
 	rootCmd.AddCommand(listCmd())
+	rootCmd.AddCommand(importCmd())
+	rootCmd.AddCommand(snoozeCmd())
+	rootCmd.AddCommand(pauseCmd())
+	rootCmd.AddCommand(resumeCmd())
 	rootCmd.AddCommand(logsCmd())
+	rootCmd.AddCommand(checkCmd())
+	rootCmd.AddCommand(lintCmd())
+	rootCmd.AddCommand(profileCmd())
+	rootCmd.AddCommand(focusCmd())
+	rootCmd.AddCommand(passphraseCmd())
+	rootCmd.AddCommand(caCmd())
 
 	if err := rootCmd.Execute(); err != nil {
 		os.Exit(1)
@@ -87,13 +118,138 @@ func runProxy() error {
 		log.Printf("Logging to: %s", logger.GetLogPath())
 	}
 
-	// Create blocker
+	// Create blocker with persistent quota accounting
 	b := blocker.New()
-	b.SetLogging(cfg.Logging.LogBlocked, cfg.Logging.LogAllowed)
-	b.UpdateBlacklist(cfg.Blacklist)
+	usage := quota.NewTracker(quota.Path(configPath))
+	if err := usage.Load(); err != nil {
+		log.Printf("Warning: ignoring quota usage file: %v", err)
+	}
+	b.SetUsageTracker(usage)
+
+	d := newDaemon(b, state.Path(configPath), usage, blocklist.NewFetcher(blocklist.DefaultCacheDir()))
+	st, err := state.Load(state.Path(configPath))
+	if err != nil {
+		log.Printf("Warning: ignoring state file: %v", err)
+		st = nil
+	}
+	if err := d.start(cfg, st); err != nil {
+		return fmt.Errorf("failed to apply config: %w", err)
+	}
+	// A focus session or the passphrase may have kept an earlier config,
+	// including listeners disabled since
+	cfg = d.applied
 
 	// Create and start proxy server
 	srv := proxy.New(cfg.Proxy.Bind, cfg.Proxy.Port, b)
+	if cfg.Proxy.HTTPSBlockPage {
+		authority, err := ca.Load(ca.CertPath(configPath), ca.KeyPath(configPath))
+		if err != nil {
+			log.Printf("Warning: HTTPS block page disabled: %v", err)
+		} else {
+			srv.SetCA(authority)
+		}
+	}
+
+	// Watch the config and state files and apply changes without a restart
+	watcher := config.NewWatcher(configPath, reloadInterval, func() {
+		if err := d.reloadConfig(false); err != nil {
+			log.Printf("[config] Reload failed, keeping previous rules: %v", err)
+		}
+	})
+	watcher.Start()
+	defer watcher.Stop()
+
+	stateWatcher := config.NewWatcher(state.Path(configPath), reloadInterval, func() {
+		if err := d.reloadState(); err != nil {
+			log.Printf("[config] State reload failed, keeping previous state: %v", err)
+		}
+	})
+	stateWatcher.Start()
+	defer stateWatcher.Stop()
+
+	// Keep subscribed lists up to date
+	stopLists := make(chan struct{})
+	go d.runLists(stopLists)
+	defer close(stopLists)
+
+	// Persist quota usage periodically and on shutdown
+	stopUsage := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(usageSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopUsage:
+				return
+			case <-ticker.C:
+				if err := usage.Save(); err != nil {
+					log.Printf("[quota] %v", err)
+				}
+			}
+		}
+	}()
+	defer func() {
+		close(stopUsage)
+		if err := usage.Save(); err != nil {
+			log.Printf("[quota] %v", err)
+		}
+	}()
+
+	// Start the admin API if enabled
+	if cfg.Admin.Enabled {
+		token, err := admin.LoadOrCreateToken(admin.TokenPath(configPath))
+		if err != nil {
+			return fmt.Errorf("failed to set up admin API: %w", err)
+		}
+
+		adminSrv := admin.New(cfg.Admin.Port, token, b, cfgManager, d.reload)
+		adminSrv.SetUsageTracker(usage)
+		adminSrv.SetPassphrasePath(passphrase.Path(configPath))
+		adminSrv.SetStatePath(state.Path(configPath))
+		go func() {
+			if err := adminSrv.Start(); err != nil {
+				log.Printf("[admin] %v", err)
+			}
+		}()
+		defer adminSrv.Stop()
+	}
+
+	// Start the SOCKS5 listener if enabled
+	var socksSrv *proxy.SOCKSServer
+	if cfg.Proxy.SOCKS.Enabled {
+		socksSrv = proxy.NewSOCKSServer(cfg.Proxy.Bind, cfg.Proxy.SOCKS.Port, b,
+			cfg.Proxy.SOCKS.Username, cfg.Proxy.SOCKS.Password)
+		go func() {
+			if err := socksSrv.Start(); err != nil {
+				log.Printf("[socks] %v", err)
+			}
+		}()
+		defer socksSrv.Stop()
+	}
+
+	// Start the transparent listener if enabled
+	var transparentSrv *proxy.TransparentServer
+	if cfg.Proxy.Transparent.Enabled {
+		transparentSrv = proxy.NewTransparentServer(cfg.Proxy.Bind, cfg.Proxy.Transparent.Port, b)
+		go func() {
+			if err := transparentSrv.Start(); err != nil {
+				log.Printf("[transparent] %v", err)
+			}
+		}()
+		defer transparentSrv.Stop()
+	}
+
+	// Start the DNS sinkhole if enabled
+	var dnsSrv *dns.Server
+	if cfg.DNS.Enabled {
+		dnsSrv = dns.New(cfg.DNS.Bind, cfg.DNS.Port, cfg.DNS.UpstreamAddr(), cfg.DNS.Mode, b)
+		go func() {
+			if err := dnsSrv.Start(); err != nil {
+				log.Printf("[dns] %v", err)
+			}
+		}()
+		defer dnsSrv.Stop()
+	}
 
 	// Handle shutdown signals
 	sigChan := make(chan os.Signal, 1)
@@ -102,6 +258,17 @@ func runProxy() error {
 	go func() {
 		<-sigChan
 		log.Println("Shutting down...")
+		watcher.Stop()
+		stateWatcher.Stop()
+		if socksSrv != nil {
+			socksSrv.Stop()
+		}
+		if transparentSrv != nil {
+			transparentSrv.Stop()
+		}
+		if dnsSrv != nil {
+			dnsSrv.Stop()
+		}
 		srv.Stop()
 	}()
 
@@ -112,6 +279,21 @@ func runProxy() error {
 	return srv.Start()
 }
 
+// systemProxy returns the system proxy settings for a proxy address,
+// registering the PAC URL instead if the config asks for it
+func systemProxy(cfg *config.Config, bind string, port int) *service.ProxyConfig {
+	p := service.NewProxyConfig(bind, port)
+	if cfg != nil && cfg.Proxy.PAC {
+		// Wildcard addresses cannot be fetched from
+		host := bind
+		if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+			host = "127.0.0.1"
+		}
+		p.PACURL = "http://" + net.JoinHostPort(host, strconv.Itoa(port)) + proxy.PACPath
+	}
+	return p
+}
+
 // installCmd creates the install command
 func installCmd() *cobra.Command {
 	var enableProxy bool
@@ -159,7 +341,7 @@ func installCmd() *cobra.Command {
 			// Configure system proxy if requested
 			if enableProxy {
 				fmt.Println("Configuring system proxy...")
-				proxyConfig := service.NewProxyConfig(cfg.Proxy.Bind, cfg.Proxy.Port)
+				proxyConfig := systemProxy(cfg, cfg.Proxy.Bind, cfg.Proxy.Port)
 				if err := proxyConfig.Enable(); err != nil {
 					fmt.Printf("Warning: failed to configure system proxy: %v\n", err)
 					fmt.Println("You may need to configure your system proxy manually.")
@@ -167,7 +349,11 @@ func installCmd() *cobra.Command {
 					fmt.Println("System proxy configured!")
 				}
 			} else {
-				fmt.Printf("\nTo use the blocker, configure your system proxy to: %s:%d\n", cfg.Proxy.Bind, cfg.Proxy.Port)
+				if cfg.Proxy.PAC {
+					fmt.Printf("\nTo use the blocker, set your automatic proxy configuration URL to: %s\n", systemProxy(cfg, cfg.Proxy.Bind, cfg.Proxy.Port).PACURL)
+				} else {
+					fmt.Printf("\nTo use the blocker, configure your system proxy to: %s:%d\n", cfg.Proxy.Bind, cfg.Proxy.Port)
+				}
 				fmt.Println("Or run 'blocker install --proxy' to configure it automatically.")
 			}
 
@@ -186,6 +372,13 @@ func uninstallCmd() *cobra.Command {
 		Use:   "uninstall",
 		Short: "Uninstall blocker system service",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkUnlocked("uninstall"); err != nil {
+				return err
+			}
+			if err := requirePassphrase("uninstall"); err != nil {
+				return err
+			}
+
 			// Load config to get port
 			if configPath == "" {
 				configPath = config.GetConfigPath()
@@ -204,7 +397,7 @@ func uninstallCmd() *cobra.Command {
 
 			// Disable system proxy first
 			fmt.Println("Disabling system proxy...")
-			proxyConfig := service.NewProxyConfig(bind, port)
+			proxyConfig := systemProxy(cfg, bind, port)
 			if err := proxyConfig.Disable(); err != nil {
 				fmt.Printf("Warning: failed to disable system proxy: %v\n", err)
 			}
@@ -230,15 +423,32 @@ func uninstallCmd() *cobra.Command {
 func restartCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "restart",
-		Short: "Restart the blocker service to apply config changes",
-		Long: `Restart the blocker service to apply any configuration changes.
-Use this after modifying the blacklist or config file.`,
+		Short: "Restart the blocker service",
+		Long: `Restart the blocker service and re-apply the system proxy settings.
+Rule and logging changes are applied automatically by the running service;
+use this after changing the proxy address or updating the binary.
+
+If a passphrase is set, restarting asks for it and approves the config as it
+is, including edits that weaken blocking. It is refused during a focus
+session.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			// Load config to get port
 			if configPath == "" {
 				configPath = config.GetConfigPath()
 			}
 
+			if err := checkUnlocked("restart the service"); err != nil {
+				return err
+			}
+			if err := requirePassphrase("restart the service"); err != nil {
+				return err
+			}
+			if verifiedPassphrase != "" {
+				if err := saveApprovedConfig(); err != nil {
+					return err
+				}
+			}
+
 			cfgManager = config.NewManager(configPath)
 			cfgManager.Load()
 
@@ -278,13 +488,12 @@ Use this after modifying the blacklist or config file.`,
 			}
 
 			// Re-enable proxy
-			proxyConfig := service.NewProxyConfig(bind, port)
+			proxyConfig := systemProxy(cfg, bind, port)
 			if err := proxyConfig.Enable(); err != nil {
 				fmt.Printf("Warning: failed to configure system proxy: %v\n", err)
 			}
 
 			fmt.Println("Service restarted successfully!")
-			fmt.Println("Config changes are now active.")
 			return nil
 		},
 	}
@@ -292,7 +501,9 @@ Use this after modifying the blacklist or config file.`,
 
 // statusCmd creates the status command
 func statusCmd() *cobra.Command {
-	return &cobra.Command{
+	var recent int
+
+	cmd := &cobra.Command{
 		Use:   "status",
 		Short: "Show blocker service status",
 		RunE: func(cmd *cobra.Command, args []string) error {
@@ -326,9 +537,11 @@ func statusCmd() *cobra.Command {
 			fmt.Printf("Service Status: %s\n", status)
 
 			// Check proxy status
-			proxyConfig := service.NewProxyConfig(bind, port)
+			proxyConfig := systemProxy(cfg, bind, port)
 			proxyEnabled, _ := proxyConfig.IsEnabled()
-			if proxyEnabled {
+			if proxyEnabled && proxyConfig.PACURL != "" {
+				fmt.Printf("System Proxy: enabled (%s)\n", proxyConfig.PACURL)
+			} else if proxyEnabled {
 				fmt.Printf("System Proxy: enabled (%s:%d)\n", bind, port)
 			} else {
 				fmt.Println("System Proxy: disabled")
@@ -343,21 +556,123 @@ func statusCmd() *cobra.Command {
 			// Show blacklist count
 			if cfg != nil {
 				fmt.Printf("Blacklisted Domains: %d\n", len(cfg.Blacklist))
+				fmt.Printf("Whitelisted Domains: %d\n", len(cfg.Whitelist))
+				if len(cfg.Profiles) > 0 {
+					if active := activeProfile(); active != "" {
+						fmt.Printf("Active Profile: %s\n", active)
+					} else {
+						fmt.Println("Active Profile: none (base rules)")
+					}
+				}
+				if len(cfg.Groups) > 0 {
+					fmt.Printf("Rule Groups: %d\n", len(cfg.Groups))
+					printGroups(cfg.Groups, time.Now())
+				}
+			}
+
+			// Show subscribed lists
+			if cfg != nil && len(cfg.Lists) > 0 {
+				fmt.Printf("Subscribed Lists: %d\n", len(cfg.Lists))
+				printLists(cfg.Lists, blocklist.DefaultCacheDir())
+			}
+
+			// Show active snoozes and pauses
+			if st, err := state.Load(state.Path(configPath)); err == nil {
+				printFocus(st, time.Now())
+				printExemptions(st, time.Now())
+			}
+
+			// Show remaining quota budgets, live from the daemon if possible
+			client := connectDaemon(cfg)
+			if cfg != nil && len(cfg.Quotas) > 0 {
+				var usage []quota.Usage
+				if client != nil {
+					usage, err = client.Quotas()
+				} else {
+					usage, err = quota.LoadUsage(quota.Path(configPath), quotaLimits(cfg))
+				}
+				if err != nil {
+					fmt.Printf("Quotas: unavailable (%v)\n", err)
+				} else {
+					fmt.Println("Quotas (today):")
+					printQuotas(usage)
+				}
+			}
+
+			// Show live statistics from the running daemon
+			if client == nil {
+				if cfg != nil && cfg.Admin.Enabled {
+					fmt.Println("Admin API: not reachable")
+				}
+				return nil
+			}
+
+			stats, err := client.Status()
+			if err != nil {
+				return fmt.Errorf("failed to get daemon status: %w", err)
+			}
+			fmt.Printf("Admin API: 127.0.0.1:%d\n", cfg.Admin.Port)
+			fmt.Printf("Requests: %d blocked, %d allowed\n", stats.Blocked, stats.Allowed)
+			if cfg.DNS.Enabled {
+				fmt.Printf("DNS lookups: %d blocked, %d allowed\n", stats.LookupsBlocked, stats.LookupsAllowed)
+			}
+
+			if recent > 0 {
+				decisions, err := client.Decisions()
+				if err != nil {
+					return fmt.Errorf("failed to get recent decisions: %w", err)
+				}
+				if len(decisions) > recent {
+					decisions = decisions[:recent]
+				}
+
+				fmt.Printf("\nRecent decisions (%d):\n", len(decisions))
+				for _, d := range decisions {
+					verdict := "ALLOWED"
+					if d.Blocked {
+						verdict = "BLOCKED"
+					}
+					switch {
+					case d.ResolvedIP != "":
+						fmt.Printf("  %s [%s] %s (%s: %s, resolved: %s)\n", d.Time.Format("15:04:05"), verdict, d.Domain, d.Reason, d.Pattern, d.ResolvedIP)
+					case d.Pattern != "":
+						fmt.Printf("  %s [%s] %s (%s: %s)\n", d.Time.Format("15:04:05"), verdict, d.Domain, d.Reason, d.Pattern)
+					default:
+						fmt.Printf("  %s [%s] %s\n", d.Time.Format("15:04:05"), verdict, d.Domain)
+					}
+				}
 			}
 
 			return nil
 		},
 	}
+
+	cmd.Flags().IntVarP(&recent, "recent", "r", 0, "show the N most recent decisions of the running daemon")
+
+	return cmd
 }
 
 // addCmd creates the add command
 func addCmd() *cobra.Command {
-	return &cobra.Command{
+	var allow bool
+
+	cmd := &cobra.Command{
 		Use:   "add [domain]",
-		Short: "Add a domain to the blacklist",
+		Short: "Add a domain to the blacklist (or whitelist with --allow)",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			domain := args[0]
+			if err := blocker.ValidatePattern(domain); err != nil {
+				return err
+			}
+			if allow {
+				if err := checkUnlocked("whitelist patterns"); err != nil {
+					return err
+				}
+				if err := requirePassphrase("whitelist patterns"); err != nil {
+					return err
+				}
+			}
 
 			if configPath == "" {
 				configPath = config.GetConfigPath()
@@ -368,25 +683,59 @@ func addCmd() *cobra.Command {
 				return fmt.Errorf("failed to load config: %w", err)
 			}
 
-			if err := cfgManager.AddToBlacklist(domain); err != nil {
-				return err
+			listName := "blacklist"
+			if allow {
+				listName = "whitelist"
+			}
+
+			// Apply instantly through the running daemon if possible
+			if client := connectDaemon(cfgManager.Get()); client != nil {
+				if err := client.AddPattern(domain, allow); err != nil {
+					return err
+				}
+				fmt.Printf("Added '%s' to %s (applied)\n", domain, listName)
+				return nil
 			}
 
-			fmt.Printf("Added '%s' to blacklist\n", domain)
-			fmt.Println("Run 'blocker restart' to apply changes")
+			if allow {
+				if err := cfgManager.AddToWhitelist(domain); err != nil {
+					return err
+				}
+			} else {
+				if err := cfgManager.AddToBlacklist(domain); err != nil {
+					return err
+				}
+			}
+
+			fmt.Printf("Added '%s' to %s\n", domain, listName)
+			printApplyHint()
 			return nil
 		},
 	}
+
+	cmd.Flags().BoolVarP(&allow, "allow", "a", false, "add to the whitelist instead of the blacklist")
+
+	return cmd
 }
 
 // removeCmd creates the remove command
 func removeCmd() *cobra.Command {
-	return &cobra.Command{
+	var allow bool
+
+	cmd := &cobra.Command{
 		Use:   "remove [domain]",
-		Short: "Remove a domain from the blacklist",
+		Short: "Remove a domain from the blacklist (or whitelist with --allow)",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			domain := args[0]
+			if !allow {
+				if err := checkUnlocked("remove patterns"); err != nil {
+					return err
+				}
+				if err := requirePassphrase("remove patterns"); err != nil {
+					return err
+				}
+			}
 
 			if configPath == "" {
 				configPath = config.GetConfigPath()
@@ -397,22 +746,46 @@ func removeCmd() *cobra.Command {
 				return fmt.Errorf("failed to load config: %w", err)
 			}
 
-			if err := cfgManager.RemoveFromBlacklist(domain); err != nil {
-				return err
+			listName := "blacklist"
+			if allow {
+				listName = "whitelist"
+			}
+
+			// Apply instantly through the running daemon if possible
+			if client := connectDaemon(cfgManager.Get()); client != nil {
+				if err := client.RemovePattern(domain, allow); err != nil {
+					return err
+				}
+				fmt.Printf("Removed '%s' from %s (applied)\n", domain, listName)
+				return nil
+			}
+
+			if allow {
+				if err := cfgManager.RemoveFromWhitelist(domain); err != nil {
+					return err
+				}
+			} else {
+				if err := cfgManager.RemoveFromBlacklist(domain); err != nil {
+					return err
+				}
 			}
 
-			fmt.Printf("Removed '%s' from blacklist\n", domain)
-			fmt.Println("Run 'blocker restart' to apply changes")
+			fmt.Printf("Removed '%s' from %s\n", domain, listName)
+			printApplyHint()
 			return nil
 		},
 	}
+
+	cmd.Flags().BoolVarP(&allow, "allow", "a", false, "remove from the whitelist instead of the blacklist")
+
+	return cmd
 }
 
 // listCmd creates the list command
 func listCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "list",
-		Short: "List all blacklisted domains",
+		Short: "List all blacklisted and whitelisted domains",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			if configPath == "" {
 				configPath = config.GetConfigPath()
@@ -424,15 +797,53 @@ func listCmd() *cobra.Command {
 			}
 
 			blacklist := cfgManager.GetBlacklist()
+			whitelist := cfgManager.GetWhitelist()
+
+			// Prefer the rules of the running daemon
+			if client := connectDaemon(cfgManager.Get()); client != nil {
+				patterns, err := client.Patterns()
+				if err != nil {
+					return err
+				}
+				blacklist = patterns.Blacklist
+				whitelist = patterns.Whitelist
+			}
 
 			if len(blacklist) == 0 {
 				fmt.Println("Blacklist is empty")
-				return nil
+			} else {
+				fmt.Printf("Blacklisted domains (%d):\n", len(blacklist))
+				for i, domain := range blacklist {
+					fmt.Printf("  %d. %s\n", i+1, domain)
+				}
+			}
+
+			if len(whitelist) > 0 {
+				fmt.Printf("\nWhitelisted domains (%d, take precedence over blacklist):\n", len(whitelist))
+				for i, domain := range whitelist {
+					fmt.Printf("  %d. %s\n", i+1, domain)
+				}
 			}
 
-			fmt.Printf("Blacklisted domains (%d):\n", len(blacklist))
-			for i, domain := range blacklist {
-				fmt.Printf("  %d. %s\n", i+1, domain)
+			if groups := cfgManager.Get().Groups; len(groups) > 0 {
+				fmt.Printf("\nScheduled groups (%d):\n", len(groups))
+				printGroups(groups, time.Now())
+			}
+
+			if cfg := cfgManager.Get(); len(cfg.Profiles) > 0 {
+				active := activeProfile()
+				fmt.Printf("\nProfiles (%d):\n", len(cfg.Profiles))
+				printProfiles(cfg, active)
+
+				if blacklist, whitelist, err := cfg.ProfileRules(active); active != "" && err == nil {
+					fmt.Printf("\nActive profile '%s' adds:\n", active)
+					for _, domain := range blacklist {
+						fmt.Printf("  - %s (blocked)\n", domain)
+					}
+					for _, domain := range whitelist {
+						fmt.Printf("  - %s (allowed)\n", domain)
+					}
+				}
 			}
 
 			return nil
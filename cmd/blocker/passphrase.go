@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/user/blocker/internal/config"
+	"github.com/user/blocker/internal/passphrase"
+)
+
+// passphraseEnv supplies the admin passphrase without a prompt, e.g. in scripts
+const passphraseEnv = "BLOCKER_PASSPHRASE"
+
+// verifiedPassphrase is the passphrase requirePassphrase checked. It is sent
+// to the daemon, which only applies changes that weaken blocking with it.
+var verifiedPassphrase string
+
+// passphraseCmd creates the passphrase command and its subcommands
+func passphraseCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "passphrase",
+		Short: "Protect changes that weaken blocking with an admin passphrase",
+		Long: `Set an admin passphrase that must be entered for remove, uninstall,
+restart, pause, snooze, whitelisting and switching to a less strict profile. Changes that
+make blocking stricter, like add, stay unprotected.
+
+The passphrase is read from the terminal, or from the ` + passphraseEnv + `
+environment variable if it is set.`,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "set",
+		Short: "Set or change the admin passphrase",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := requirePassphrase("change the passphrase"); err != nil {
+				return err
+			}
+
+			first, err := readPassphrase("New passphrase: ")
+			if err != nil {
+				return err
+			}
+			if os.Getenv(passphraseEnv) == "" {
+				second, err := readPassphrase("Repeat passphrase: ")
+				if err != nil {
+					return err
+				}
+				if first != second {
+					return fmt.Errorf("passphrases do not match")
+				}
+			}
+
+			if err := passphrase.Set(passphrasePath(), first); err != nil {
+				return err
+			}
+			// Edits made from now on are compared with the current config
+			if err := saveApprovedConfig(); err != nil {
+				return err
+			}
+			fmt.Println("Passphrase set")
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "remove",
+		Short: "Remove the admin passphrase",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if !passphrase.IsSet(passphrasePath()) {
+				fmt.Println("No passphrase set")
+				return nil
+			}
+			if err := requirePassphrase("remove the passphrase"); err != nil {
+				return err
+			}
+
+			if err := passphrase.Remove(passphrasePath()); err != nil {
+				return err
+			}
+			if err := os.Remove(passphrase.ApprovedConfigPath(configPath)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove approved config: %w", err)
+			}
+			fmt.Println("Passphrase removed")
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+// passphrasePath returns the passphrase file path next to the config file
+func passphrasePath() string {
+	if configPath == "" {
+		configPath = config.GetConfigPath()
+	}
+	return passphrase.Path(configPath)
+}
+
+// requirePassphrase asks for the admin passphrase if one is set and returns
+// an error naming the action if it is wrong
+func requirePassphrase(action string) error {
+	path := passphrasePath()
+	if !passphrase.IsSet(path) {
+		return nil
+	}
+
+	input, err := readPassphrase(fmt.Sprintf("Passphrase to %s: ", action))
+	if err != nil {
+		return err
+	}
+
+	err = passphrase.Verify(path, input)
+	if errors.Is(err, passphrase.ErrIncorrect) {
+		return fmt.Errorf("cannot %s: %w", action, err)
+	}
+	if err != nil {
+		return err
+	}
+	verifiedPassphrase = input
+	return nil
+}
+
+// saveApprovedConfig copies the config file as approved with the
+// passphrase, so a restarted service applies it even if it weakens blocking
+func saveApprovedConfig() error {
+	cfg, err := config.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+	return config.WriteFile(passphrase.ApprovedConfigPath(configPath), cfg)
+}
+
+// printApplyHint tells how a config change the CLI wrote without reaching
+// the daemon's admin API gets applied
+func printApplyHint() {
+	if verifiedPassphrase != "" {
+		// The daemon ignores edits that weaken blocking while a passphrase is
+		// set, until it restarts with the approved copy
+		if err := saveApprovedConfig(); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		}
+		fmt.Println("Restart the service to apply the change")
+		return
+	}
+	fmt.Println("The running service will apply the change automatically")
+}
+
+// readPassphrase reads a passphrase from the environment or the terminal,
+// without echoing it
+func readPassphrase(prompt string) (string, error) {
+	if p := os.Getenv(passphraseEnv); p != "" {
+		return p, nil
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	if restore, err := disableEcho(int(os.Stdin.Fd())); err == nil {
+		defer func() {
+			restore()
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/user/blocker/internal/config"
+	"github.com/user/blocker/internal/state"
+)
+
+// profileCmd creates the profile command and its subcommands
+func profileCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "profile",
+		Short: "List and switch rule profiles",
+		Long: `Profiles are named rule sets like "focus" or "weekend" defined in the config.
+The active profile's patterns are added to the base blacklist and whitelist.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listProfiles()
+		},
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List profiles and show the active one",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listProfiles()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "use [name]",
+		Short: "Switch to a profile",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name := args[0]
+			if err := checkUnlocked("switch profiles"); err != nil {
+				return err
+			}
+
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if _, _, err := cfg.ProfileRules(name); err != nil {
+				return err
+			}
+			if len(cfg.ProfileSwitchWeakens(activeProfile(), name)) > 0 {
+				if err := requirePassphrase("switch to a less strict profile"); err != nil {
+					return err
+				}
+			}
+
+			err = updateState(func(st *state.State) error {
+				st.Profile = name
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Switched to profile '%s'\n", name)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "clear",
+		Short: "Deactivate the profile and use the base rules only",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := checkUnlocked("switch profiles"); err != nil {
+				return err
+			}
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if len(cfg.ProfileSwitchWeakens(activeProfile(), "")) > 0 {
+				if err := requirePassphrase("switch to a less strict profile"); err != nil {
+					return err
+				}
+			}
+
+			err = updateState(func(st *state.State) error {
+				st.Profile = ""
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("Profile cleared, using the base rules")
+			return nil
+		},
+	})
+
+	return cmd
+}
+
+// loadConfig loads the config file into cfgManager and returns it
+func loadConfig() (*config.Config, error) {
+	if configPath == "" {
+		configPath = config.GetConfigPath()
+	}
+
+	cfgManager = config.NewManager(configPath)
+	if err := cfgManager.Load(); err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return cfgManager.Get(), nil
+}
+
+// listProfiles prints the configured profiles, marking the active one
+func listProfiles() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	st, err := state.Load(state.Path(configPath))
+	if err != nil {
+		return err
+	}
+
+	if len(cfg.Profiles) == 0 {
+		fmt.Println("No profiles configured")
+		return nil
+	}
+
+	active := st.ActiveProfile(time.Now())
+	fmt.Printf("Profiles (%d):\n", len(cfg.Profiles))
+	printProfiles(cfg, active)
+	if active == "" {
+		fmt.Println("\nNo profile active, using the base rules")
+	}
+	return nil
+}
+
+// printProfiles prints each profile with its pattern counts, marking the active one
+func printProfiles(cfg *config.Config, active string) {
+	for _, p := range cfg.Profiles {
+		marker := " "
+		if p.Name == active {
+			marker = "*"
+		}
+
+		var details []string
+		blacklist, whitelist, _ := cfg.ProfileRules(p.Name)
+		details = append(details, fmt.Sprintf("+%d blocked", len(blacklist)))
+		if len(whitelist) > 0 {
+			details = append(details, fmt.Sprintf("+%d allowed", len(whitelist)))
+		}
+		if p.Inherits != "" {
+			details = append(details, "inherits "+p.Inherits)
+		}
+		fmt.Printf("  %s %s (%s)\n", marker, p.Name, strings.Join(details, ", "))
+	}
+}
+
+// activeProfile returns the active profile name from the state file, or ""
+func activeProfile() string {
+	st, err := state.Load(state.Path(configPath))
+	if err != nil {
+		return ""
+	}
+	return st.ActiveProfile(time.Now())
+}
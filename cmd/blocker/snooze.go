@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/user/blocker/internal/config"
+	"github.com/user/blocker/internal/state"
+)
+
+// snoozeCmd creates the snooze command
+func snoozeCmd() *cobra.Command {
+	var duration time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "snooze [pattern]",
+		Short: "Temporarily allow domains matching a pattern",
+		Long: `Temporarily allow domains matching a pattern, e.g. 'blocker snooze reddit.com --for 15m'.
+The snooze survives service restarts and expires on its own.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if duration <= 0 {
+				return fmt.Errorf("--for must be a positive duration, e.g. 15m")
+			}
+
+			if err := checkUnlocked("snooze"); err != nil {
+				return err
+			}
+			if err := requirePassphrase("snooze"); err != nil {
+				return err
+			}
+
+			pattern := args[0]
+			until := time.Now().Add(duration)
+
+			err := updateState(func(st *state.State) error {
+				st.Snooze(pattern, until)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Snoozed '%s' until %s\n", pattern, until.Format("15:04:05"))
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&duration, "for", 15*time.Minute, "how long to allow the pattern")
+
+	return cmd
+}
+
+// pauseCmd creates the pause command
+func pauseCmd() *cobra.Command {
+	var duration time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "pause",
+		Short: "Temporarily disable all blocking",
+		Long: `Temporarily disable all blocking, e.g. 'blocker pause --for 10m'.
+The pause survives service restarts and expires on its own.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if duration <= 0 {
+				return fmt.Errorf("--for must be a positive duration, e.g. 10m")
+			}
+			if err := checkUnlocked("pause blocking"); err != nil {
+				return err
+			}
+			if err := requirePassphrase("pause blocking"); err != nil {
+				return err
+			}
+
+			until := time.Now().Add(duration)
+
+			err := updateState(func(st *state.State) error {
+				st.PausedUntil = until
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Blocking paused until %s\n", until.Format("15:04:05"))
+			return nil
+		},
+	}
+
+	cmd.Flags().DurationVar(&duration, "for", 10*time.Minute, "how long to pause blocking")
+
+	return cmd
+}
+
+// resumeCmd creates the resume command
+func resumeCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "resume",
+		Short: "End an active pause and all snoozes",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := updateState(func(st *state.State) error {
+				st.Snoozes = nil
+				st.PausedUntil = time.Time{}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			fmt.Println("Blocking resumed")
+			return nil
+		},
+	}
+}
+
+// updateState loads the state file, applies fn, prunes expired entries and
+// saves it. The running daemon is asked to reload so the change applies instantly.
+func updateState(fn func(st *state.State) error) error {
+	if configPath == "" {
+		configPath = config.GetConfigPath()
+	}
+
+	statePath := state.Path(configPath)
+	st, err := state.Load(statePath)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(st); err != nil {
+		return err
+	}
+	st.Prune(time.Now())
+
+	if err := st.Save(statePath); err != nil {
+		return err
+	}
+
+	// The daemon also watches the state file, this just makes it instant
+	cfgManager = config.NewManager(configPath)
+	if err := cfgManager.Load(); err == nil {
+		if client := connectDaemon(cfgManager.Get()); client != nil {
+			client.Reload()
+		}
+	}
+
+	return nil
+}
+
+// printExemptions prints the active pause and snoozes
+func printExemptions(st *state.State, now time.Time) {
+	st.Prune(now)
+
+	if st.Paused(now) {
+		fmt.Printf("Blocking: paused until %s\n", st.PausedUntil.Local().Format("15:04:05"))
+	}
+	for _, sn := range st.Snoozes {
+		fmt.Printf("Snoozed: %s until %s\n", sn.Pattern, sn.Until.Local().Format("15:04:05"))
+	}
+}
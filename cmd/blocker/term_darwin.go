@@ -0,0 +1,23 @@
+//go:build darwin
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// disableEcho turns off terminal echo on fd and returns a function that restores it
+func disableEcho(fd int) (func(), error) {
+	termios, err := unix.IoctlGetTermios(fd, unix.TIOCGETA)
+	if err != nil {
+		return nil, err
+	}
+
+	old := *termios
+	termios.Lflag &^= unix.ECHO
+	if err := unix.IoctlSetTermios(fd, unix.TIOCSETA, termios); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		unix.IoctlSetTermios(fd, unix.TIOCSETA, &old)
+	}, nil
+}
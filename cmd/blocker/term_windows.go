@@ -0,0 +1,22 @@
+//go:build windows
+
+package main
+
+import "golang.org/x/sys/windows"
+
+// disableEcho turns off console echo on fd and returns a function that restores it
+func disableEcho(fd int) (func(), error) {
+	h := windows.Handle(fd)
+
+	var mode uint32
+	if err := windows.GetConsoleMode(h, &mode); err != nil {
+		return nil, err
+	}
+	if err := windows.SetConsoleMode(h, mode&^windows.ENABLE_ECHO_INPUT); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		windows.SetConsoleMode(h, mode)
+	}, nil
+}
@@ -0,0 +1,133 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/user/blocker/internal/blocker"
+	"github.com/user/blocker/internal/quota"
+)
+
+// Client talks to the admin API of a running blocker
+type Client struct {
+	baseURL    string
+	token      string
+	passphrase string
+	httpClient *http.Client
+}
+
+// NewClient creates a new admin API client
+func NewClient(port int, token string) *Client {
+	return &Client{
+		baseURL:    fmt.Sprintf("http://127.0.0.1:%d", port),
+		token:      token,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// SetPassphrase sets the admin passphrase sent with every request, needed
+// for changes that weaken blocking once a passphrase is set
+func (c *Client) SetPassphrase(p string) {
+	c.passphrase = p
+}
+
+// Status returns blocker statistics
+func (c *Client) Status() (*Status, error) {
+	var status Status
+	if err := c.do(http.MethodGet, "/api/status", nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Patterns returns the blacklist and whitelist
+func (c *Client) Patterns() (*Patterns, error) {
+	var patterns Patterns
+	if err := c.do(http.MethodGet, "/api/patterns", nil, &patterns); err != nil {
+		return nil, err
+	}
+	return &patterns, nil
+}
+
+// AddPattern adds a pattern to the blacklist (or whitelist if allow is set)
+func (c *Client) AddPattern(pattern string, allow bool) error {
+	return c.do(http.MethodPost, "/api/patterns", PatternRequest{Pattern: pattern, Allow: allow}, nil)
+}
+
+// RemovePattern removes a pattern from the blacklist (or whitelist if allow is set)
+func (c *Client) RemovePattern(pattern string, allow bool) error {
+	return c.do(http.MethodDelete, "/api/patterns", PatternRequest{Pattern: pattern, Allow: allow}, nil)
+}
+
+// Decisions returns recent blocking decisions, newest first
+func (c *Client) Decisions() ([]blocker.Decision, error) {
+	var decisions []blocker.Decision
+	if err := c.do(http.MethodGet, "/api/decisions", nil, &decisions); err != nil {
+		return nil, err
+	}
+	return decisions, nil
+}
+
+// Quotas returns today's usage of each quota
+func (c *Client) Quotas() ([]quota.Usage, error) {
+	var usage []quota.Usage
+	if err := c.do(http.MethodGet, "/api/quotas", nil, &usage); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// Reload asks the daemon to reload its config file
+func (c *Client) Reload() error {
+	return c.do(http.MethodPost, "/api/reload", nil, nil)
+}
+
+// do sends a request and decodes the JSON response into out
+func (c *Client) do(method, path string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if c.passphrase != "" {
+		req.Header.Set(PassphraseHeader, c.passphrase)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("admin API request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var errResp errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil || errResp.Error == "" {
+			return fmt.Errorf("admin API returned %s", resp.Status)
+		}
+		return fmt.Errorf("%s", errResp.Error)
+	}
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode admin API response: %w", err)
+	}
+	return nil
+}
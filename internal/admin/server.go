@@ -0,0 +1,342 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/user/blocker/internal/blocker"
+	"github.com/user/blocker/internal/config"
+	"github.com/user/blocker/internal/passphrase"
+	"github.com/user/blocker/internal/quota"
+	"github.com/user/blocker/internal/state"
+)
+
+// Status is returned by GET /api/status
+type Status struct {
+	Blocked   int64 `json:"blocked"`
+	Allowed   int64 `json:"allowed"`
+	Blacklist int   `json:"blacklist"`
+	Whitelist int   `json:"whitelist"`
+
+	// DNS lookups answered by the sinkhole, counted apart from requests
+	LookupsBlocked int64 `json:"lookups_blocked"`
+	LookupsAllowed int64 `json:"lookups_allowed"`
+}
+
+// Patterns is returned by GET /api/patterns
+type Patterns struct {
+	Blacklist []string `json:"blacklist"`
+	Whitelist []string `json:"whitelist"`
+}
+
+// PatternRequest is the body of POST and DELETE /api/patterns
+type PatternRequest struct {
+	Pattern string `json:"pattern"`
+	Allow   bool   `json:"allow"` // Whitelist instead of blacklist
+}
+
+// PassphraseHeader carries the admin passphrase on requests that weaken blocking
+const PassphraseHeader = "X-Blocker-Passphrase"
+
+// errorResponse is returned for failed requests
+type errorResponse struct {
+	Error       string     `json:"error"`
+	LockedUntil *time.Time `json:"locked_until,omitempty"` // End of the focus session refusing the request
+}
+
+// Server is a local HTTP API for controlling the running blocker
+type Server struct {
+	httpServer     *http.Server
+	blocker        *blocker.Blocker
+	manager        *config.Manager
+	reload         func(approved bool) error
+	usage          *quota.Tracker
+	passphrasePath string // Empty if changes are not protected
+	statePath      string // Empty if focus sessions are not enforced
+	token          string
+	addr           string
+}
+
+// New creates a new admin API server bound to localhost.
+// reload is called to apply config changes made through the API; approved
+// is set if the request carried the admin passphrase, so changes that weaken
+// blocking may be applied.
+func New(port int, token string, b *blocker.Blocker, m *config.Manager, reload func(approved bool) error) *Server {
+	addr := fmt.Sprintf("127.0.0.1:%d", port)
+
+	s := &Server{
+		blocker: b,
+		manager: m,
+		reload:  reload,
+		token:   token,
+		addr:    addr,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/status", s.handleStatus)
+	mux.HandleFunc("/api/patterns", s.handlePatterns)
+	mux.HandleFunc("/api/decisions", s.handleDecisions)
+	mux.HandleFunc("/api/quotas", s.handleQuotas)
+	mux.HandleFunc("/api/reload", s.handleReload)
+
+	s.httpServer = &http.Server{
+		Addr:         addr,
+		Handler:      s.authenticate(mux),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	return s
+}
+
+// SetUsageTracker sets the tracker reported by /api/quotas
+func (s *Server) SetUsageTracker(t *quota.Tracker) {
+	s.usage = t
+}
+
+// SetPassphrasePath makes requests that weaken blocking require the
+// passphrase stored at path, once one is set
+func (s *Server) SetPassphrasePath(path string) {
+	s.passphrasePath = path
+}
+
+// SetStatePath makes requests that weaken blocking fail while the state
+// file at path has an active focus session
+func (s *Server) SetStatePath(path string) {
+	s.statePath = path
+}
+
+// Start starts the admin API server
+func (s *Server) Start() error {
+	log.Printf("[admin] Starting admin API on %s", s.addr)
+
+	err := s.httpServer.ListenAndServe()
+	if err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("admin server error: %w", err)
+	}
+	return nil
+}
+
+// Stop gracefully stops the admin API server
+func (s *Server) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.httpServer.Shutdown(ctx)
+}
+
+// Addr returns the server address
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// authenticate rejects requests without a valid bearer token
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleStatus returns blocker statistics
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	blocked, allowed := s.blocker.Stats()
+	lookupsBlocked, lookupsAllowed := s.blocker.LookupStats()
+	writeJSON(w, http.StatusOK, Status{
+		Blocked:        blocked,
+		Allowed:        allowed,
+		Blacklist:      len(s.manager.GetBlacklist()),
+		Whitelist:      len(s.manager.GetWhitelist()),
+		LookupsBlocked: lookupsBlocked,
+		LookupsAllowed: lookupsAllowed,
+	})
+}
+
+// handlePatterns lists, adds and removes patterns
+func (s *Server) handlePatterns(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, Patterns{
+			Blacklist: s.manager.GetBlacklist(),
+			Whitelist: s.manager.GetWhitelist(),
+		})
+		return
+	case http.MethodPost, http.MethodDelete:
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req PatternRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	req.Pattern = strings.TrimSpace(req.Pattern)
+	if req.Pattern == "" {
+		writeError(w, http.StatusBadRequest, "pattern is required")
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if err := blocker.ValidatePattern(req.Pattern); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	// Whitelisting and removing from the blacklist weaken blocking
+	approved := false
+	if (r.Method == http.MethodPost) == req.Allow {
+		until, err := s.lockedUntil()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !until.IsZero() {
+			writeJSON(w, http.StatusConflict, errorResponse{
+				Error:       fmt.Sprintf("cannot weaken blocking during a focus session (locked until %s)", until.Local().Format("15:04")),
+				LockedUntil: &until,
+			})
+			return
+		}
+
+		if approved, err = s.checkPassphrase(r); err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+	}
+
+	var err error
+	switch {
+	case r.Method == http.MethodPost && req.Allow:
+		err = s.manager.AddToWhitelist(req.Pattern)
+	case r.Method == http.MethodPost:
+		err = s.manager.AddToBlacklist(req.Pattern)
+	case req.Allow:
+		err = s.manager.RemoveFromWhitelist(req.Pattern)
+	default:
+		err = s.manager.RemoveFromBlacklist(req.Pattern)
+	}
+	if err != nil {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	if err := s.reload(approved); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("failed to apply change: %v", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleDecisions returns recent blocking decisions
+func (s *Server) handleDecisions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, s.blocker.RecentDecisions())
+}
+
+// handleQuotas returns today's usage of each quota
+func (s *Server) handleQuotas(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	usage := []quota.Usage{}
+	if s.usage != nil {
+		usage = s.usage.Usage()
+	}
+	writeJSON(w, http.StatusOK, usage)
+}
+
+// handleReload reloads the config file
+func (s *Server) handleReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	// Without the passphrase, changes that weaken blocking are not applied
+	approved := false
+	if r.Header.Get(PassphraseHeader) != "" {
+		var err error
+		if approved, err = s.checkPassphrase(r); err != nil {
+			writeError(w, http.StatusForbidden, err.Error())
+			return
+		}
+	}
+
+	if err := s.reload(approved); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// checkPassphrase verifies the passphrase a request carries. It returns an
+// error if a passphrase is set and the request lacks it or has a wrong one.
+func (s *Server) checkPassphrase(r *http.Request) (approved bool, err error) {
+	if s.passphrasePath == "" || !passphrase.IsSet(s.passphrasePath) {
+		return true, nil
+	}
+
+	given := r.Header.Get(PassphraseHeader)
+	if given == "" {
+		return false, fmt.Errorf("passphrase required")
+	}
+	if err := passphrase.Verify(s.passphrasePath, given); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// lockedUntil returns the end of the active focus session, or the zero time
+// if there is none
+func (s *Server) lockedUntil() (time.Time, error) {
+	if s.statePath == "" {
+		return time.Time{}, nil
+	}
+
+	st, err := state.Load(s.statePath)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if !st.Locked(time.Now()) {
+		return time.Time{}, nil
+	}
+	return st.Focus.Until, nil
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes a JSON error response
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, errorResponse{Error: msg})
+}
@@ -0,0 +1,238 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/blocker/internal/blocker"
+	"github.com/user/blocker/internal/config"
+	"github.com/user/blocker/internal/passphrase"
+	"github.com/user/blocker/internal/state"
+)
+
+func newTestServer(t *testing.T) (*httptest.Server, *blocker.Blocker) {
+	t.Helper()
+	ts, b, _ := newProtectedServer(t, "")
+	return ts, b
+}
+
+// newProtectedServer starts a server that requires pass for changes that
+// weaken blocking, unless it is empty. approved reports the last reload.
+func newProtectedServer(t *testing.T, pass string) (ts *httptest.Server, b *blocker.Blocker, approved *bool) {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("blacklist:\n  - facebook.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := config.NewManager(path)
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	b = blocker.New()
+	b.SetLogging(false, false)
+	approved = new(bool)
+	reload := func(ok bool) error {
+		*approved = ok
+		if err := m.Load(); err != nil {
+			return err
+		}
+		b.UpdateBlacklist(m.GetBlacklist())
+		b.UpdateWhitelist(m.GetWhitelist())
+		return nil
+	}
+	reload(true)
+
+	s := New(0, "secret", b, m, reload)
+	if pass != "" {
+		passPath := passphrase.Path(path)
+		if err := passphrase.Set(passPath, pass); err != nil {
+			t.Fatal(err)
+		}
+		s.SetPassphrasePath(passPath)
+	}
+	ts = httptest.NewServer(s.httpServer.Handler)
+	t.Cleanup(ts.Close)
+	return ts, b, approved
+}
+
+func TestServerRequiresToken(t *testing.T) {
+	ts, _ := newTestServer(t)
+
+	resp, err := http.Get(ts.URL + "/api/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestClientAddAndRemovePattern(t *testing.T) {
+	ts, b := newTestServer(t)
+
+	client := NewClient(0, "secret")
+	client.baseURL = ts.URL
+
+	if err := client.AddPattern("reddit.com", false); err != nil {
+		t.Fatalf("AddPattern() error = %v", err)
+	}
+	if !b.IsBlocked("www.reddit.com") {
+		t.Error("www.reddit.com not blocked after AddPattern")
+	}
+
+	if err := client.AddPattern("reddit.com", false); err == nil || !strings.Contains(err.Error(), "already") {
+		t.Errorf("duplicate AddPattern() error = %v, want already in blacklist", err)
+	}
+
+	if err := client.AddPattern("m.facebook.com", true); err != nil {
+		t.Fatalf("AddPattern(allow) error = %v", err)
+	}
+	if b.IsBlocked("m.facebook.com") {
+		t.Error("m.facebook.com blocked after whitelisting")
+	}
+
+	if err := client.RemovePattern("facebook.com", false); err != nil {
+		t.Fatalf("RemovePattern() error = %v", err)
+	}
+	if b.IsBlocked("facebook.com") {
+		t.Error("facebook.com still blocked after RemovePattern")
+	}
+
+	patterns, err := client.Patterns()
+	if err != nil {
+		t.Fatalf("Patterns() error = %v", err)
+	}
+	if len(patterns.Blacklist) != 1 || patterns.Blacklist[0] != "reddit.com" {
+		t.Errorf("Blacklist = %v, want [reddit.com]", patterns.Blacklist)
+	}
+
+	decisions, err := client.Decisions()
+	if err != nil {
+		t.Fatalf("Decisions() error = %v", err)
+	}
+	if len(decisions) != 3 || decisions[0].Domain != "facebook.com" {
+		t.Errorf("Decisions() = %+v, want 3 entries starting with facebook.com", decisions)
+	}
+}
+
+func TestServerRequiresPassphrase(t *testing.T) {
+	ts, b, approved := newProtectedServer(t, "open sesame")
+
+	client := NewClient(0, "secret")
+	client.baseURL = ts.URL
+
+	// Changes that make blocking stricter need no passphrase
+	if err := client.AddPattern("reddit.com", false); err != nil {
+		t.Fatalf("AddPattern() error = %v", err)
+	}
+	if *approved {
+		t.Error("reload approved without a passphrase")
+	}
+
+	// The token alone cannot loosen the rules
+	for _, pass := range []string{"", "wrong"} {
+		client.SetPassphrase(pass)
+		if err := client.RemovePattern("facebook.com", false); err == nil {
+			t.Errorf("RemovePattern() with passphrase %q succeeded", pass)
+		}
+		if err := client.AddPattern("m.facebook.com", true); err == nil {
+			t.Errorf("AddPattern(allow) with passphrase %q succeeded", pass)
+		}
+		if !b.IsBlocked("m.facebook.com") {
+			t.Fatalf("m.facebook.com unblocked with passphrase %q", pass)
+		}
+	}
+	if err := client.Reload(); err == nil {
+		t.Error("Reload() with a wrong passphrase succeeded")
+	}
+
+	client.SetPassphrase("open sesame")
+	if err := client.RemovePattern("facebook.com", false); err != nil {
+		t.Fatalf("RemovePattern() error = %v", err)
+	}
+	if b.IsBlocked("facebook.com") || !*approved {
+		t.Errorf("facebook.com blocked = %v, reload approved = %v after RemovePattern with the passphrase; want false, true",
+			b.IsBlocked("facebook.com"), *approved)
+	}
+}
+
+func TestServerRefusesDuringFocus(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("blacklist:\n  - facebook.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := config.NewManager(path)
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	st := &state.State{Focus: &state.Focus{Until: until}}
+	if err := st.Save(state.Path(path)); err != nil {
+		t.Fatal(err)
+	}
+
+	reloads := 0
+	s := New(0, "secret", blocker.New(), m, func(bool) error {
+		reloads++
+		return nil
+	})
+	s.SetStatePath(state.Path(path))
+	ts := httptest.NewServer(s.httpServer.Handler)
+	defer ts.Close()
+
+	for _, tt := range []struct {
+		method string
+		body   string
+	}{
+		{http.MethodDelete, `{"pattern": "facebook.com"}`},
+		{http.MethodPost, `{"pattern": "m.facebook.com", "allow": true}`},
+	} {
+		req, _ := http.NewRequest(tt.method, ts.URL+"/api/patterns", strings.NewReader(tt.body))
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var errResp errorResponse
+		json.NewDecoder(resp.Body).Decode(&errResp)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusConflict {
+			t.Errorf("%s %s: status = %d, want %d", tt.method, tt.body, resp.StatusCode, http.StatusConflict)
+		}
+		if errResp.LockedUntil == nil || !errResp.LockedUntil.Equal(until) {
+			t.Errorf("%s %s: locked_until = %v, want %v", tt.method, tt.body, errResp.LockedUntil, until)
+		}
+	}
+
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.GetBlacklist(); len(got) != 1 || got[0] != "facebook.com" {
+		t.Errorf("Blacklist = %v, want [facebook.com]", got)
+	}
+	if got := m.GetWhitelist(); len(got) != 0 || reloads != 0 {
+		t.Errorf("Whitelist = %v, reloads = %d, want none", got, reloads)
+	}
+
+	// Stricter changes are still allowed
+	client := NewClient(0, "secret")
+	client.baseURL = ts.URL
+	if err := client.AddPattern("reddit.com", false); err != nil {
+		t.Errorf("AddPattern() error = %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package admin
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// TokenFile is the name of the file holding the admin API token
+const TokenFile = "admin.token"
+
+// TokenPath returns the token file path for a config file; the token is
+// stored next to the config
+func TokenPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), TokenFile)
+}
+
+// LoadToken reads the admin token from disk
+func LoadToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read admin token: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("admin token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// LoadOrCreateToken reads the admin token, generating a new one if needed
+func LoadOrCreateToken(path string) (string, error) {
+	if token, err := LoadToken(path); err == nil {
+		return token, nil
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate admin token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write admin token: %w", err)
+	}
+	return token, nil
+}
@@ -4,80 +4,503 @@ import (
 	"log"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/user/blocker/internal/schedule"
 )
 
-// Blocker manages the blacklist and checks domains
+// Blocker manages the blacklist and whitelist and checks domains
 type Blocker struct {
-	matchers   []Matcher
-	mu         sync.RWMutex
-	logBlocked bool
-	logAllowed bool
-	
+	matchers      *index
+	allowMatchers *index
+	groups        []group
+	lists         []list
+	exemptions    []exemption
+	pausedUntil   time.Time
+	quotas        *index
+	profiles      *index
+	blockIPs      bool
+	resolveIPs    bool
+	usage         UsageTracker
+	now           func() time.Time
+	mu            sync.RWMutex
+	logBlocked    bool
+	logAllowed    bool
+
 	// Statistics
-	blockedCount int64
-	allowedCount int64
-	statsMu      sync.Mutex
+	blockedCount   int64
+	allowedCount   int64
+	lookupsBlocked int64 // DNS lookups, counted apart from requests
+	lookupsAllowed int64
+	history        history
+	statsMu        sync.Mutex
 }
 
 // New creates a new Blocker instance
 func New() *Blocker {
 	return &Blocker{
-		matchers:   make([]Matcher, 0),
-		logBlocked: true,
-		logAllowed: false,
+		matchers:      newIndex(nil),
+		allowMatchers: newIndex(nil),
+		now:           time.Now,
+		logBlocked:    true,
+		logAllowed:    false,
+	}
+}
+
+// Ruleset holds the rules and logging settings applied by Apply
+type Ruleset struct {
+	Blacklist  []string
+	Whitelist  []string
+	Groups     []Group
+	Lists      []List
+	LogBlocked bool
+	LogAllowed bool
+
+	// Exemptions temporarily allow domains that would otherwise be blocked
+	Exemptions  []Exemption
+	PausedUntil time.Time // Blocking is disabled entirely until this time
+
+	// Quotas are patterns whose usage is limited by the UsageTracker
+	Quotas []string
+
+	// ProfilePatterns are the blacklists of every profile, active or not.
+	// They only feed the PAC script, so switching profiles does not depend
+	// on browsers fetching it again.
+	ProfilePatterns []string
+
+	// BlockIPLiterals blocks requests to raw IP addresses that are not whitelisted
+	BlockIPLiterals bool
+
+	// ResolveIPs asks the proxy to resolve hosts before connecting, so "ip:"
+	// block rules also apply to domains
+	ResolveIPs bool
+}
+
+// UsageTracker accounts usage of quota patterns
+type UsageTracker interface {
+	// Exhausted reports whether the daily budget of a pattern is used up
+	Exhausted(pattern string) bool
+	// Begin records the start of activity and returns a function ending it
+	Begin(pattern string) (end func())
+	// Remaining returns the time left in the daily time budget of a pattern,
+	// ok is false without a time limit
+	Remaining(pattern string) (left time.Duration, ok bool)
+}
+
+// Exemption allows domains matching Pattern until the given time
+type Exemption struct {
+	Pattern string
+	Until   time.Time
+}
+
+// exemption is a compiled Exemption
+type exemption struct {
+	matcher Matcher
+	until   time.Time
+}
+
+// Group is a named set of patterns that is only blocked while its schedule is active
+type Group struct {
+	Name     string
+	Patterns []string
+	Schedule *schedule.Schedule
+}
+
+// List holds the patterns of a subscribed blocklist
+type List struct {
+	Name  string
+	Block []string // Merged into the blacklist
+	Allow []string // Merged into the whitelist
+}
+
+// list is a compiled List
+type list struct {
+	name  string
+	block *index
+	allow *index
+}
+
+// group is a compiled Group
+type group struct {
+	name     string
+	matchers *index
+	schedule *schedule.Schedule
+}
+
+// SetUsageTracker sets the tracker used to enforce quotas
+func (b *Blocker) SetUsageTracker(t UsageTracker) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.usage = t
+}
+
+// BeginUsage records the start of activity for a decision's quota and returns
+// a function that must be called when the activity ends
+func (b *Blocker) BeginUsage(d Decision) (end func()) {
+	b.mu.RLock()
+	usage := b.usage
+	b.mu.RUnlock()
+
+	if d.Quota == "" || d.Blocked || usage == nil {
+		return func() {}
+	}
+	return usage.Begin(d.Quota)
+}
+
+// UsageRemaining returns the time left in the time budget of a decision's
+// quota. ok is false if the decision has no quota with a time limit.
+func (b *Blocker) UsageRemaining(d Decision) (left time.Duration, ok bool) {
+	b.mu.RLock()
+	usage := b.usage
+	b.mu.RUnlock()
+
+	if d.Quota == "" || d.Blocked || usage == nil {
+		return 0, false
 	}
+	return usage.Remaining(d.Quota)
+}
+
+// SetClock replaces the clock used to evaluate schedules (for testing)
+func (b *Blocker) SetClock(now func() time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.now = now
+}
+
+// ResolveIPs reports whether hosts should be resolved and their addresses
+// passed in Request.Addrs
+func (b *Blocker) ResolveIPs() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.resolveIPs
 }
 
 // SetLogging configures logging behavior
 func (b *Blocker) SetLogging(logBlocked, logAllowed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	b.logBlocked = logBlocked
 	b.logAllowed = logAllowed
 }
 
+// Apply atomically replaces the blacklist, whitelist and logging settings,
+// so no request is ever checked against a half-updated rule set
+func (b *Blocker) Apply(rs Ruleset) {
+	matchers := compile(rs.Blacklist)
+	allowMatchers := compile(rs.Whitelist)
+	groups := make([]group, 0, len(rs.Groups))
+	for _, g := range rs.Groups {
+		groups = append(groups, group{
+			name:     g.Name,
+			matchers: compile(g.Patterns),
+			schedule: g.Schedule,
+		})
+	}
+	lists := make([]list, 0, len(rs.Lists))
+	for _, l := range rs.Lists {
+		lists = append(lists, list{
+			name:  l.Name,
+			block: compile(l.Block),
+			allow: compile(l.Allow),
+		})
+	}
+	exemptions := make([]exemption, 0, len(rs.Exemptions))
+	for _, e := range rs.Exemptions {
+		exemptions = append(exemptions, exemption{
+			matcher: CreateMatcher(e.Pattern),
+			until:   e.Until,
+		})
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.matchers = matchers
+	b.allowMatchers = allowMatchers
+	b.groups = groups
+	b.lists = lists
+	b.exemptions = exemptions
+	b.pausedUntil = rs.PausedUntil
+	b.quotas = compile(rs.Quotas)
+	b.profiles = compile(rs.ProfilePatterns)
+	b.blockIPs = rs.BlockIPLiterals
+	b.resolveIPs = rs.ResolveIPs
+	b.logBlocked = rs.LogBlocked
+	b.logAllowed = rs.LogAllowed
+
+	log.Printf("[blocker] Applied rule set with %d blacklist, %d whitelist patterns, %d groups and %d lists",
+		b.matchers.len(), b.allowMatchers.len(), len(b.groups), len(b.lists))
+}
+
 // UpdateBlacklist replaces the current blacklist with new patterns
 func (b *Blocker) UpdateBlacklist(patterns []string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	
-	b.matchers = make([]Matcher, 0, len(patterns))
+
+	b.matchers = compile(patterns)
+
+	log.Printf("[blocker] Updated blacklist with %d patterns", b.matchers.len())
+}
+
+// UpdateWhitelist replaces the current whitelist with new patterns.
+// Whitelisted domains are never blocked, even if they match the blacklist.
+func (b *Blocker) UpdateWhitelist(patterns []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.allowMatchers = compile(patterns)
+
+	log.Printf("[blocker] Updated whitelist with %d patterns", b.allowMatchers.len())
+}
+
+// createMatchers builds matchers for all non-empty patterns
+func createMatchers(patterns []string) []Matcher {
+	matchers := make([]Matcher, 0, len(patterns))
 	for _, pattern := range patterns {
 		pattern = strings.TrimSpace(pattern)
 		if pattern == "" {
 			continue
 		}
-		b.matchers = append(b.matchers, CreateMatcher(pattern))
+		matchers = append(matchers, CreateMatcher(pattern))
 	}
-	
-	log.Printf("[blocker] Updated blacklist with %d patterns", len(b.matchers))
+	return matchers
 }
 
 // IsBlocked checks if a domain should be blocked
 func (b *Blocker) IsBlocked(domain string) bool {
+	return b.Check(domain).Blocked
+}
+
+// Check decides whether a domain should be blocked and records the decision.
+// Only host-level rules apply, as for CONNECT tunnels.
+func (b *Blocker) Check(domain string) Decision {
+	return b.CheckRequest(Request{Host: domain, Method: "CONNECT"})
+}
+
+// CheckRequest decides whether a request should be blocked and records the
+// decision. Path rules apply only to requests with a Path.
+func (b *Blocker) CheckRequest(req Request) Decision {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
-	
-	// Extract domain from host:port if needed
-	if idx := strings.LastIndex(domain, ":"); idx != -1 {
-		domain = domain[:idx]
-	}
-	
-	domain = strings.ToLower(strings.TrimSpace(domain))
-	
-	for _, matcher := range b.matchers {
-		if matcher.Match(domain) {
-			b.recordBlocked()
-			if b.logBlocked {
-				log.Printf("[BLOCKED] %s (matched: %s)", domain, matcher.Pattern())
+
+	d := b.decide(normalizeRequest(req))
+	if req.Method == MethodDNS {
+		b.recordLookup(d)
+	} else {
+		b.record(d)
+	}
+	return d
+}
+
+// normalizeRequest splits the port off the host and normalizes the domain
+func normalizeRequest(req Request) Request {
+	// Extract domain from host:port if needed, keeping IPv6 literals intact
+	domain, port := SplitHostPort(req.Host)
+	req.Host = NormalizeDomain(domain)
+	if req.Port == "" {
+		req.Port = port
+	}
+	if req.Port == "" {
+		req.Port = defaultPort(req.Method)
+	}
+	return req
+}
+
+// defaultPort returns the port a request goes to when none is given
+func defaultPort(method string) string {
+	if method == "CONNECT" {
+		return "443"
+	}
+	return "80"
+}
+
+// decide evaluates the rules and exemptions for a request with a normalized host
+func (b *Blocker) decide(req Request) Decision {
+	now := b.now()
+	d := b.match(req, now)
+	if d.Blocked {
+		b.exempt(&d, req, now)
+	}
+	return d
+}
+
+// exempt allows a blocked decision if blocking is paused or the domain is snoozed
+func (b *Blocker) exempt(d *Decision, req Request, now time.Time) {
+	if now.Before(b.pausedUntil) {
+		d.Blocked = false
+		d.Reason = ReasonPaused
+		d.Until = b.pausedUntil
+		return
+	}
+
+	for _, e := range b.exemptions {
+		if now.Before(e.until) && matches(e.matcher, req) {
+			d.Blocked = false
+			d.Reason = ReasonSnoozed
+			d.Until = e.until
+			return
+		}
+	}
+}
+
+// match evaluates the whitelist, blacklist and scheduled groups for a request
+func (b *Blocker) match(req Request, now time.Time) Decision {
+	d := Decision{
+		Time:   now,
+		Domain: req.Host,
+		Path:   req.Path,
+	}
+
+	// Whitelist takes precedence over the blacklist. Resolved addresses are
+	// only used to block, so DNS can never whitelist a domain.
+	allowReq := req
+	allowReq.Addrs = nil
+	if matcher := b.allowMatchers.match(allowReq); matcher != nil {
+		d.Pattern = matcher.Pattern()
+		d.Reason = ReasonWhitelist
+		return d
+	}
+
+	if matcher := b.matchers.match(req); matcher != nil {
+		d.Blocked = true
+		d.Pattern = matcher.Pattern()
+		d.Reason = ReasonBlacklist
+		d.ResolvedIP = resolvedIP(matcher, req)
+		return d
+	}
+
+	// Allow entries of subscribed lists only override block entries of
+	// subscribed lists, so a remote list can never unblock the user's rules
+	for _, l := range b.lists {
+		if matcher := l.block.match(req); matcher != nil {
+			if allow, name := b.listAllow(allowReq); allow != nil {
+				d.Pattern = allow.Pattern()
+				d.Reason = ReasonWhitelist
+				d.List = name
+				return d
 			}
-			return true
+			d.Blocked = true
+			d.Pattern = matcher.Pattern()
+			d.Reason = ReasonBlacklist
+			d.List = l.name
+			d.ResolvedIP = resolvedIP(matcher, req)
+			return d
 		}
 	}
-	
-	b.recordAllowed()
-	if b.logAllowed {
-		log.Printf("[ALLOWED] %s", domain)
+
+	// Scheduled groups only apply while their schedule is active
+	for _, g := range b.groups {
+		if g.schedule != nil && !g.schedule.Active(now) {
+			continue
+		}
+		if matcher := g.matchers.match(req); matcher != nil {
+			d.Blocked = true
+			d.Pattern = matcher.Pattern()
+			d.Reason = ReasonGroup
+			d.Group = g.name
+			d.ResolvedIP = resolvedIP(matcher, req)
+			return d
+		}
+	}
+
+	// Raw IP addresses bypass domain rules, so they can be blocked outright
+	if b.blockIPs && isIPLiteral(req.Host) {
+		d.Blocked = true
+		d.Reason = ReasonIPLiteral
+		return d
+	}
+
+	// Quota patterns are allowed until their daily budget is used up
+	if matcher := b.quotas.match(req); matcher != nil {
+		d.Quota = matcher.Pattern()
+		if b.usage != nil && b.usage.Exhausted(d.Quota) {
+			d.Blocked = true
+			d.Pattern = d.Quota
+			d.Reason = ReasonQuota
+		}
+	}
+
+	return d
+}
+
+// listAllow returns the first allow entry of a subscribed list matching req
+// and the name of its list
+func (b *Blocker) listAllow(req Request) (Matcher, string) {
+	for _, l := range b.lists {
+		if matcher := l.allow.match(req); matcher != nil {
+			return matcher, l.name
+		}
+	}
+	return nil, ""
+}
+
+// record updates statistics and decision history and logs the decision
+func (b *Blocker) record(d Decision) {
+	b.logDecision(d)
+	if d.Blocked {
+		b.recordBlocked()
+	} else {
+		b.recordAllowed()
+	}
+
+	b.statsMu.Lock()
+	b.history.add(d)
+	b.statsMu.Unlock()
+}
+
+// recordLookup counts and logs the decision for a DNS lookup. Lookups are
+// kept out of the request statistics and history, since the connection that
+// follows the lookup is checked and recorded too.
+func (b *Blocker) recordLookup(d Decision) {
+	b.logDecision(d)
+
+	b.statsMu.Lock()
+	if d.Blocked {
+		b.lookupsBlocked++
+	} else {
+		b.lookupsAllowed++
+	}
+	b.statsMu.Unlock()
+}
+
+// logDecision logs a decision according to the logging settings
+func (b *Blocker) logDecision(d Decision) {
+	if d.Blocked {
+		if b.logBlocked {
+			switch {
+			case d.Reason == ReasonQuota:
+				log.Printf("[BLOCKED] %s (quota exhausted: %s)", d.Domain, d.Pattern)
+			case d.Reason == ReasonIPLiteral:
+				log.Printf("[BLOCKED] %s (IP literal)", d.Domain)
+			case d.ResolvedIP != "":
+				log.Printf("[BLOCKED] %s (matched: %s, resolved: %s)", d.Domain, d.Pattern, d.ResolvedIP)
+			case d.Group != "":
+				log.Printf("[BLOCKED] %s (matched: %s, group: %s)", d.Domain, d.Pattern, d.Group)
+			case d.List != "":
+				log.Printf("[BLOCKED] %s (matched: %s, list: %s)", d.Domain, d.Pattern, d.List)
+			default:
+				log.Printf("[BLOCKED] %s (matched: %s)", d.Domain, d.Pattern)
+			}
+		}
+	} else {
+		switch {
+		case d.Reason == ReasonSnoozed || d.Reason == ReasonPaused:
+			// Would have been blocked, so log it along with blocked requests
+			if b.logBlocked || b.logAllowed {
+				log.Printf("[ALLOWED] %s (%s until %s, matched: %s)",
+					d.Domain, d.Reason, d.Until.Format("15:04:05"), d.Pattern)
+			}
+		case !b.logAllowed:
+		case d.Reason == ReasonWhitelist:
+			log.Printf("[ALLOWED] %s (whitelisted: %s)", d.Domain, d.Pattern)
+		default:
+			log.Printf("[ALLOWED] %s", d.Domain)
+		}
 	}
-	return false
 }
 
 // recordBlocked increments the blocked counter
@@ -101,13 +524,40 @@ func (b *Blocker) Stats() (blocked, allowed int64) {
 	return b.blockedCount, b.allowedCount
 }
 
+// LookupStats returns the DNS lookup statistics, which Stats leaves out
+func (b *Blocker) LookupStats() (blocked, allowed int64) {
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+	return b.lookupsBlocked, b.lookupsAllowed
+}
+
+// RecentDecisions returns the most recent decisions, newest first
+func (b *Blocker) RecentDecisions() []Decision {
+	b.statsMu.Lock()
+	defer b.statsMu.Unlock()
+	return b.history.list()
+}
+
 // GetPatterns returns current blacklist patterns
 func (b *Blocker) GetPatterns() []string {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
-	
-	patterns := make([]string, len(b.matchers))
-	for i, m := range b.matchers {
+
+	return b.matchers.patterns()
+}
+
+// GetWhitelistPatterns returns current whitelist patterns
+func (b *Blocker) GetWhitelistPatterns() []string {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.allowMatchers.patterns()
+}
+
+// matcherPatterns returns the patterns of the given matchers
+func matcherPatterns(matchers []Matcher) []string {
+	patterns := make([]string, len(matchers))
+	for i, m := range matchers {
 		patterns[i] = m.Pattern()
 	}
 	return patterns
@@ -0,0 +1,374 @@
+package blocker
+
+import (
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/user/blocker/internal/schedule"
+)
+
+func TestWhitelistOverridesBlacklist(t *testing.T) {
+	b := New()
+	b.SetLogging(false, false)
+	b.UpdateBlacklist([]string{"google.*", "facebook.com"})
+	b.UpdateWhitelist([]string{"docs.google.com", "mail.google.com"})
+
+	tests := []struct {
+		domain   string
+		expected bool
+	}{
+		{"google.com", true},
+		{"www.google.de", true},
+		{"docs.google.com", false},
+		{"sheets.docs.google.com", false},
+		{"mail.google.com:443", false},
+		{"mail.google.de", true},
+		{"facebook.com", true},
+		{"example.com", false},
+	}
+
+	for _, tt := range tests {
+		result := b.IsBlocked(tt.domain)
+		if result != tt.expected {
+			t.Errorf("IsBlocked(%q) = %v, want %v", tt.domain, result, tt.expected)
+		}
+	}
+}
+
+func TestListPrecedence(t *testing.T) {
+	b := New()
+	b.Apply(Ruleset{
+		Blacklist: []string{"reddit.com"},
+		Whitelist: []string{"docs.example.com"},
+		Lists: []List{
+			{Name: "ads", Block: []string{"example.com", "tracker.test"}, Allow: []string{"reddit.com", "cdn.tracker.test"}},
+			{Name: "fixes", Allow: []string{"www.example.com", "chat.test"}},
+		},
+		Groups: []Group{{Name: "work", Patterns: []string{"chat.test"}}},
+	})
+
+	tests := []struct {
+		host     string
+		expected bool
+		reason   string
+		list     string
+	}{
+		{"www.reddit.com", true, ReasonBlacklist, ""},        // List allows never override the user
+		{"docs.example.com", false, ReasonWhitelist, ""},     // The user's whitelist overrides lists
+		{"ads.example.com", true, ReasonBlacklist, "ads"},    // Blocked by a list
+		{"www.example.com", false, ReasonWhitelist, "fixes"}, // Another list's allow entry
+		{"cdn.tracker.test", false, ReasonWhitelist, "ads"},  // The list's own allow entry
+		{"tracker.test", true, ReasonBlacklist, "ads"},
+		{"chat.test", true, ReasonGroup, ""}, // Nor the user's groups
+	}
+
+	for _, tt := range tests {
+		d := b.Check(tt.host)
+		if d.Blocked != tt.expected || d.Reason != tt.reason || d.List != tt.list {
+			t.Errorf("Check(%s) = blocked %v, %s, list %q; want %v, %s, list %q",
+				tt.host, d.Blocked, d.Reason, d.List, tt.expected, tt.reason, tt.list)
+		}
+	}
+}
+
+func TestScheduledGroups(t *testing.T) {
+	workHours, err := schedule.Parse([]string{"mon-fri"}, []string{"09:00-17:30"}, "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := New()
+	b.SetLogging(false, false)
+	b.Apply(Ruleset{
+		Whitelist: []string{"old.reddit.com"},
+		Groups: []Group{
+			{Name: "work", Patterns: []string{"reddit.com"}, Schedule: workHours},
+		},
+	})
+
+	tests := []struct {
+		time     string
+		domain   string
+		expected bool
+	}{
+		{"2024-01-08T10:00:00Z", "reddit.com", true},      // Monday, working hours
+		{"2024-01-08T10:00:00Z", "www.reddit.com", true},  // Monday, working hours
+		{"2024-01-08T10:00:00Z", "old.reddit.com", false}, // Whitelisted
+		{"2024-01-08T18:00:00Z", "reddit.com", false},     // Monday evening
+		{"2024-01-13T10:00:00Z", "reddit.com", false},     // Saturday
+	}
+
+	for _, tt := range tests {
+		now, _ := time.Parse(time.RFC3339, tt.time)
+		b.SetClock(func() time.Time { return now })
+
+		d := b.Check(tt.domain)
+		if d.Blocked != tt.expected {
+			t.Errorf("at %s Check(%q).Blocked = %v, want %v", tt.time, tt.domain, d.Blocked, tt.expected)
+		}
+		if d.Blocked && d.Group != "work" {
+			t.Errorf("at %s Check(%q).Group = %q, want work", tt.time, tt.domain, d.Group)
+		}
+	}
+}
+
+func TestExemptions(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2024-01-08T10:00:00Z")
+
+	b := New()
+	b.SetLogging(false, false)
+	b.SetClock(func() time.Time { return now })
+	b.Apply(Ruleset{
+		Blacklist: []string{"reddit.com", "youtube.com", "twitter.com"},
+		Exemptions: []Exemption{
+			{Pattern: "reddit.com", Until: now.Add(15 * time.Minute)},
+			{Pattern: "youtube.com", Until: now.Add(-time.Minute)},
+		},
+	})
+
+	d := b.Check("www.reddit.com")
+	if d.Blocked || d.Reason != ReasonSnoozed {
+		t.Errorf("Check(www.reddit.com) = %+v, want snoozed", d)
+	}
+	if !b.IsBlocked("youtube.com") {
+		t.Error("youtube.com allowed by expired snooze")
+	}
+	if !b.IsBlocked("twitter.com") {
+		t.Error("twitter.com allowed without snooze")
+	}
+
+	b.Apply(Ruleset{
+		Blacklist:   []string{"reddit.com"},
+		PausedUntil: now.Add(10 * time.Minute),
+	})
+	if d := b.Check("reddit.com"); d.Blocked || d.Reason != ReasonPaused {
+		t.Errorf("Check(reddit.com) while paused = %+v, want paused", d)
+	}
+
+	now = now.Add(11 * time.Minute)
+	if !b.IsBlocked("reddit.com") {
+		t.Error("reddit.com allowed after pause expired")
+	}
+}
+
+func TestPathRules(t *testing.T) {
+	b := New()
+	b.Apply(Ruleset{
+		Blacklist: []string{"example.com/games/", "POST forum.example.org/reply"},
+		Whitelist: []string{"example.com/games/chess"},
+	})
+
+	tests := []struct {
+		req      Request
+		expected bool
+	}{
+		{Request{Host: "example.com:80", Method: "GET", Path: "/games/tetris"}, true},
+		{Request{Host: "example.com", Method: "GET", Path: "/games/chess/play"}, false},
+		{Request{Host: "example.com", Method: "GET", Path: "/news/"}, false},
+		{Request{Host: "forum.example.org", Method: "POST", Path: "/reply?t=1"}, true},
+		{Request{Host: "forum.example.org", Method: "GET", Path: "/reply?t=1"}, false},
+	}
+
+	for _, tt := range tests {
+		d := b.CheckRequest(tt.req)
+		if d.Blocked != tt.expected {
+			t.Errorf("CheckRequest(%+v) blocked = %v, want %v", tt.req, d.Blocked, tt.expected)
+		}
+	}
+
+	// Tunnels carry no path, so only host-level rules apply
+	if b.IsBlocked("example.com:443") {
+		t.Errorf("IsBlocked(example.com:443) = true, want false")
+	}
+}
+
+func TestRequestPath(t *testing.T) {
+	b := New()
+	b.Apply(Ruleset{Blacklist: []string{"example.com/games/", "example.com/search?q=*cats"}})
+
+	tests := []struct {
+		uri      string
+		path     string
+		expected bool
+	}{
+		{"/games/tetris", "/games/tetris", true},
+		{"/%67ames/", "/games/", true},
+		{"/./games/", "/games/", true},
+		{"/news/../games/", "/games/", true},
+		{"//games//tetris", "/games/tetris", true},
+		{"/games", "/games", true},
+		{"/gameshow", "/gameshow", false},
+		{"", "/", false},
+		{"/search?q=funny+cats", "/search?q=funny+cats", true},
+		{"/./search?q=funny+cats", "/search?q=funny+cats", true},
+	}
+
+	for _, tt := range tests {
+		u, err := url.Parse("http://example.com" + tt.uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := RequestPath(u)
+		if path != tt.path {
+			t.Errorf("RequestPath(%q) = %q, want %q", tt.uri, path, tt.path)
+		}
+		d := b.CheckRequest(Request{Host: "example.com", Method: "GET", Path: path})
+		if d.Blocked != tt.expected {
+			t.Errorf("CheckRequest(%q) blocked = %v, want %v", tt.uri, d.Blocked, tt.expected)
+		}
+	}
+}
+
+func TestIPRules(t *testing.T) {
+	b := New()
+	b.Apply(Ruleset{
+		Blacklist:       []string{"ip:142.250.0.0/15", "ip:2001:db8::/32"},
+		Whitelist:       []string{"ip:192.168.0.0/16", "localhost"},
+		BlockIPLiterals: true,
+	})
+
+	tests := []struct {
+		host     string
+		expected bool
+		reason   string
+	}{
+		{"142.250.1.1", true, ReasonBlacklist},
+		{"142.250.1.1:443", true, ReasonBlacklist},
+		{"[2001:db8::1]:443", true, ReasonBlacklist},
+		{"1.2.3.4:443", true, ReasonIPLiteral},
+		{"[::2]:8080", true, ReasonIPLiteral},
+		{"192.168.1.10:80", false, ReasonWhitelist},
+		{"localhost:8080", false, ReasonWhitelist},
+		{"example.com:443", false, ""},
+	}
+
+	for _, tt := range tests {
+		d := b.Check(tt.host)
+		if d.Blocked != tt.expected || d.Reason != tt.reason {
+			t.Errorf("Check(%q) = blocked %v, reason %q, want %v, %q", tt.host, d.Blocked, d.Reason, tt.expected, tt.reason)
+		}
+	}
+}
+
+func TestResolvedAddresses(t *testing.T) {
+	b := New()
+	b.Apply(Ruleset{
+		Blacklist:  []string{"ip:203.0.113.0/24"},
+		Whitelist:  []string{"ip:10.0.0.0/8"},
+		ResolveIPs: true,
+	})
+
+	addrs := func(ips ...string) []netip.Addr {
+		var out []netip.Addr
+		for _, ip := range ips {
+			out = append(out, netip.MustParseAddr(ip))
+		}
+		return out
+	}
+
+	d := b.CheckRequest(Request{Host: "rotating.example:443", Addrs: addrs("198.51.100.1", "203.0.113.7")})
+	if !d.Blocked || d.ResolvedIP != "203.0.113.7" {
+		t.Errorf("blocked = %v, resolved IP = %q, want true, 203.0.113.7", d.Blocked, d.ResolvedIP)
+	}
+
+	// Resolved addresses never whitelist a domain
+	d = b.CheckRequest(Request{Host: "rotating.example", Addrs: addrs("10.0.0.1", "203.0.113.7")})
+	if !d.Blocked {
+		t.Errorf("whitelisted resolved address allowed the domain")
+	}
+
+	d = b.CheckRequest(Request{Host: "other.example", Addrs: addrs("198.51.100.1")})
+	if d.Blocked || d.ResolvedIP != "" {
+		t.Errorf("blocked = %v, resolved IP = %q, want false, empty", d.Blocked, d.ResolvedIP)
+	}
+
+	// Literal hosts report no resolved IP
+	d = b.Check("203.0.113.9:443")
+	if !d.Blocked || d.ResolvedIP != "" {
+		t.Errorf("literal: blocked = %v, resolved IP = %q, want true, empty", d.Blocked, d.ResolvedIP)
+	}
+}
+
+func TestScopedRules(t *testing.T) {
+	b := New()
+	b.Apply(Ruleset{Blacklist: []string{"intranet.example:8443", "http://bank.example"}})
+
+	tests := []struct {
+		req      Request
+		expected bool
+	}{
+		{Request{Host: "intranet.example:8443", Method: "CONNECT"}, true},
+		{Request{Host: "intranet.example:443", Method: "CONNECT"}, false},
+		{Request{Host: "intranet.example", Method: "CONNECT"}, false}, // Defaults to 443
+		{Request{Host: "bank.example", Method: "GET", Path: "/"}, true},
+		{Request{Host: "bank.example:443", Method: "CONNECT"}, false},
+		{Request{Host: "bank.example", Method: MethodDNS}, false}, // Any port or scheme
+		{Request{Host: "intranet.example", Method: MethodDNS}, false},
+	}
+
+	for _, tt := range tests {
+		if d := b.CheckRequest(tt.req); d.Blocked != tt.expected {
+			t.Errorf("CheckRequest(%+v) blocked = %v, want %v", tt.req, d.Blocked, tt.expected)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	workHours, err := schedule.Parse([]string{"mon-fri"}, []string{"09:00-17:30"}, "UTC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saturday := time.Date(2024, 6, 8, 10, 0, 0, 0, time.UTC)
+
+	b := New()
+	b.SetClock(func() time.Time { return saturday })
+	b.Apply(Ruleset{
+		Blacklist: []string{"reddit.com", "*.reddit.com"},
+		Lists:     []List{{Name: "social", Block: []string{"old.reddit.com"}}},
+		Groups:    []Group{{Name: "work", Patterns: []string{"reddit.com"}, Schedule: workHours}},
+		Exemptions: []Exemption{
+			{Pattern: "old.reddit.com", Until: saturday.Add(10 * time.Minute)},
+		},
+	})
+
+	e := b.Explain(Request{Host: "old.reddit.com"})
+	if e.Decision.Blocked || e.Decision.Reason != ReasonSnoozed {
+		t.Fatalf("decision = %+v, want allowed by snooze", e.Decision)
+	}
+
+	type key struct {
+		source, pattern string
+		active, won     bool
+	}
+	var got []key
+	for _, m := range e.Matches {
+		got = append(got, key{m.Source, m.Pattern, m.Active, m.Won})
+	}
+	want := []key{
+		{ReasonBlacklist, "reddit.com", true, false},
+		{ReasonBlacklist, "*.reddit.com", true, false},
+		{ReasonBlacklist, "old.reddit.com", true, false}, // From the list
+		{ReasonGroup, "reddit.com", false, false},        // Outside the schedule
+		{ReasonSnoozed, "old.reddit.com", true, true},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("matches = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("match %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	// Explain does not record decisions
+	if blocked, allowed := b.Stats(); blocked != 0 || allowed != 0 {
+		t.Errorf("Stats() = %d, %d after Explain, want 0, 0", blocked, allowed)
+	}
+
+	e = b.Explain(Request{Host: "www.reddit.com"})
+	if !e.Decision.Blocked || !e.Matches[0].Won || e.Matches[0].Pattern != "reddit.com" {
+		t.Errorf("www.reddit.com: decision %+v, matches %+v, want first blacklist pattern to win", e.Decision, e.Matches)
+	}
+}
@@ -0,0 +1,71 @@
+package blocker
+
+import (
+	"time"
+)
+
+// Reasons explaining why a decision was made
+const (
+	ReasonBlacklist = "blacklist"
+	ReasonWhitelist = "whitelist"
+	ReasonGroup     = "group"
+	ReasonSnoozed   = "snoozed"
+	ReasonPaused    = "paused"
+	ReasonQuota     = "quota"
+	ReasonIPLiteral = "ip-literal"
+)
+
+// historySize is the number of recent decisions kept in memory
+const historySize = 100
+
+// Decision describes the outcome of checking a single request
+type Decision struct {
+	Time    time.Time `json:"time"`
+	Domain  string    `json:"domain"`
+	Path    string    `json:"path,omitempty"` // Path and query of plain HTTP requests
+	Blocked bool      `json:"blocked"`
+	Pattern string    `json:"pattern,omitempty"` // Pattern that decided the outcome, if any
+	Reason  string    `json:"reason,omitempty"`  // Rule list the pattern came from
+	Group   string    `json:"group,omitempty"`   // Scheduled group the pattern belongs to
+	List    string    `json:"list,omitempty"`    // Subscribed list the pattern belongs to
+	Until   time.Time `json:"until,omitempty"`   // End of the snooze or pause that allowed it
+	Quota   string    `json:"quota,omitempty"`   // Quota pattern the domain is accounted to
+
+	// ResolvedIP is the resolved address of the domain that matched an "ip:" rule
+	ResolvedIP string `json:"resolved_ip,omitempty"`
+}
+
+// history is a fixed-size ring buffer of recent decisions
+type history struct {
+	entries []Decision
+	next    int
+	full    bool
+}
+
+// add stores a decision, overwriting the oldest one when full
+func (h *history) add(d Decision) {
+	if h.entries == nil {
+		h.entries = make([]Decision, historySize)
+	}
+
+	h.entries[h.next] = d
+	h.next = (h.next + 1) % len(h.entries)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// list returns the stored decisions, newest first
+func (h *history) list() []Decision {
+	n := h.next
+	if h.full {
+		n = len(h.entries)
+	}
+
+	result := make([]Decision, 0, n)
+	for i := 1; i <= n; i++ {
+		idx := (h.next - i + len(h.entries)) % len(h.entries)
+		result = append(result, h.entries[idx])
+	}
+	return result
+}
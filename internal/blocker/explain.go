@@ -0,0 +1,120 @@
+package blocker
+
+import (
+	"time"
+)
+
+// Match is a rule that matched a request, as reported by Explain
+type Match struct {
+	Source  string    `json:"source"` // Reason the rule decides with, e.g. blacklist or snoozed
+	Pattern string    `json:"pattern,omitempty"`
+	Group   string    `json:"group,omitempty"` // Scheduled group the pattern belongs to
+	List    string    `json:"list,omitempty"`  // Subscribed list the pattern belongs to
+	Until   time.Time `json:"until,omitempty"` // End of a snooze or pause
+	Active  bool      `json:"active"`          // False for inactive groups, expired exemptions and quotas with budget left
+	Won     bool      `json:"won"`             // This rule decided the outcome
+}
+
+// Explanation is the decision for a request along with every rule that matched it
+type Explanation struct {
+	Decision Decision `json:"decision"`
+	Matches  []Match  `json:"matches"`
+}
+
+// Explain decides a request like CheckRequest, without recording it, and
+// reports every matching rule and which one decided the outcome
+func (b *Blocker) Explain(req Request) Explanation {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	req = normalizeRequest(req)
+	now := b.now()
+	e := Explanation{
+		Decision: b.decide(req),
+		Matches:  []Match{},
+	}
+
+	// Resolved addresses are only used to block, as in match
+	allowReq := req
+	allowReq.Addrs = nil
+
+	e.addMatches(b.allowMatchers, allowReq, Match{Source: ReasonWhitelist, Active: true})
+	e.addMatches(b.matchers, req, Match{Source: ReasonBlacklist, Active: true})
+
+	// List allow entries only apply against list block entries, as in match
+	listBlocked := false
+	for _, l := range b.lists {
+		listBlocked = listBlocked || l.block.match(req) != nil
+	}
+	for _, l := range b.lists {
+		e.addMatches(l.allow, allowReq, Match{Source: ReasonWhitelist, List: l.name, Active: listBlocked})
+	}
+	for _, l := range b.lists {
+		e.addMatches(l.block, req, Match{Source: ReasonBlacklist, List: l.name, Active: true})
+	}
+	for _, g := range b.groups {
+		active := g.schedule == nil || g.schedule.Active(now)
+		e.addMatches(g.matchers, req, Match{Source: ReasonGroup, Group: g.name, Active: active})
+	}
+
+	if b.blockIPs && isIPLiteral(req.Host) {
+		e.Matches = append(e.Matches, Match{Source: ReasonIPLiteral, Active: true})
+	}
+
+	if b.quotas != nil {
+		for _, m := range b.quotas.matchers {
+			if matches(m, req) {
+				exhausted := b.usage != nil && b.usage.Exhausted(m.Pattern())
+				e.Matches = append(e.Matches, Match{Source: ReasonQuota, Pattern: m.Pattern(), Active: exhausted})
+			}
+		}
+	}
+
+	if !b.pausedUntil.IsZero() {
+		e.Matches = append(e.Matches, Match{Source: ReasonPaused, Until: b.pausedUntil, Active: now.Before(b.pausedUntil)})
+	}
+	for _, ex := range b.exemptions {
+		if matches(ex.matcher, req) {
+			e.Matches = append(e.Matches, Match{
+				Source:  ReasonSnoozed,
+				Pattern: ex.matcher.Pattern(),
+				Until:   ex.until,
+				Active:  now.Before(ex.until),
+			})
+		}
+	}
+
+	e.markWinner()
+	return e
+}
+
+// addMatches appends a copy of tmpl for every matcher in ix matching req
+func (e *Explanation) addMatches(ix *index, req Request, tmpl Match) {
+	if ix == nil {
+		return
+	}
+	for _, m := range ix.matchers {
+		if matches(m, req) {
+			match := tmpl
+			match.Pattern = m.Pattern()
+			e.Matches = append(e.Matches, match)
+		}
+	}
+}
+
+// markWinner marks the match that produced the decision
+func (e *Explanation) markWinner() {
+	d := e.Decision
+	for i, m := range e.Matches {
+		if m.Source != d.Reason || !m.Active {
+			continue
+		}
+
+		// Snoozes and pauses report the blocking pattern they overrode
+		exempted := d.Reason == ReasonSnoozed || d.Reason == ReasonPaused
+		if exempted || (m.Pattern == d.Pattern && m.Group == d.Group && m.List == d.List) {
+			e.Matches[i].Won = true
+			return
+		}
+	}
+}
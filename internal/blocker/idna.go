@@ -0,0 +1,40 @@
+package blocker
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/idna"
+)
+
+// NormalizeDomain converts a domain or domain pattern to the canonical ASCII
+// form browsers send: lowercased, trailing dots removed, and labels with
+// non-ASCII characters mapped and punycode-encoded as UTS #46 lookups do
+// ("bücher.de" -> "xn--bcher-kva.de"). The mapping folds fullwidth forms and
+// ideographic dots and applies NFC, so decomposed accents match too.
+// Lookalike letters from other scripts stay distinct domains.
+func NormalizeDomain(domain string) string {
+	domain = strings.TrimSpace(domain)
+
+	// Fast path for the common case of an ASCII host
+	if isASCII(domain) {
+		return strings.TrimRight(strings.ToLower(domain), ".")
+	}
+
+	// Wildcards and underscores in patterns are reported as errors, but are
+	// kept in the otherwise converted result
+	if ascii, _ := idna.Lookup.ToASCII(domain); ascii != "" {
+		domain = ascii
+	}
+	return strings.TrimRight(strings.ToLower(domain), ".")
+}
+
+// isASCII reports whether s contains only ASCII characters
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
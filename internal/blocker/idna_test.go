@@ -0,0 +1,71 @@
+package blocker
+
+import (
+	"testing"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		domain   string
+		expected string
+	}{
+		{"facebook.com", "facebook.com"},
+		{"Facebook.COM", "facebook.com"},
+		{"facebook.com.", "facebook.com"},
+		{" facebook.com.. ", "facebook.com"},
+		{"bücher.de", "xn--bcher-kva.de"},
+		{"BÜCHER.de", "xn--bcher-kva.de"},
+		{"www.münchen.de", "www.xn--mnchen-3ya.de"},
+		{"日本語.jp", "xn--wgv71a119e.jp"},
+		{"例え。テスト", "xn--r8jz45g.xn--zckzah"},
+		{"ｆａｃｅｂｏｏｋ．ｃｏｍ", "facebook.com"},
+		{"bücher｡de", "xn--bcher-kva.de"},
+		{"xn--bcher-kva.de", "xn--bcher-kva.de"},
+		{"*.bücher.de", "*.xn--bcher-kva.de"},
+		{"bu\u0308cher.de", "xn--bcher-kva.de"},
+		{"BU\u0308CHER.de", "xn--bcher-kva.de"},
+		{"e\u0301cole.fr", "xn--cole-9oa.fr"},
+		{"z\u030Cluc\u030Cnik.cz", "xn--lunik-iya20f.cz"},
+		{"x\u0308.de", "xn--2jg.de"},
+		{"o\u0328\u0301.pl", "xn--nka07c.pl"},
+		{"пример.рф", "xn--e1afmkfd.xn--p1ai"},
+		{"ΕΛΛΆΔΑ.gr", "xn--hxakic4aa.gr"},
+		{"ελλα\u0301δα.gr", "xn--hxakic4aa.gr"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizeDomain(tt.domain); got != tt.expected {
+			t.Errorf("NormalizeDomain(%q) = %q, want %q", tt.domain, got, tt.expected)
+		}
+	}
+}
+
+func TestIDNAndTrailingDots(t *testing.T) {
+	b := New()
+	b.Apply(Ruleset{
+		Blacklist: []string{"bücher.de", "facebook.com", "*.例え.jp"},
+		Whitelist: []string{"shop.xn--bcher-kva.de"},
+	})
+
+	tests := []struct {
+		host     string
+		expected bool
+	}{
+		{"xn--bcher-kva.de", true},
+		{"www.xn--bcher-kva.de:443", true},
+		{"bücher.de", true},
+		{"shop.bücher.de", false},
+		{"facebook.com.", true},
+		{"www.facebook.com.:443", true},
+		{"ｆａｃｅｂｏｏｋ．ｃｏｍ", true},
+		{"www.xn--r8jz45g.jp", true},
+		{"xn--r8jz45g.jp", false},
+		{"buecher.de", false},
+	}
+
+	for _, tt := range tests {
+		if result := b.IsBlocked(tt.host); result != tt.expected {
+			t.Errorf("IsBlocked(%q) = %v, want %v", tt.host, result, tt.expected)
+		}
+	}
+}
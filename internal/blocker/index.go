@@ -0,0 +1,224 @@
+package blocker
+
+import (
+	"strings"
+)
+
+// index is a compiled set of matchers that finds the first matching one
+// without scanning every matcher.
+//
+// Exact ("example.com") and prefix wildcard ("*.example.com") patterns are
+// stored in a trie keyed by reversed domain labels, so a lookup only walks the
+// labels of the domain. Suffix ("google.*") and double ("*.google.*") wildcards
+// are keyed by the first label of their fixed part and checked for each label
+// of the domain. Path rules and anything else are scanned linearly.
+//
+// match returns the same matcher as a linear scan over the matchers in order.
+type index struct {
+	matchers []Matcher
+	root     *trieNode
+	labels   map[string][]int // Suffix and double wildcards by first label
+	linear   []int            // Matchers that cannot be indexed
+	requests []int            // Matchers that need the whole request
+}
+
+// trieNode is a node of the reversed-label trie
+type trieNode struct {
+	children map[string]*trieNode
+	exact    int // First ExactMatcher ending at this node, -1 if none
+	wildcard int // First PrefixWildcardMatcher ending at this node, -1 if none
+}
+
+// newTrieNode creates an empty trie node
+func newTrieNode() *trieNode {
+	return &trieNode{exact: -1, wildcard: -1}
+}
+
+// compile builds an index for all non-empty patterns
+func compile(patterns []string) *index {
+	return newIndex(createMatchers(patterns))
+}
+
+// newIndex builds an index for the given matchers
+func newIndex(matchers []Matcher) *index {
+	ix := &index{
+		matchers: matchers,
+		root:     newTrieNode(),
+		labels:   make(map[string][]int),
+	}
+
+	for i, m := range matchers {
+		switch m := m.(type) {
+		case *ExactMatcher:
+			node := ix.insert(m.domain)
+			if node.exact == -1 {
+				node.exact = i
+			}
+		case *PrefixWildcardMatcher:
+			// suffix is ".example.com"
+			node := ix.insert(m.suffix[1:])
+			if node.wildcard == -1 {
+				node.wildcard = i
+			}
+		case *SuffixWildcardMatcher:
+			if m.prefix == "" {
+				continue // Never matches
+			}
+			ix.addLabel(m.prefix, i)
+		case *DoubleWildcardMatcher:
+			if m.middle == "" {
+				continue // Never matches
+			}
+			if len(m.middle) < 2 {
+				ix.linear = append(ix.linear, i)
+				continue
+			}
+			ix.addLabel(m.middle[1:], i)
+		case RequestMatcher:
+			ix.requests = append(ix.requests, i)
+		default:
+			ix.linear = append(ix.linear, i)
+		}
+	}
+
+	return ix
+}
+
+// insert returns the trie node for a domain, creating missing nodes
+func (ix *index) insert(domain string) *trieNode {
+	node := ix.root
+	rest := domain
+	for {
+		label, more := lastLabel(rest)
+		child := node.children[label]
+		if child == nil {
+			if node.children == nil {
+				node.children = make(map[string]*trieNode)
+			}
+			child = newTrieNode()
+			node.children[label] = child
+		}
+		node = child
+
+		if !more {
+			return node
+		}
+		rest = rest[:len(rest)-len(label)-1]
+	}
+}
+
+// addLabel indexes a wildcard matcher by the first label of its fixed part
+func (ix *index) addLabel(fixed string, i int) {
+	label := fixed
+	if idx := strings.IndexByte(fixed, '.'); idx != -1 {
+		label = fixed[:idx]
+	}
+	ix.labels[label] = append(ix.labels[label], i)
+}
+
+// lastLabel returns the last label of a domain and whether more labels precede it
+func lastLabel(domain string) (label string, more bool) {
+	idx := strings.LastIndexByte(domain, '.')
+	if idx == -1 {
+		return domain, false
+	}
+	return domain[idx+1:], true
+}
+
+// match returns the first matcher that matches a request with a normalized
+// host, or nil
+func (ix *index) match(req Request) Matcher {
+	if ix == nil {
+		return nil
+	}
+	domain := req.Host
+
+	best := -1
+	better := func(i int) bool {
+		return i != -1 && (best == -1 || i < best)
+	}
+
+	// Walk the trie from the top-level label down
+	node := ix.root
+	rest := domain
+	for node != nil {
+		label, more := lastLabel(rest)
+		node = node.children[label]
+		if node == nil {
+			break
+		}
+		if better(node.exact) {
+			best = node.exact
+		}
+		if !more {
+			break
+		}
+		if better(node.wildcard) {
+			best = node.wildcard
+		}
+		rest = rest[:len(rest)-len(label)-1]
+	}
+
+	// Wildcards keyed by any label of the domain are candidates
+	if len(ix.labels) > 0 {
+		rest = domain
+		for {
+			label := rest
+			idx := strings.IndexByte(rest, '.')
+			if idx != -1 {
+				label = rest[:idx]
+			}
+			for _, i := range ix.labels[label] {
+				if better(i) && ix.matchers[i].Match(domain) {
+					best = i
+					break
+				}
+			}
+			if idx == -1 {
+				break
+			}
+			rest = rest[idx+1:]
+		}
+	}
+
+	for _, i := range ix.linear {
+		if !better(i) {
+			break
+		}
+		if ix.matchers[i].Match(domain) {
+			best = i
+			break
+		}
+	}
+
+	for _, i := range ix.requests {
+		if !better(i) {
+			break
+		}
+		if ix.matchers[i].(RequestMatcher).MatchRequest(req) {
+			best = i
+			break
+		}
+	}
+
+	if best == -1 {
+		return nil
+	}
+	return ix.matchers[best]
+}
+
+// len returns the number of matchers in the index
+func (ix *index) len() int {
+	if ix == nil {
+		return 0
+	}
+	return len(ix.matchers)
+}
+
+// patterns returns the patterns of all matchers in the index
+func (ix *index) patterns() []string {
+	if ix == nil {
+		return []string{}
+	}
+	return matcherPatterns(ix.matchers)
+}
@@ -0,0 +1,168 @@
+package blocker
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// linearMatch returns the first matching matcher like the original linear scan
+func linearMatch(matchers []Matcher, domain string) Matcher {
+	for _, m := range matchers {
+		if m.Match(domain) {
+			return m
+		}
+	}
+	return nil
+}
+
+func TestIndexMatchesLinearScan(t *testing.T) {
+	patterns := []string{
+		"facebook.com",
+		"www.facebook.com",
+		"*.tiktok.com",
+		"tiktok.com",
+		"google.*",
+		"*.google.*",
+		"google.co.*",
+		"com",
+		"*.co.uk",
+		"*.*",
+		"*.",
+		".*",
+		"*",
+		"ads.example.net",
+		"*.ads.example.net",
+		"example.*",
+	}
+	domains := []string{
+		"facebook.com",
+		"www.facebook.com",
+		"m.facebook.com",
+		"facebook.de",
+		"tiktok.com",
+		"vm.tiktok.com",
+		"google.com",
+		"www.google.de",
+		"google.co.uk",
+		"mail.google.co.uk",
+		"google",
+		"notgoogle.com",
+		"bbc.co.uk",
+		"co.uk",
+		"example.net",
+		"ads.example.net",
+		"x.ads.example.net",
+		"localhost",
+		"facebook.com.",
+		"a..b",
+		"",
+	}
+
+	// Every prefix of the pattern list, so earlier patterns win like in the linear scan
+	for n := 0; n <= len(patterns); n++ {
+		matchers := createMatchers(patterns[:n])
+		ix := newIndex(matchers)
+		for _, domain := range domains {
+			want := linearMatch(matchers, domain)
+			got := ix.match(Request{Host: domain})
+			if got != want {
+				t.Errorf("%d patterns: match(%q) = %v, want %v", n, domain, patternOf(got), patternOf(want))
+			}
+		}
+	}
+}
+
+func TestIndexRandomized(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	labels := []string{"a", "b", "c", "com", "de", "google", "co"}
+
+	randomDomain := func() string {
+		domain := labels[rng.Intn(len(labels))]
+		for n := rng.Intn(4); n > 0; n-- {
+			domain = labels[rng.Intn(len(labels))] + "." + domain
+		}
+		return domain
+	}
+
+	for round := 0; round < 200; round++ {
+		var patterns []string
+		for n := rng.Intn(20); n > 0; n-- {
+			pattern := randomDomain()
+			switch rng.Intn(4) {
+			case 1:
+				pattern = "*." + pattern
+			case 2:
+				pattern = pattern + ".*"
+			case 3:
+				pattern = "*." + pattern + ".*"
+			}
+			patterns = append(patterns, pattern)
+		}
+
+		matchers := createMatchers(patterns)
+		ix := newIndex(matchers)
+		for i := 0; i < 50; i++ {
+			domain := randomDomain()
+			want := linearMatch(matchers, domain)
+			if got := ix.match(Request{Host: domain}); got != want {
+				t.Fatalf("patterns %v: match(%q) = %v, want %v", patterns, domain, patternOf(got), patternOf(want))
+			}
+		}
+	}
+}
+
+// patternOf returns the pattern of a matcher, or "<nil>"
+func patternOf(m Matcher) string {
+	if m == nil {
+		return "<nil>"
+	}
+	return m.Pattern()
+}
+
+// benchmarkPatterns returns n synthetic patterns shaped like a public blocklist
+func benchmarkPatterns(n int) []string {
+	patterns := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		switch i % 20 {
+		case 0:
+			patterns = append(patterns, "*.tracker"+strconv.Itoa(i)+".net")
+		case 1:
+			patterns = append(patterns, "brand"+strconv.Itoa(i)+".*")
+		default:
+			patterns = append(patterns, "ads"+strconv.Itoa(i)+".example"+strconv.Itoa(i%500)+".com")
+		}
+	}
+	return patterns
+}
+
+var benchmarkDomains = []string{
+	"www.allowed-site.org",
+	"cdn.ads99998.example498.com",
+	"static.assets.tracker99980.net",
+	"www.brand99981.de",
+}
+
+func BenchmarkLinearScan100k(b *testing.B) {
+	matchers := createMatchers(benchmarkPatterns(100000))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		linearMatch(matchers, benchmarkDomains[i%len(benchmarkDomains)])
+	}
+}
+
+func BenchmarkIndex100k(b *testing.B) {
+	ix := compile(benchmarkPatterns(100000))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ix.match(Request{Host: benchmarkDomains[i%len(benchmarkDomains)]})
+	}
+}
+
+func BenchmarkCompile100k(b *testing.B) {
+	patterns := benchmarkPatterns(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		compile(patterns)
+	}
+}
@@ -0,0 +1,130 @@
+package blocker
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// IPPrefix marks a pattern as an IP address or CIDR range, e.g. ip:10.0.0.0/8
+const IPPrefix = "ip:"
+
+// CIDRMatcher matches IP literal hosts inside a CIDR range like "ip:10.0.0.0/8"
+// or "ip:2001:db8::/32". A single address like "ip:1.2.3.4" matches only itself.
+type CIDRMatcher struct {
+	pattern string
+	prefix  netip.Prefix // Invalid if the pattern does not parse
+}
+
+// NewCIDRMatcher creates a new CIDR matcher
+func NewCIDRMatcher(pattern string) *CIDRMatcher {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	prefix, _ := parsePrefix(strings.TrimPrefix(pattern, IPPrefix))
+
+	return &CIDRMatcher{
+		pattern: pattern,
+		prefix:  prefix,
+	}
+}
+
+// parsePrefix parses a CIDR range or a single address
+func parsePrefix(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return prefix.Masked(), nil
+}
+
+// Match checks if the host is an IP address inside the range.
+// Domain names never match; see MatchAddr for resolved addresses.
+func (m *CIDRMatcher) Match(domain string) bool {
+	addr, ok := parseIP(domain)
+	if !ok {
+		return false
+	}
+	return m.MatchAddr(addr)
+}
+
+// MatchAddr checks if an address is inside the range
+func (m *CIDRMatcher) MatchAddr(addr netip.Addr) bool {
+	return m.prefix.IsValid() && m.prefix.Contains(addr.Unmap())
+}
+
+// MatchRequest checks if the host or one of its resolved addresses is inside the range
+func (m *CIDRMatcher) MatchRequest(req Request) bool {
+	return m.Match(req.Host) || m.matchedAddr(req.Addrs).IsValid()
+}
+
+// matchedAddr returns the first address inside the range, or the zero Addr
+func (m *CIDRMatcher) matchedAddr(addrs []netip.Addr) netip.Addr {
+	for _, addr := range addrs {
+		if m.MatchAddr(addr) {
+			return addr
+		}
+	}
+	return netip.Addr{}
+}
+
+// Pattern returns the original pattern
+func (m *CIDRMatcher) Pattern() string {
+	return m.pattern
+}
+
+// resolvedIP returns the resolved address that made an "ip:" rule match,
+// or "" if the rule matched the host itself
+func resolvedIP(m Matcher, req Request) string {
+	cm, ok := m.(*CIDRMatcher)
+	if !ok || cm.Match(req.Host) {
+		return ""
+	}
+	if addr := cm.matchedAddr(req.Addrs); addr.IsValid() {
+		return addr.String()
+	}
+	return ""
+}
+
+// parseIP parses an IP literal host, with or without brackets and zone
+func parseIP(host string) (netip.Addr, bool) {
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.WithZone("").Unmap(), true
+}
+
+// isIPLiteral reports whether a host is an IP address rather than a domain name
+func isIPLiteral(host string) bool {
+	_, ok := parseIP(host)
+	return ok
+}
+
+// SplitHostPort splits "host:port", "[::1]:443", "::1" or "host" into
+// host and port. IPv6 brackets are removed from the host.
+func SplitHostPort(hostport string) (host, port string) {
+	hostport = strings.TrimSpace(hostport)
+	if h, p, err := net.SplitHostPort(hostport); err == nil {
+		return h, p
+	}
+
+	// No port, or a bare IPv6 address like "::1"
+	return strings.TrimSuffix(strings.TrimPrefix(hostport, "["), "]"), ""
+}
+
+// validateIPPattern checks the address or range of an "ip:" pattern
+func validateIPPattern(pattern string) error {
+	if _, err := parsePrefix(strings.TrimPrefix(pattern, IPPrefix)); err != nil {
+		return &PatternError{Pattern: pattern, Reason: "invalid IP address or CIDR range"}
+	}
+	return nil
+}
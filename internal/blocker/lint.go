@@ -0,0 +1,254 @@
+package blocker
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Kinds of problems Lint reports
+const (
+	IssueInvalid    = "invalid"    // The pattern does not parse
+	IssueDuplicate  = "duplicate"  // Another pattern is the same after normalization
+	IssueShadowed   = "shadowed"   // Another pattern already matches everything this one does
+	IssueBroad      = "broad"      // The pattern matches whole top-level domains or more
+	IssueSuspicious = "suspicious" // The pattern likely matches more than intended
+)
+
+// Issue is a problem Lint found with a pattern
+type Issue struct {
+	Pattern string `json:"pattern"`
+	Kind    string `json:"kind"`
+	By      string `json:"by,omitempty"` // Pattern that duplicates or shadows this one
+	Message string `json:"message"`
+}
+
+// String returns the issue as `"pattern": message`
+func (i Issue) String() string {
+	return strconv.Quote(i.Pattern) + ": " + i.Message
+}
+
+// topLevelLabels are labels that on their own name a public suffix rather
+// than a site, used to spot overly broad patterns like "*.com.*"
+var topLevelLabels = map[string]bool{
+	"com": true, "net": true, "org": true, "edu": true, "gov": true, "mil": true,
+	"int": true, "info": true, "biz": true, "io": true, "co": true, "ac": true,
+	"uk": true, "de": true, "fr": true, "nl": true, "it": true, "es": true,
+	"ru": true, "cn": true, "jp": true, "br": true, "in": true, "au": true,
+	"ca": true, "us": true, "eu": true, "me": true, "tv": true, "app": true,
+	"dev": true, "xyz": true,
+}
+
+// broadRegexProbes are unrelated domains a regular expression matching all
+// of them is considered overly broad for
+var broadRegexProbes = []string{"example.com", "wikipedia.org", "bbc.co.uk", "xn--bcher-kva.de"}
+
+// Lint reports duplicate, shadowed, malformed and overly broad patterns in a
+// pattern list, in list order. Shadowing is detected for domain, path and
+// scoped rules covered by a plain or "*." domain pattern, and for "ip:"
+// ranges inside other ranges.
+func Lint(patterns []string) []Issue {
+	var issues []Issue
+
+	// First occurrence of each normalized pattern, and of the patterns that
+	// can shadow others
+	seen := make(map[string]string, len(patterns))
+	exact := make(map[string]string)
+	wildcard := make(map[string]string)
+	var cidrs []*CIDRMatcher
+
+	var unique []Matcher
+	for _, p := range patterns {
+		if err := ValidatePattern(p); err != nil {
+			issues = append(issues, Issue{Pattern: p, Kind: IssueInvalid, Message: err.(*PatternError).Reason})
+			continue
+		}
+
+		m := CreateMatcher(p)
+		key := m.Pattern()
+		if first, ok := seen[key]; ok {
+			msg := "listed more than once"
+			if first != p {
+				msg = "duplicate of " + strconv.Quote(first)
+			}
+			issues = append(issues, Issue{Pattern: p, Kind: IssueDuplicate, By: first, Message: msg})
+			continue
+		}
+		seen[key] = p
+		unique = append(unique, m)
+
+		switch m := m.(type) {
+		case *ExactMatcher:
+			exact[key] = p
+		case *PrefixWildcardMatcher:
+			wildcard[strings.TrimPrefix(key, "*.")] = p
+		case *CIDRMatcher:
+			cidrs = append(cidrs, m)
+		}
+	}
+
+	for _, m := range unique {
+		p := seen[m.Pattern()]
+
+		if msg := broadness(m); msg != "" {
+			issues = append(issues, Issue{Pattern: p, Kind: IssueBroad, Message: msg})
+		}
+		if msg := suspiciousGlob(m); msg != "" {
+			issues = append(issues, Issue{Pattern: p, Kind: IssueSuspicious, Message: msg})
+		}
+
+		by := ""
+		if cm, ok := m.(*CIDRMatcher); ok {
+			by = cidrShadow(cm, cidrs, seen)
+		} else {
+			by = domainShadow(m, exact, wildcard)
+		}
+		if by != "" {
+			issues = append(issues, Issue{Pattern: p, Kind: IssueShadowed, By: by, Message: "already covered by " + strconv.Quote(by)})
+		}
+	}
+
+	return issues
+}
+
+// hostPattern returns the domain pattern a rule applies to, or "" for
+// regular expression and IP rules
+func hostPattern(m Matcher) string {
+	switch m := m.(type) {
+	case *ExactMatcher, *PrefixWildcardMatcher, *GlobMatcher:
+		return m.Pattern()
+	case *PathMatcher:
+		return hostPattern(m.host)
+	case *ScopedMatcher:
+		return hostPattern(m.inner)
+	default:
+		return ""
+	}
+}
+
+// domainShadow returns the plain or "*." domain pattern that already matches
+// every host m matches, or ""
+func domainShadow(m Matcher, exact, wildcard map[string]string) string {
+	self, host := m.Pattern(), hostPattern(m)
+	if host == "" {
+		return ""
+	}
+
+	// The labels right of the last wildcard are the domain every matched
+	// host is, or is a subdomain of
+	labels := strings.Split(host, ".")
+	last := -1
+	for i, label := range labels {
+		if strings.ContainsAny(label, "*?") {
+			last = i
+		}
+	}
+	suffix := strings.Join(labels[last+1:], ".")
+	subdomainsOnly := last != -1
+
+	for d := suffix; d != ""; {
+		if p, ok := exact[d]; ok && d != self {
+			return p
+		}
+		if p, ok := wildcard[d]; ok && (d != suffix || subdomainsOnly) && "*."+d != self {
+			return p
+		}
+
+		idx := strings.IndexByte(d, '.')
+		if idx == -1 {
+			break
+		}
+		d = d[idx+1:]
+	}
+	return ""
+}
+
+// cidrShadow returns the "ip:" range that already contains m: a wider one,
+// or the same range listed earlier. It returns "" if there is none.
+func cidrShadow(m *CIDRMatcher, cidrs []*CIDRMatcher, seen map[string]string) string {
+	if !m.prefix.IsValid() {
+		return ""
+	}
+
+	pos := 0
+	for i, other := range cidrs {
+		if other == m {
+			pos = i
+		}
+	}
+
+	for i, other := range cidrs {
+		if other == m || !other.prefix.IsValid() {
+			continue
+		}
+		wider := other.prefix.Bits() < m.prefix.Bits() || (other.prefix == m.prefix && i < pos)
+		if wider && other.prefix.Contains(m.prefix.Addr()) {
+			return seen[other.Pattern()]
+		}
+	}
+	return ""
+}
+
+// broadness explains why a pattern matches far more than one site, or
+// returns "" if it does not
+func broadness(m Matcher) string {
+	switch m := m.(type) {
+	case *RegexMatcher:
+		for _, probe := range broadRegexProbes {
+			if !m.Match(probe) {
+				return ""
+			}
+		}
+		return "matches unrelated domains like " + strings.Join(broadRegexProbes[:2], " and ")
+	case *CIDRMatcher:
+		if !m.prefix.IsValid() {
+			return ""
+		}
+		if (m.prefix.Addr().Is4() && m.prefix.Bits() < 8) || (m.prefix.Addr().Is6() && m.prefix.Bits() < 16) {
+			return "covers a large part of the address space"
+		}
+		return ""
+	case *ExactMatcher, *PrefixWildcardMatcher, *SuffixWildcardMatcher, *DoubleWildcardMatcher, *GlobMatcher:
+	default:
+		return ""
+	}
+
+	specific := false
+	literal := 0
+	for _, label := range strings.Split(m.Pattern(), ".") {
+		if strings.Trim(label, "*?") == "" {
+			continue
+		}
+		literal++
+		if !topLevelLabels[label] {
+			specific = true
+		}
+	}
+
+	switch {
+	case literal == 0:
+		return "matches every domain"
+	case !specific:
+		return "matches whole top-level domains"
+	default:
+		return ""
+	}
+}
+
+// suspiciousGlob explains why a glob like "*example.com", which also matches
+// "myexample.com", was likely meant as "*.example.com", or returns ""
+func suspiciousGlob(m Matcher) string {
+	g, ok := m.(*GlobMatcher)
+	if !ok || len(g.labels) < 2 {
+		return ""
+	}
+
+	first := g.labels[0]
+	rest := strings.TrimLeft(first, "*")
+	if rest == first || rest == "" || strings.ContainsAny(rest, "*?") {
+		return ""
+	}
+
+	domain := rest + "." + strings.Join(g.labels[1:], ".")
+	return "also matches unrelated domains like " + strconv.Quote("my"+domain) +
+		"; use " + strconv.Quote("*."+domain) + " or " + strconv.Quote(domain)
+}
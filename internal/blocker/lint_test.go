@@ -0,0 +1,62 @@
+package blocker
+
+import "testing"
+
+func TestLint(t *testing.T) {
+	patterns := []string{
+		"facebook.com",
+		"www.facebook.com", // shadowed by facebook.com
+		"tiktok.com",
+		"*.tiktok.com", // shadowed by tiktok.com
+		"*.reddit.com",
+		"old.reddit.com",       // shadowed by *.reddit.com
+		"Facebook.com",         // duplicate
+		"tiktok.com",           // duplicate
+		"*.",                   // invalid
+		"*example.com",         // suspicious
+		"*.com.*",              // broad
+		"re:.*",                // broad
+		"facebook.com/groups/", // shadowed by facebook.com
+		"ip:10.0.0.0/8",
+		"ip:10.1.2.3",   // shadowed by ip:10.0.0.0/8
+		"ip:10.0.0.0/8", // duplicate
+		"google.*",
+		"example.org:8443",
+	}
+
+	type issue struct {
+		pattern, kind, by string
+	}
+	want := []issue{
+		{"Facebook.com", IssueDuplicate, "facebook.com"},
+		{"tiktok.com", IssueDuplicate, "tiktok.com"},
+		{"*.", IssueInvalid, ""},
+		{"ip:10.0.0.0/8", IssueDuplicate, "ip:10.0.0.0/8"},
+		{"www.facebook.com", IssueShadowed, "facebook.com"},
+		{"*.tiktok.com", IssueShadowed, "tiktok.com"},
+		{"old.reddit.com", IssueShadowed, "*.reddit.com"},
+		{"*example.com", IssueSuspicious, ""},
+		{"*.com.*", IssueBroad, ""},
+		{"re:.*", IssueBroad, ""},
+		{"facebook.com/groups/", IssueShadowed, "facebook.com"},
+		{"ip:10.1.2.3", IssueShadowed, "ip:10.0.0.0/8"},
+	}
+
+	got := Lint(patterns)
+	if len(got) != len(want) {
+		t.Fatalf("Lint() returned %d issues, want %d: %v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Pattern != w.pattern || g.Kind != w.kind || g.By != w.by {
+			t.Errorf("issue %d = {%q %s %q}, want {%q %s %q}", i, g.Pattern, g.Kind, g.By, w.pattern, w.kind, w.by)
+		}
+	}
+}
+
+func TestLintClean(t *testing.T) {
+	patterns := []string{"facebook.com", "*.reddit.com", "reddit.org", "google.*", "*cdn*.example.com", "ip:192.168.0.0/16"}
+	if issues := Lint(patterns); len(issues) != 0 {
+		t.Errorf("Lint() = %v, want no issues", issues)
+	}
+}
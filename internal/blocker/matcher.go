@@ -1,9 +1,14 @@
 package blocker
 
 import (
+	"regexp"
+	"strconv"
 	"strings"
 )
 
+// RegexPrefix marks a pattern as a regular expression, e.g. re:^ads?[0-9]*\.
+const RegexPrefix = "re:"
+
 // Matcher defines the interface for domain matching
 type Matcher interface {
 	Match(domain string) bool
@@ -180,10 +185,221 @@ func (m *DoubleWildcardMatcher) Pattern() string {
 	return m.pattern
 }
 
+// RegexMatcher matches domains against a regular expression like re:^ads?[0-9]*\.
+type RegexMatcher struct {
+	pattern string
+	re      *regexp.Regexp // nil if the expression does not compile
+}
+
+// NewRegexMatcher creates a new regular expression matcher.
+// The expression is matched against the lowercased domain; anchor it with
+// ^ and $ to match the whole domain.
+func NewRegexMatcher(pattern string) *RegexMatcher {
+	pattern = strings.TrimSpace(pattern)
+	re, _ := regexp.Compile(strings.TrimPrefix(pattern, RegexPrefix))
+
+	return &RegexMatcher{
+		pattern: pattern,
+		re:      re,
+	}
+}
+
+// Match checks if the given domain matches the regular expression
+func (m *RegexMatcher) Match(domain string) bool {
+	if m.re == nil {
+		return false
+	}
+	return m.re.MatchString(strings.ToLower(strings.TrimSpace(domain)))
+}
+
+// Pattern returns the original pattern
+func (m *RegexMatcher) Pattern() string {
+	return m.pattern
+}
+
+// GlobMatcher matches domains with "*" and "?" inside labels like "*cdn*.example.com".
+// "*" matches any run of characters and "?" a single character, but neither
+// crosses a dot. Like ExactMatcher, subdomains of a matching domain match too.
+type GlobMatcher struct {
+	pattern string
+	labels  []string
+}
+
+// NewGlobMatcher creates a new glob matcher
+func NewGlobMatcher(pattern string) *GlobMatcher {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+
+	return &GlobMatcher{
+		pattern: pattern,
+		labels:  strings.Split(pattern, "."),
+	}
+}
+
+// Match checks if the given domain or one of its parent domains matches the glob
+func (m *GlobMatcher) Match(domain string) bool {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+
+	labels := strings.Split(domain, ".")
+	if len(labels) < len(m.labels) {
+		return false
+	}
+
+	// Compare the rightmost labels, so "*cdn*.example.com" also matches "a.cdn1.example.com"
+	labels = labels[len(labels)-len(m.labels):]
+	for i, label := range labels {
+		if !matchLabel(m.labels[i], label) {
+			return false
+		}
+	}
+	return true
+}
+
+// Pattern returns the original pattern
+func (m *GlobMatcher) Pattern() string {
+	return m.pattern
+}
+
+// matchLabel reports whether a label matches a glob with "*" and "?"
+func matchLabel(glob, label string) bool {
+	// Position to resume from after the last "*", for backtracking
+	star, resume := -1, 0
+
+	g, l := 0, 0
+	for l < len(label) {
+		switch {
+		case g < len(glob) && (glob[g] == '?' || glob[g] == label[l]):
+			g++
+			l++
+		case g < len(glob) && glob[g] == '*':
+			star, resume = g, l
+			g++
+		case star != -1:
+			// Let the last "*" consume one more character
+			resume++
+			g, l = star+1, resume
+		default:
+			return false
+		}
+	}
+
+	for g < len(glob) && glob[g] == '*' {
+		g++
+	}
+	return g == len(glob)
+}
+
+// isGlob reports whether a pattern has wildcards other than a leading "*."
+// and a trailing ".*", which the other matchers handle
+func isGlob(pattern string) bool {
+	inner := strings.TrimPrefix(pattern, "*.")
+	inner = strings.TrimSuffix(inner, ".*")
+	return strings.ContainsAny(inner, "*?")
+}
+
+// PatternError describes why a pattern is invalid
+type PatternError struct {
+	Pattern string
+	Reason  string
+}
+
+// Error returns the error message naming the pattern
+func (e *PatternError) Error() string {
+	return "invalid pattern " + strconv.Quote(e.Pattern) + ": " + e.Reason
+}
+
+// ValidatePattern checks that a pattern is well-formed and returns an error
+// naming the pattern if not
+func ValidatePattern(pattern string) error {
+	pattern = strings.TrimSpace(pattern)
+	if pattern == "" {
+		return &PatternError{Pattern: pattern, Reason: "empty pattern"}
+	}
+
+	if strings.HasPrefix(pattern, RegexPrefix) {
+		expr := strings.TrimPrefix(pattern, RegexPrefix)
+		if expr == "" {
+			return &PatternError{Pattern: pattern, Reason: "empty regular expression"}
+		}
+		if _, err := regexp.Compile(expr); err != nil {
+			return &PatternError{Pattern: pattern, Reason: err.Error()}
+		}
+		return nil
+	}
+
+	if isScopedPattern(pattern) {
+		return validateScopedPattern(pattern)
+	}
+
+	if strings.HasPrefix(pattern, IPPrefix) {
+		return validateIPPattern(pattern)
+	}
+
+	if isPathPattern(pattern) {
+		return validatePathPattern(pattern)
+	}
+
+	if strings.HasSuffix(pattern, "*.") {
+		return &PatternError{Pattern: pattern, Reason: "wildcard without a domain"}
+	}
+
+	for _, label := range strings.Split(NormalizeDomain(pattern), ".") {
+		if label == "" {
+			return &PatternError{Pattern: pattern, Reason: "empty label"}
+		}
+		for _, r := range label {
+			if !validPatternRune(r) {
+				return &PatternError{Pattern: pattern, Reason: "unexpected character " + strconv.QuoteRune(r)}
+			}
+		}
+	}
+
+	return nil
+}
+
+// validPatternRune reports whether r may appear in a domain pattern
+func validPatternRune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return true
+	case r == '-', r == '_', r == '*', r == '?':
+		return true
+	default:
+		return false
+	}
+}
+
 // CreateMatcher creates the appropriate matcher for a pattern
 func CreateMatcher(pattern string) Matcher {
 	pattern = strings.TrimSpace(pattern)
 
+	// Regular expression: re:^ads?[0-9]*\.
+	if strings.HasPrefix(pattern, RegexPrefix) {
+		return NewRegexMatcher(pattern)
+	}
+
+	// Scheme or port scoped: http://example.com, example.com:8443
+	if isScopedPattern(pattern) {
+		return NewScopedMatcher(pattern)
+	}
+
+	// IP address or range: ip:10.0.0.0/8, ip:2001:db8::/32
+	if strings.HasPrefix(pattern, IPPrefix) {
+		return NewCIDRMatcher(pattern)
+	}
+
+	// Path rule: example.com/games/, POST example.com/upload
+	if isPathPattern(pattern) {
+		return NewPathMatcher(pattern)
+	}
+
+	// Domain patterns match the normalized ASCII form of hosts
+	pattern = NormalizeDomain(pattern)
+
+	// Glob: *cdn*.example.com, ad?.example.com
+	if isGlob(pattern) {
+		return NewGlobMatcher(pattern)
+	}
+
 	hasPrefix := strings.HasPrefix(pattern, "*.")
 	hasSuffix := strings.HasSuffix(pattern, ".*")
 
@@ -96,6 +96,228 @@ func TestPrefixWildcardMatcher(t *testing.T) {
 	}
 }
 
+func TestRegexMatcher(t *testing.T) {
+	matcher := NewRegexMatcher(`re:^ads?[0-9]*\.`)
+
+	tests := []struct {
+		domain   string
+		expected bool
+	}{
+		{"ad.example.com", true},
+		{"ads.example.com", true},
+		{"ads42.example.com", true},
+		{"ADS1.Example.com", true},
+		{"ads", false},
+		{"bads.example.com", false},
+		{"www.ads.example.com", false},
+	}
+
+	for _, tt := range tests {
+		result := matcher.Match(tt.domain)
+		if result != tt.expected {
+			t.Errorf("Match(%q) = %v, want %v", tt.domain, result, tt.expected)
+		}
+	}
+}
+
+func TestGlobMatcher(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		domain   string
+		expected bool
+	}{
+		{"*cdn*.example.com", "cdn.example.com", true},
+		{"*cdn*.example.com", "static-cdn1.example.com", true},
+		{"*cdn*.example.com", "a.cdn1.example.com", true}, // Subdomain of a match
+		{"*cdn*.example.com", "example.com", false},
+		{"*cdn*.example.com", "cdn.example.org", false},
+		{"*cdn*.example.com", "cdn.evil.example.com.org", false},
+		{"ad?.example.com", "ad1.example.com", true},
+		{"ad?.example.com", "ad.example.com", false},
+		{"ad?.example.com", "ad12.example.com", false},
+		{"*.cdn*.example.com", "x.cdn2.example.com", true},
+		{"*.cdn*.example.com", "cdn2.example.com", false},
+		{"a*b*c.com", "aXbYbZc.com", true},
+		{"a*b*c.com", "aXbYc.com.evil", false},
+		{"*example.com", "myexample.com", true},
+		{"*example.com", "example.com", true},
+		{"*example.com", "example.org", false},
+	}
+
+	for _, tt := range tests {
+		result := NewGlobMatcher(tt.pattern).Match(tt.domain)
+		if result != tt.expected {
+			t.Errorf("%s: Match(%q) = %v, want %v", tt.pattern, tt.domain, result, tt.expected)
+		}
+	}
+}
+
+func TestPathMatcher(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		req      Request
+		expected bool
+	}{
+		{"example.com/games/", Request{Host: "example.com", Method: "GET", Path: "/games/chess"}, true},
+		{"example.com/games/", Request{Host: "www.example.com", Method: "GET", Path: "/games/"}, true},
+		{"example.com/games/", Request{Host: "example.com", Method: "GET", Path: "/news/"}, false},
+		{"example.com/games/", Request{Host: "example.com", Method: "GET", Path: "/games"}, true},
+		{"example.com/games/", Request{Host: "example.com", Method: "GET", Path: "/games?page=2"}, true},
+		{"example.com/games/", Request{Host: "example.com", Method: "GET", Path: "/gameshow"}, false},
+		{"example.com/game", Request{Host: "example.com", Method: "GET", Path: "/game/1"}, true},
+		{"example.com/game", Request{Host: "example.com", Method: "GET", Path: "/gameshow"}, false},
+		{"example.com/", Request{Host: "example.com", Method: "GET", Path: "/anything"}, true},
+		{"example.com/games/", Request{Host: "example.com", Method: "CONNECT"}, false},
+		{"example.com/games/", Request{Host: "example.org", Method: "GET", Path: "/games/"}, false},
+		{"POST example.com/upload", Request{Host: "example.com", Method: "POST", Path: "/upload/1"}, true},
+		{"POST example.com/upload", Request{Host: "example.com", Method: "GET", Path: "/upload/1"}, false},
+		{"example.com/*.mp4", Request{Host: "example.com", Method: "GET", Path: "/v/clip.mp4"}, true},
+		{"example.com/*.mp4", Request{Host: "example.com", Method: "GET", Path: "/v/clip.webm"}, false},
+		{"example.com/search?q=*cats", Request{Host: "example.com", Method: "GET", Path: "/search?q=funny+cats"}, true},
+		{"example.com/search?q=cats", Request{Host: "example.com", Method: "GET", Path: "/search?q=cats&page=2"}, true},
+	}
+
+	for _, tt := range tests {
+		m := NewPathMatcher(tt.pattern)
+		if result := m.MatchRequest(tt.req); result != tt.expected {
+			t.Errorf("%s: MatchRequest(%+v) = %v, want %v", tt.pattern, tt.req, result, tt.expected)
+		}
+		if m.Match(tt.req.Host) {
+			t.Errorf("%s: Match(%q) = true, want false for a bare host", tt.pattern, tt.req.Host)
+		}
+	}
+}
+
+func TestCIDRMatcher(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		host     string
+		expected bool
+	}{
+		{"ip:10.0.0.0/8", "10.1.2.3", true},
+		{"ip:10.0.0.0/8", "11.1.2.3", false},
+		{"ip:10.0.0.0/8", "::ffff:10.1.2.3", true}, // IPv4-mapped
+		{"ip:10.0.0.0/8", "10.example.com", false},
+		{"ip:1.2.3.4", "1.2.3.4", true},
+		{"ip:1.2.3.4", "1.2.3.5", false},
+		{"ip:2001:db8::/32", "2001:db8::1", true},
+		{"ip:2001:db8::/32", "[2001:db8::1]", true},
+		{"ip:2001:db8::/32", "2001:db9::1", false},
+		{"ip:::1", "::1", true},
+	}
+
+	for _, tt := range tests {
+		result := NewCIDRMatcher(tt.pattern).Match(tt.host)
+		if result != tt.expected {
+			t.Errorf("%s: Match(%q) = %v, want %v", tt.pattern, tt.host, result, tt.expected)
+		}
+	}
+}
+
+func TestScopedMatcher(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		req      Request
+		expected bool
+	}{
+		{"example.com:8443", Request{Host: "example.com", Port: "8443", Method: "CONNECT"}, true},
+		{"example.com:8443", Request{Host: "admin.example.com", Port: "8443", Method: "GET", Path: "/"}, true},
+		{"example.com:8443", Request{Host: "example.com", Port: "443", Method: "CONNECT"}, false},
+		{"example.com:80,8080", Request{Host: "example.com", Port: "8080", Method: "GET", Path: "/"}, true},
+		{"http://example.com", Request{Host: "example.com", Port: "80", Method: "GET", Path: "/"}, true},
+		{"http://example.com", Request{Host: "example.com", Port: "443", Method: "CONNECT"}, false},
+		{"https://example.com", Request{Host: "example.com", Port: "443", Method: "CONNECT"}, true},
+		{"https://example.com", Request{Host: "example.com", Port: "80", Method: "GET", Path: "/"}, false},
+		{"http://example.com:8080/admin/", Request{Host: "example.com", Port: "8080", Method: "GET", Path: "/admin/x"}, true},
+		{"http://example.com:8080/admin/", Request{Host: "example.com", Port: "8080", Method: "GET", Path: "/"}, false},
+		{"https://ip:10.0.0.0/8", Request{Host: "10.0.0.1", Port: "443", Method: "CONNECT"}, true},
+	}
+
+	for _, tt := range tests {
+		result := NewScopedMatcher(tt.pattern).MatchRequest(tt.req)
+		if result != tt.expected {
+			t.Errorf("%s: MatchRequest(%+v) = %v, want %v", tt.pattern, tt.req, result, tt.expected)
+		}
+	}
+}
+
+func TestSplitHostPort(t *testing.T) {
+	tests := []struct {
+		hostport string
+		host     string
+		port     string
+	}{
+		{"example.com", "example.com", ""},
+		{"example.com:443", "example.com", "443"},
+		{"1.2.3.4:80", "1.2.3.4", "80"},
+		{"[::1]:443", "::1", "443"},
+		{"[2001:db8::1]", "2001:db8::1", ""},
+		{"::1", "::1", ""},
+		{"2001:db8::1", "2001:db8::1", ""},
+	}
+
+	for _, tt := range tests {
+		host, port := SplitHostPort(tt.hostport)
+		if host != tt.host || port != tt.port {
+			t.Errorf("SplitHostPort(%q) = %q, %q, want %q, %q", tt.hostport, host, port, tt.host, tt.port)
+		}
+	}
+}
+
+func TestValidatePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"facebook.com", true},
+		{"*.tiktok.com", true},
+		{"google.*", true},
+		{"*.google.*", true},
+		{"*cdn*.example.com", true},
+		{"ad?.example.com", true},
+		{`re:^ads?[0-9]*\.`, true},
+		{"", false},
+		{"re:", false},
+		{"re:ads(", false},
+		{"*.", false},
+		{"example..com", false},
+		{".example.com", false},
+		{"exa mple.com", false},
+		{"example.com/games/", true},
+		{"POST example.com/upload", true},
+		{"*.example.com/search?q=*", true},
+		{"FETCH example.com/", false},
+		{"GET example.com", false},
+		{"re:ads/x", true},
+		{"example..com/games/", false},
+		{"ip:10.0.0.0/8", true},
+		{"ip:2001:db8::/32", true},
+		{"ip:1.2.3.4", true},
+		{"ip:10.0.0.0/33", false},
+		{"ip:example.com", false},
+		{"facebook.com.", true},
+		{"bücher.de", true},
+		{"*.例え.jp", true},
+		{"example.com:8443", true},
+		{"example.com:80,8080", true},
+		{"http://example.com", true},
+		{"https://*.example.com:8443", true},
+		{"http://example.com/games/", true},
+		{"example.com:0", false},
+		{"example.com:http", false},
+		{"example.com:", false},
+		{"ftp://example.com", false},
+		{"http://", false},
+	}
+
+	for _, tt := range tests {
+		err := ValidatePattern(tt.pattern)
+		if (err == nil) != tt.valid {
+			t.Errorf("ValidatePattern(%q) = %v, want valid %v", tt.pattern, err, tt.valid)
+		}
+	}
+}
+
 func TestCreateMatcher(t *testing.T) {
 	tests := []struct {
 		pattern      string
@@ -105,6 +327,14 @@ func TestCreateMatcher(t *testing.T) {
 		{"*.example.com", "*blocker.PrefixWildcardMatcher"},
 		{"google.*", "*blocker.SuffixWildcardMatcher"},
 		{"*.google.*", "*blocker.DoubleWildcardMatcher"},
+		{`re:^ads?[0-9]*\.`, "*blocker.RegexMatcher"},
+		{"*cdn*.example.com", "*blocker.GlobMatcher"},
+		{"ad?.example.com", "*blocker.GlobMatcher"},
+		{"*.cdn*.example.com", "*blocker.GlobMatcher"},
+		{"ip:10.0.0.0/8", "*blocker.CIDRMatcher"},
+		{"ip:2001:db8::/32", "*blocker.CIDRMatcher"},
+		{"example.com:8443", "*blocker.ScopedMatcher"},
+		{"http://example.com", "*blocker.ScopedMatcher"},
 	}
 
 	for _, tt := range tests {
@@ -135,6 +365,14 @@ var fmt = struct {
 				return "*blocker.SuffixWildcardMatcher"
 			case *DoubleWildcardMatcher:
 				return "*blocker.DoubleWildcardMatcher"
+			case *RegexMatcher:
+				return "*blocker.RegexMatcher"
+			case *GlobMatcher:
+				return "*blocker.GlobMatcher"
+			case *CIDRMatcher:
+				return "*blocker.CIDRMatcher"
+			case *ScopedMatcher:
+				return "*blocker.ScopedMatcher"
 			}
 		}
 		return ""
@@ -0,0 +1,210 @@
+package blocker
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// pacRules are the host conditions under which a PAC file sends a request to
+// the proxy. They over-approximate the rule set: the proxy still makes the
+// final decision, so a host sent to it needlessly is only a little slower,
+// while a host sent DIRECT is never checked.
+type pacRules struct {
+	domains []string // Domains that may be blocked along with their subdomains
+	globs   []string // shExpMatch expressions of hosts that may be blocked
+	regexps []string // Regular expressions of hosts that may be blocked
+	ips     bool     // IP literal hosts may be blocked
+	all     bool     // Any host may be blocked, e.g. by its resolved addresses
+}
+
+// unsafeRegexSyntax is RE2 syntax that JavaScript lacks or reads differently.
+// Rules using it cannot be translated, so every host goes to the proxy.
+var unsafeRegexSyntax = []string{"(?", "[:", `\p`, `\P`, `\A`, `\z`, `\Q`, `\C`}
+
+// PAC generates a Proxy Auto-Config script that sends hosts that may be
+// blocked to the proxy at proxyAddr and everything else DIRECT.
+//
+// Whitelists, schedules, snoozes, quota budgets and the active profile are
+// left to the proxy, so the script only changes when the patterns do. Hosts
+// that may be blocked have no DIRECT fallback, so blocking still fails closed
+// when the proxy is down.
+func (b *Blocker) PAC(proxyAddr string) []byte {
+	b.mu.RLock()
+	rules := b.pacRules()
+	b.mu.RUnlock()
+
+	var sb strings.Builder
+	sb.WriteString("// Proxy auto-config generated by Network Blocker from the current rules.\n")
+	sb.WriteString("// Hosts that may be blocked go through the proxy, everything else DIRECT.\n")
+	sb.WriteString("var proxy = " + jsString("PROXY "+proxyAddr) + ";\n")
+	sb.WriteString("var all = " + jsBool(rules.all) + ";\n")
+	sb.WriteString("var ips = " + jsBool(rules.ips) + ";\n")
+
+	sb.WriteString("var domains = {\n")
+	for _, d := range rules.domains {
+		sb.WriteString("  " + jsString(d) + ": true,\n")
+	}
+	sb.WriteString("};\n")
+
+	sb.WriteString("var globs = [\n")
+	for _, g := range rules.globs {
+		sb.WriteString("  " + jsString(g) + ",\n")
+	}
+	sb.WriteString("];\n")
+
+	sb.WriteString(`var regexps = [];
+
+function addRegExp(source) {
+  try {
+    regexps.push(new RegExp(source));
+  } catch (e) {
+    all = true;
+  }
+}
+`)
+	for _, re := range rules.regexps {
+		sb.WriteString("addRegExp(" + jsString(re) + ");\n")
+	}
+
+	sb.WriteString(`
+function FindProxyForURL(url, host) {
+  if (all) {
+    return proxy;
+  }
+
+  host = host.toLowerCase().replace(/\.+$/, "");
+  if (/^[0-9.]+$/.test(host) || host.indexOf(":") != -1) {
+    return ips ? proxy : "DIRECT";
+  }
+
+  for (var d = host; ; d = d.substring(d.indexOf(".") + 1)) {
+    if (Object.prototype.hasOwnProperty.call(domains, d)) {
+      return proxy;
+    }
+    if (d.indexOf(".") == -1) {
+      break;
+    }
+  }
+  for (var i = 0; i < globs.length; i++) {
+    if (shExpMatch(host, globs[i])) {
+      return proxy;
+    }
+  }
+  for (var i = 0; i < regexps.length; i++) {
+    if (regexps[i].test(host)) {
+      return proxy;
+    }
+  }
+  return "DIRECT";
+}
+`)
+
+	return []byte(sb.String())
+}
+
+// pacRules collects the host conditions of every rule that can block: the
+// blacklist, subscribed lists, all groups regardless of schedule, quotas and
+// all profiles regardless of which one is active
+func (b *Blocker) pacRules() pacRules {
+	var rules pacRules
+	rules.ips = b.blockIPs
+
+	add := func(ix *index) {
+		if ix == nil {
+			return
+		}
+		for _, m := range ix.matchers {
+			rules.add(m, b.resolveIPs)
+		}
+	}
+	add(b.matchers)
+	for _, l := range b.lists {
+		add(l.block)
+	}
+	for _, g := range b.groups {
+		add(g.matchers)
+	}
+	add(b.quotas)
+	add(b.profiles)
+
+	rules.domains = sortedUnique(rules.domains)
+	rules.globs = sortedUnique(rules.globs)
+	rules.regexps = sortedUnique(rules.regexps)
+	return rules
+}
+
+// add adds the host condition of a matcher
+func (r *pacRules) add(m Matcher, resolveIPs bool) {
+	switch m := m.(type) {
+	case *ExactMatcher:
+		r.domains = append(r.domains, m.domain)
+	case *PrefixWildcardMatcher:
+		if m.suffix != "" {
+			r.domains = append(r.domains, m.suffix[1:])
+		}
+	case *SuffixWildcardMatcher:
+		if m.prefix != "" {
+			r.globs = append(r.globs, m.pattern, "*."+m.pattern)
+		}
+	case *DoubleWildcardMatcher:
+		if m.middle != "" {
+			r.globs = append(r.globs, m.pattern)
+		}
+	case *GlobMatcher:
+		// shExpMatch wildcards cross dots, so this matches a superset
+		r.globs = append(r.globs, m.pattern, "*."+m.pattern)
+	case *RegexMatcher:
+		if m.re == nil {
+			return // Never matches
+		}
+		expr := strings.TrimPrefix(m.pattern, RegexPrefix)
+		for _, s := range unsafeRegexSyntax {
+			if strings.Contains(expr, s) {
+				r.all = true
+				return
+			}
+		}
+		r.regexps = append(r.regexps, expr)
+	case *CIDRMatcher:
+		r.ips = true
+		if resolveIPs {
+			// Any domain may resolve into the range
+			r.all = true
+		}
+	case *ScopedMatcher:
+		r.add(m.inner, resolveIPs)
+	case *PathMatcher:
+		r.add(m.host, resolveIPs)
+	default:
+		r.all = true
+	}
+}
+
+// sortedUnique sorts a slice and removes duplicates
+func sortedUnique(s []string) []string {
+	sort.Strings(s)
+	out := s[:0]
+	for i, v := range s {
+		if i == 0 || v != s[i-1] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// jsString quotes a string as a JavaScript string literal
+func jsString(s string) string {
+	// JSON strings are valid JavaScript, and encoding/json escapes U+2028
+	// and U+2029, which older engines reject in literals
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+// jsBool formats a boolean as a JavaScript literal
+func jsBool(v bool) string {
+	if v {
+		return "true"
+	}
+	return "false"
+}
@@ -0,0 +1,84 @@
+package blocker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPACRules(t *testing.T) {
+	b := New()
+	b.Apply(Ruleset{
+		Blacklist: []string{
+			"facebook.com",
+			"*.tiktok.com",
+			"google.*",
+			"https://bank.example.com",
+			"example.org/games/",
+			"*cdn*.example.net",
+			"re:^ads?[0-9]*\\.",
+		},
+		Whitelist: []string{"docs.google.com"},
+		Groups:    []Group{{Name: "work", Patterns: []string{"reddit.com", "facebook.com"}}},
+		Lists:     []List{{Name: "ads", Block: []string{"doubleclick.net"}}},
+		Quotas:    []string{"youtube.com"},
+
+		ProfilePatterns: []string{"twitch.tv", "reddit.com"},
+	})
+
+	rules := b.pacRules()
+	wantDomains := []string{"bank.example.com", "doubleclick.net", "example.org", "facebook.com", "reddit.com", "tiktok.com", "twitch.tv", "youtube.com"}
+	if !reflect.DeepEqual(rules.domains, wantDomains) {
+		t.Errorf("domains = %v, want %v", rules.domains, wantDomains)
+	}
+	wantGlobs := []string{"*.*cdn*.example.net", "*.google.*", "*cdn*.example.net", "google.*"}
+	if !reflect.DeepEqual(rules.globs, wantGlobs) {
+		t.Errorf("globs = %v, want %v", rules.globs, wantGlobs)
+	}
+	if want := []string{"^ads?[0-9]*\\."}; !reflect.DeepEqual(rules.regexps, want) {
+		t.Errorf("regexps = %v, want %v", rules.regexps, want)
+	}
+	if rules.ips || rules.all {
+		t.Errorf("ips = %v, all = %v, want false", rules.ips, rules.all)
+	}
+}
+
+func TestPACRulesFallBackToProxy(t *testing.T) {
+	tests := []struct {
+		name string
+		rs   Ruleset
+		ips  bool
+		all  bool
+	}{
+		{"block IP literals", Ruleset{BlockIPLiterals: true}, true, false},
+		{"IP rule", Ruleset{Blacklist: []string{"ip:10.0.0.0/8"}}, true, false},
+		{"IP rule with resolution", Ruleset{Blacklist: []string{"ip:10.0.0.0/8"}, ResolveIPs: true}, true, true},
+		{"regex JavaScript lacks", Ruleset{Blacklist: []string{"re:(?i)^ADS\\."}}, false, true},
+	}
+
+	for _, tt := range tests {
+		b := New()
+		b.Apply(tt.rs)
+		rules := b.pacRules()
+		if rules.ips != tt.ips || rules.all != tt.all {
+			t.Errorf("%s: ips = %v, all = %v, want %v, %v", tt.name, rules.ips, rules.all, tt.ips, tt.all)
+		}
+	}
+}
+
+func TestPACScript(t *testing.T) {
+	b := New()
+	b.Apply(Ruleset{Blacklist: []string{"facebook.com", "re:^ads\\.\"quoted"}})
+
+	script := string(b.PAC("127.0.0.1:8888"))
+	for _, want := range []string{
+		"function FindProxyForURL(url, host)",
+		`var proxy = "PROXY 127.0.0.1:8888";`,
+		`"facebook.com": true,`,
+		`addRegExp("^ads\\.\"quoted");`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("PAC script does not contain %s:\n%s", want, script)
+		}
+	}
+}
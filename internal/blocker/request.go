@@ -0,0 +1,202 @@
+package blocker
+
+import (
+	"net/netip"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// Request describes a proxied request for rules that look beyond the host
+type Request struct {
+	Host   string // Domain, optionally with a port
+	Port   string // Destination port; taken from Host or the scheme default if empty
+	Method string // HTTP method, "CONNECT" for tunnels
+	Path   string // Path and query of plain HTTP requests, empty for tunnels
+
+	// Addrs are the resolved addresses of Host, checked against "ip:" block
+	// rules when resolution is enabled
+	Addrs []netip.Addr
+}
+
+// RequestPath returns the path and query of u as path rules see them: the
+// path is decoded and cleaned of dot segments and repeated slashes, so
+// "/%67ames/" and "/./games/" cannot get past a rule for "/games/"
+func RequestPath(u *url.URL) string {
+	p := u.Path
+	if p == "" {
+		p = "/"
+	} else {
+		trailing := strings.HasSuffix(p, "/")
+		p = path.Clean("/" + p)
+		if trailing && p != "/" {
+			p += "/"
+		}
+	}
+
+	if u.RawQuery != "" {
+		p += "?" + u.RawQuery
+	}
+	return p
+}
+
+// MethodDNS is the Request method of a DNS lookup. Lookups carry neither a
+// scheme, port nor path, so only rules for the whole host apply to them.
+const MethodDNS = "DNS"
+
+// RequestMatcher is a Matcher for rules that also look at the method or path
+type RequestMatcher interface {
+	Matcher
+	MatchRequest(req Request) bool
+}
+
+// methods are the HTTP methods a path rule can be restricted to
+var methods = map[string]bool{
+	"GET":     true,
+	"HEAD":    true,
+	"POST":    true,
+	"PUT":     true,
+	"PATCH":   true,
+	"DELETE":  true,
+	"OPTIONS": true,
+}
+
+// PathMatcher matches plain HTTP requests by host and path, optionally
+// restricted to one method: "example.com/games/" or "POST example.com/upload".
+// The path matches itself and everything below it, with or without a
+// trailing "/" ("/games/" matches "/games" and "/games/chess", not
+// "/gameshow"). A path with a query is a prefix of the request path and
+// query, and one containing "*" is a glob, where "*" may cross "/". Tunnels
+// carry no path, so path rules never match CONNECT requests.
+type PathMatcher struct {
+	pattern string
+	method  string
+	host    Matcher
+	path    string
+}
+
+// NewPathMatcher creates a new path matcher
+func NewPathMatcher(pattern string) *PathMatcher {
+	method, host, path := splitPathPattern(pattern)
+
+	m := &PathMatcher{
+		method: method,
+		host:   CreateMatcher(host),
+		path:   path,
+	}
+	m.pattern = m.host.Pattern() + path
+	if method != "" {
+		m.pattern = method + " " + m.pattern
+	}
+	return m
+}
+
+// splitPathPattern splits a path rule into its method, host and path
+func splitPathPattern(pattern string) (method, host, path string) {
+	pattern = strings.TrimSpace(pattern)
+	if idx := strings.IndexByte(pattern, ' '); idx != -1 {
+		method = strings.ToUpper(pattern[:idx])
+		pattern = strings.TrimSpace(pattern[idx+1:])
+	}
+
+	if idx := strings.IndexByte(pattern, '/'); idx != -1 {
+		return method, pattern[:idx], pattern[idx:]
+	}
+	return method, pattern, ""
+}
+
+// isPathPattern reports whether a pattern has a path or method component
+func isPathPattern(pattern string) bool {
+	return strings.ContainsAny(pattern, "/ ")
+}
+
+// Match never matches a bare host, since the rule needs a path
+func (m *PathMatcher) Match(domain string) bool {
+	return false
+}
+
+// MatchRequest checks if the request's method, host and path match
+func (m *PathMatcher) MatchRequest(req Request) bool {
+	if req.Path == "" || req.Method == "CONNECT" {
+		return false
+	}
+	if m.method != "" && m.method != req.Method {
+		return false
+	}
+	if !m.host.Match(req.Host) {
+		return false
+	}
+
+	switch {
+	case strings.Contains(m.path, "*"):
+		return matchPath(m.path, req.Path)
+	case strings.Contains(m.path, "?"):
+		return strings.HasPrefix(req.Path, m.path)
+	default:
+		return underPath(m.path, req.Path)
+	}
+}
+
+// Pattern returns the normalized pattern
+func (m *PathMatcher) Pattern() string {
+	return m.pattern
+}
+
+// underPath reports whether the request path and query are dir or below it,
+// comparing whole path segments
+func underPath(dir, path string) bool {
+	dir = strings.TrimSuffix(dir, "/")
+	if !strings.HasPrefix(path, dir) {
+		return false
+	}
+	rest := path[len(dir):]
+	return rest == "" || rest[0] == '/' || rest[0] == '?'
+}
+
+// matchPath reports whether path starts with a match of glob, where "*"
+// matches any run of characters
+func matchPath(glob, path string) bool {
+	parts := strings.Split(glob, "*")
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	path = path[len(parts[0]):]
+
+	for _, part := range parts[1:] {
+		idx := strings.Index(path, part)
+		if idx == -1 {
+			return false
+		}
+		path = path[idx+len(part):]
+	}
+	return true
+}
+
+// validatePathPattern checks the method, host and path of a path rule
+func validatePathPattern(pattern string) error {
+	method, host, path := splitPathPattern(pattern)
+	if method != "" && !methods[method] {
+		return &PatternError{Pattern: pattern, Reason: "unknown method " + method}
+	}
+	if strings.HasPrefix(host, RegexPrefix) || isPathPattern(host) {
+		return &PatternError{Pattern: pattern, Reason: "invalid host " + host}
+	}
+	if err := ValidatePattern(host); err != nil {
+		return &PatternError{Pattern: pattern, Reason: err.(*PatternError).Reason}
+	}
+	if path == "" {
+		return &PatternError{Pattern: pattern, Reason: "method rules need a path, e.g. " + method + " " + host + "/"}
+	}
+	if strings.ContainsAny(path, " \t") {
+		return &PatternError{Pattern: pattern, Reason: "path contains whitespace"}
+	}
+	return nil
+}
+
+// matches checks a matcher against a request, including path rules
+func matches(m Matcher, req Request) bool {
+	if rm, ok := m.(RequestMatcher); ok {
+		return rm.MatchRequest(req)
+	}
+	return m.Match(req.Host)
+}
@@ -0,0 +1,135 @@
+package blocker
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Schemes a rule can be restricted to
+const (
+	SchemeHTTP  = "http"  // Plain HTTP requests
+	SchemeHTTPS = "https" // CONNECT tunnels
+)
+
+// ScopedMatcher restricts another pattern to a scheme or destination ports,
+// like "example.com:8443", "http://example.com" or "https://example.com:443,8443".
+// "http://" matches plain HTTP requests and "https://" matches CONNECT tunnels.
+type ScopedMatcher struct {
+	pattern string
+	scheme  string
+	ports   []string
+	inner   Matcher
+}
+
+// NewScopedMatcher creates a new scheme and port scoped matcher
+func NewScopedMatcher(pattern string) *ScopedMatcher {
+	pattern = strings.TrimSpace(pattern)
+	scheme, ports, rest := splitScope(pattern)
+
+	return &ScopedMatcher{
+		pattern: pattern,
+		scheme:  scheme,
+		ports:   ports,
+		inner:   CreateMatcher(rest),
+	}
+}
+
+// splitScope splits a pattern like "POST http://example.com:8080/upload" into
+// its scheme, ports and the remaining pattern "POST example.com/upload"
+func splitScope(pattern string) (scheme string, ports []string, rest string) {
+	method := ""
+	if idx := strings.IndexByte(pattern, ' '); idx != -1 {
+		method = pattern[:idx+1]
+		pattern = strings.TrimSpace(pattern[idx+1:])
+	}
+
+	lower := strings.ToLower(pattern)
+	for _, s := range []string{SchemeHTTP, SchemeHTTPS} {
+		if strings.HasPrefix(lower, s+"://") {
+			scheme = s
+			pattern = pattern[len(s)+3:]
+			break
+		}
+	}
+
+	if strings.HasPrefix(pattern, IPPrefix) || strings.HasPrefix(pattern, RegexPrefix) {
+		return scheme, nil, method + pattern
+	}
+
+	host, path := pattern, ""
+	if idx := strings.IndexByte(pattern, '/'); idx != -1 {
+		host, path = pattern[:idx], pattern[idx:]
+	}
+	if idx := strings.LastIndexByte(host, ':'); idx != -1 {
+		ports = strings.Split(host[idx+1:], ",")
+		host = host[:idx]
+	}
+
+	return scheme, ports, method + host + path
+}
+
+// isScopedPattern reports whether a pattern has a scheme or a port
+func isScopedPattern(pattern string) bool {
+	scheme, ports, _ := splitScope(pattern)
+	return scheme != "" || ports != nil
+}
+
+// Match never matches a bare host, since the rule needs the scheme and port
+func (m *ScopedMatcher) Match(domain string) bool {
+	return false
+}
+
+// MatchRequest checks the scheme and port of the request, then the inner pattern.
+// DNS lookups never match, since the connection may use any scheme and port.
+func (m *ScopedMatcher) MatchRequest(req Request) bool {
+	if req.Method == MethodDNS {
+		return false
+	}
+
+	switch m.scheme {
+	case SchemeHTTP:
+		if req.Method == "CONNECT" {
+			return false
+		}
+	case SchemeHTTPS:
+		if req.Method != "CONNECT" {
+			return false
+		}
+	}
+
+	if m.ports != nil && !containsPort(m.ports, req.Port) {
+		return false
+	}
+
+	return matches(m.inner, req)
+}
+
+// Pattern returns the original pattern
+func (m *ScopedMatcher) Pattern() string {
+	return m.pattern
+}
+
+// containsPort reports whether port is one of ports
+func containsPort(ports []string, port string) bool {
+	for _, p := range ports {
+		if p == port {
+			return true
+		}
+	}
+	return false
+}
+
+// validateScopedPattern checks the ports and inner pattern of a scoped rule
+func validateScopedPattern(pattern string) error {
+	_, ports, rest := splitScope(pattern)
+	for _, p := range ports {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 1 || n > 65535 {
+			return &PatternError{Pattern: pattern, Reason: "invalid port " + strconv.Quote(p)}
+		}
+	}
+	if err := ValidatePattern(rest); err != nil {
+		return &PatternError{Pattern: pattern, Reason: err.(*PatternError).Reason}
+	}
+	return nil
+}
@@ -0,0 +1,210 @@
+package blocklist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Format identifies a blocklist file format
+type Format string
+
+// Supported blocklist formats
+const (
+	FormatHosts   Format = "hosts"   // "0.0.0.0 example.com"
+	FormatAdblock Format = "adblock" // "||example.com^", "@@||allowed.com^"
+	FormatPlain   Format = "plain"   // One pattern per line
+)
+
+// sinkAddresses are the addresses hosts files use to block a domain
+var sinkAddresses = map[string]bool{
+	"0.0.0.0":   true,
+	"127.0.0.1": true,
+	"::":        true,
+	"::1":       true,
+}
+
+// localHostnames are entries found in hosts files that must not be blocked
+var localHostnames = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"0.0.0.0":               true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+}
+
+// Result holds the patterns parsed from a blocklist
+type Result struct {
+	Block   []string  // Patterns to add to the blacklist
+	Allow   []string  // Patterns to add to the whitelist
+	Skipped []Skipped // Lines that could not be converted
+}
+
+// Skipped describes a line that was ignored
+type Skipped struct {
+	Line   int
+	Text   string
+	Reason string
+}
+
+// ParseFormat validates a format name
+func ParseFormat(name string) (Format, error) {
+	switch f := Format(strings.ToLower(name)); f {
+	case FormatHosts, FormatAdblock, FormatPlain:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unknown format %q (expected hosts, adblock or plain)", name)
+	}
+}
+
+// Parse converts a blocklist into blacklist and whitelist patterns.
+// Unsupported lines are reported in Result.Skipped; comments and blank
+// lines are ignored silently.
+func Parse(r io.Reader, format Format) (*Result, error) {
+	var parseLine func(line string) (block, allow []string, reason string)
+	switch format {
+	case FormatHosts:
+		parseLine = parseHostsLine
+	case FormatAdblock:
+		parseLine = parseAdblockLine
+	case FormatPlain:
+		parseLine = parsePlainLine
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+
+	result := &Result{}
+	seenBlock := make(map[string]bool)
+	seenAllow := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		block, allow, reason := parseLine(line)
+		if reason != "" {
+			result.Skipped = append(result.Skipped, Skipped{Line: lineNum, Text: line, Reason: reason})
+			continue
+		}
+
+		for _, p := range block {
+			if !seenBlock[p] {
+				seenBlock[p] = true
+				result.Block = append(result.Block, p)
+			}
+		}
+		for _, p := range allow {
+			if !seenAllow[p] {
+				seenAllow[p] = true
+				result.Allow = append(result.Allow, p)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read blocklist: %w", err)
+	}
+	return result, nil
+}
+
+// parseHostsLine parses a hosts file line like "0.0.0.0 example.com"
+func parseHostsLine(line string) (block, allow []string, reason string) {
+	if idx := strings.Index(line, "#"); idx != -1 {
+		line = strings.TrimSpace(line[:idx])
+		if line == "" {
+			return nil, nil, ""
+		}
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 {
+		return nil, nil, "missing address or hostname"
+	}
+	if !sinkAddresses[fields[0]] {
+		return nil, nil, "address is not a blocking address"
+	}
+
+	for _, host := range fields[1:] {
+		host = strings.ToLower(host)
+		if localHostnames[host] {
+			continue
+		}
+		if !isDomain(host) {
+			return nil, nil, fmt.Sprintf("invalid hostname %q", host)
+		}
+		block = append(block, host)
+	}
+	return block, nil, ""
+}
+
+// parseAdblockLine parses the domain-only subset of Adblock Plus syntax:
+// "||example.com^" blocks a domain, "@@||example.com^" allows it
+func parseAdblockLine(line string) (block, allow []string, reason string) {
+	if strings.HasPrefix(line, "!") || strings.HasPrefix(line, "[") {
+		return nil, nil, "" // Comment or header
+	}
+	if strings.Contains(line, "##") || strings.Contains(line, "#@#") || strings.Contains(line, "#?#") {
+		return nil, nil, "cosmetic filter"
+	}
+
+	exception := strings.HasPrefix(line, "@@")
+	rule := strings.TrimPrefix(line, "@@")
+
+	if strings.Contains(rule, "$") {
+		return nil, nil, "filter options are not supported"
+	}
+	if !strings.HasPrefix(rule, "||") || !strings.HasSuffix(rule, "^") {
+		return nil, nil, "not a domain-only rule"
+	}
+
+	domain := strings.ToLower(rule[2 : len(rule)-1])
+	if !isDomain(domain) {
+		return nil, nil, "not a domain-only rule"
+	}
+
+	if exception {
+		return nil, []string{domain}, ""
+	}
+	return []string{domain}, nil, ""
+}
+
+// parsePlainLine parses a line holding a single pattern
+func parsePlainLine(line string) (block, allow []string, reason string) {
+	if strings.HasPrefix(line, "#") {
+		return nil, nil, ""
+	}
+	if strings.ContainsAny(line, " \t") {
+		return nil, nil, "more than one field"
+	}
+	return []string{strings.ToLower(line)}, nil, ""
+}
+
+// isDomain reports whether s is a plain domain name with at least two labels
+func isDomain(s string) bool {
+	labels := strings.Split(s, ".")
+	if len(labels) < 2 {
+		return false
+	}
+
+	for _, label := range labels {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, c := range label {
+			isAlnum := (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')
+			if !isAlnum && c != '-' && c != '_' {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package blocklist
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHosts(t *testing.T) {
+	input := `# StevenBlack hosts
+127.0.0.1 localhost
+::1 localhost ip6-localhost
+0.0.0.0 0.0.0.0
+
+0.0.0.0 ads.example.com
+0.0.0.0 Tracker.Example.NET # inline comment
+127.0.0.1 a.example.org b.example.org
+0.0.0.0 ads.example.com
+192.168.1.10 nas.local
+0.0.0.0 bad_host!
+`
+
+	result, err := Parse(strings.NewReader(input), FormatHosts)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	wantBlock := []string{"ads.example.com", "tracker.example.net", "a.example.org", "b.example.org"}
+	if !reflect.DeepEqual(result.Block, wantBlock) {
+		t.Errorf("Block = %v, want %v", result.Block, wantBlock)
+	}
+	if len(result.Allow) != 0 {
+		t.Errorf("Allow = %v, want none", result.Allow)
+	}
+	if len(result.Skipped) != 2 || result.Skipped[0].Line != 10 || result.Skipped[1].Line != 11 {
+		t.Errorf("Skipped = %+v, want lines 10 and 11", result.Skipped)
+	}
+}
+
+func TestParseAdblock(t *testing.T) {
+	input := `[Adblock Plus 2.0]
+! Title: Example list
+||ads.example.com^
+@@||allowed.example.com^
+||tracker.example.net^$third-party
+example.org##.banner
+/banner/*/img^
+||example.com/ads/*^
+`
+
+	result, err := Parse(strings.NewReader(input), FormatAdblock)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if want := []string{"ads.example.com"}; !reflect.DeepEqual(result.Block, want) {
+		t.Errorf("Block = %v, want %v", result.Block, want)
+	}
+	if want := []string{"allowed.example.com"}; !reflect.DeepEqual(result.Allow, want) {
+		t.Errorf("Allow = %v, want %v", result.Allow, want)
+	}
+
+	wantReasons := []string{
+		"filter options are not supported",
+		"cosmetic filter",
+		"not a domain-only rule",
+		"not a domain-only rule",
+	}
+	if len(result.Skipped) != len(wantReasons) {
+		t.Fatalf("Skipped = %+v, want %d entries", result.Skipped, len(wantReasons))
+	}
+	for i, want := range wantReasons {
+		if result.Skipped[i].Reason != want {
+			t.Errorf("Skipped[%d].Reason = %q, want %q", i, result.Skipped[i].Reason, want)
+		}
+	}
+}
+
+func TestParsePlain(t *testing.T) {
+	input := "# comment\nfacebook.com\n*.tiktok.com\ngoogle.*\ntwo fields\n"
+
+	result, err := Parse(strings.NewReader(input), FormatPlain)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if want := []string{"facebook.com", "*.tiktok.com", "google.*"}; !reflect.DeepEqual(result.Block, want) {
+		t.Errorf("Block = %v, want %v", result.Block, want)
+	}
+	if len(result.Skipped) != 1 || result.Skipped[0].Line != 5 {
+		t.Errorf("Skipped = %+v, want line 5", result.Skipped)
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	for _, name := range []string{"hosts", "Adblock", "plain"} {
+		if _, err := ParseFormat(name); err != nil {
+			t.Errorf("ParseFormat(%q) error = %v", name, err)
+		}
+	}
+	if _, err := ParseFormat("csv"); err == nil {
+		t.Error("ParseFormat(csv) succeeded, want error")
+	}
+}
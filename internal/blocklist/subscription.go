@@ -0,0 +1,199 @@
+package blocklist
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// maxListSize is the largest list that will be downloaded
+	maxListSize = 64 << 20
+
+	// RetryInterval is how long to wait after a failed refresh
+	RetryInterval = 5 * time.Minute
+)
+
+// Subscription is a remote blocklist that is refreshed periodically
+type Subscription struct {
+	Name    string
+	URL     string // http://, https:// or file:// URL
+	Format  Format
+	Refresh time.Duration
+}
+
+// Status describes the state of a subscription's cached copy
+type Status struct {
+	Entries     int       `yaml:"entries"`
+	LastRefresh time.Time `yaml:"last_refresh,omitempty"` // Last successful download
+	LastAttempt time.Time `yaml:"last_attempt,omitempty"`
+	LastError   string    `yaml:"last_error,omitempty"`
+}
+
+// Due reports whether a subscription should be refreshed at the given time
+func (s *Status) Due(sub Subscription, now time.Time) bool {
+	if s.LastAttempt.IsZero() {
+		return true
+	}
+
+	interval := sub.Refresh
+	if s.LastError != "" && RetryInterval < interval {
+		interval = RetryInterval
+	}
+	return now.Sub(s.LastAttempt) >= interval
+}
+
+// Fetcher downloads subscriptions and caches them in a directory, so the
+// last good copy can be used when a refresh fails
+type Fetcher struct {
+	dir    string
+	client *http.Client
+}
+
+// DefaultCacheDir returns the default list cache directory
+func DefaultCacheDir() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".blocker", "lists")
+}
+
+// NewFetcher creates a new fetcher caching lists in dir
+func NewFetcher(dir string) *Fetcher {
+	return &Fetcher{
+		dir:    dir,
+		client: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// Dir returns the cache directory
+func (f *Fetcher) Dir() string {
+	return f.dir
+}
+
+// Refresh downloads a subscription, updates its cache and returns the parsed
+// list. If the download fails, the cached copy is returned along with the error.
+func (f *Fetcher) Refresh(sub Subscription) (*Result, error) {
+	status, _ := ReadStatus(f.dir, sub.Name)
+	status.LastAttempt = time.Now()
+
+	data, err := f.download(sub.URL)
+	if err == nil {
+		var result *Result
+		result, err = Parse(bytes.NewReader(data), sub.Format)
+		if err == nil {
+			if err = f.writeCache(sub.Name, data); err == nil {
+				status.Entries = len(result.Block) + len(result.Allow)
+				status.LastRefresh = status.LastAttempt
+				status.LastError = ""
+				f.writeStatus(sub.Name, status)
+				return result, nil
+			}
+		}
+	}
+
+	status.LastError = err.Error()
+	f.writeStatus(sub.Name, status)
+
+	cached, cacheErr := f.Load(sub)
+	if cacheErr != nil {
+		return nil, fmt.Errorf("failed to refresh list %s: %w", sub.Name, err)
+	}
+	return cached, fmt.Errorf("failed to refresh list %s, using cached copy: %w", sub.Name, err)
+}
+
+// Load parses the cached copy of a subscription
+func (f *Fetcher) Load(sub Subscription) (*Result, error) {
+	file, err := os.Open(f.cachePath(sub.Name))
+	if err != nil {
+		return nil, fmt.Errorf("no cached copy of list %s: %w", sub.Name, err)
+	}
+	defer file.Close()
+
+	return Parse(file, sub.Format)
+}
+
+// ReadStatus reads the cache status of a subscription. A missing status
+// yields an empty one.
+func ReadStatus(dir, name string) (*Status, error) {
+	status := &Status{}
+
+	data, err := os.ReadFile(filepath.Join(dir, name+".status.yaml"))
+	if os.IsNotExist(err) {
+		return status, nil
+	}
+	if err != nil {
+		return status, fmt.Errorf("failed to read list status: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, status); err != nil {
+		return &Status{}, fmt.Errorf("failed to parse list status: %w", err)
+	}
+	return status, nil
+}
+
+// download fetches the contents of an http(s) or file URL
+func (f *Fetcher) download(rawURL string) ([]byte, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid list URL: %w", err)
+	}
+
+	if u.Scheme == "file" {
+		return os.ReadFile(u.Path)
+	}
+
+	resp, err := f.client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxListSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxListSize {
+		return nil, fmt.Errorf("list exceeds %d bytes", maxListSize)
+	}
+	return data, nil
+}
+
+// writeCache atomically replaces the cached copy of a list
+func (f *Fetcher) writeCache(name string, data []byte) error {
+	if err := os.MkdirAll(f.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create list cache directory: %w", err)
+	}
+
+	tmp := f.cachePath(name) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write list cache: %w", err)
+	}
+	return os.Rename(tmp, f.cachePath(name))
+}
+
+// writeStatus saves the cache status of a list; failures are not fatal
+func (f *Fetcher) writeStatus(name string, status *Status) {
+	data, err := yaml.Marshal(status)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(f.dir, 0755); err != nil {
+		return
+	}
+	os.WriteFile(filepath.Join(f.dir, name+".status.yaml"), data, 0644)
+}
+
+// cachePath returns the path of the cached copy of a list
+func (f *Fetcher) cachePath(name string) string {
+	return filepath.Join(f.dir, name+".txt")
+}
@@ -0,0 +1,73 @@
+package blocklist
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFetcherRefresh(t *testing.T) {
+	fail := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("0.0.0.0 ads.example.com\n0.0.0.0 tracker.example.net\n"))
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	f := NewFetcher(dir)
+	sub := Subscription{Name: "test", URL: srv.URL, Format: FormatHosts, Refresh: time.Hour}
+
+	result, err := f.Refresh(sub)
+	if err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	want := []string{"ads.example.com", "tracker.example.net"}
+	if !reflect.DeepEqual(result.Block, want) {
+		t.Errorf("Block = %v, want %v", result.Block, want)
+	}
+
+	status, err := ReadStatus(dir, "test")
+	if err != nil {
+		t.Fatalf("ReadStatus() error = %v", err)
+	}
+	if status.Entries != 2 || status.LastRefresh.IsZero() || status.LastError != "" {
+		t.Errorf("status = %+v, want 2 entries and a successful refresh", status)
+	}
+	if status.Due(sub, time.Now()) {
+		t.Error("Due() = true right after a refresh")
+	}
+
+	// A failed refresh falls back to the cached copy
+	fail = true
+	result, err = f.Refresh(sub)
+	if err == nil {
+		t.Fatal("Refresh() succeeded against a failing server")
+	}
+	if result == nil || !reflect.DeepEqual(result.Block, want) {
+		t.Errorf("Refresh() result = %+v, want cached copy", result)
+	}
+
+	failed, _ := ReadStatus(dir, "test")
+	if failed.LastError == "" || !failed.LastRefresh.Equal(status.LastRefresh) {
+		t.Errorf("status after failure = %+v, want error and unchanged last refresh", failed)
+	}
+	if !failed.Due(sub, time.Now().Add(RetryInterval)) {
+		t.Error("Due() = false after the retry interval")
+	}
+}
+
+func TestFetcherWithoutCache(t *testing.T) {
+	f := NewFetcher(t.TempDir())
+	sub := Subscription{Name: "missing", URL: "file:///nonexistent/list.txt", Format: FormatPlain, Refresh: time.Hour}
+
+	result, err := f.Refresh(sub)
+	if err == nil || result != nil {
+		t.Errorf("Refresh() = %v, %v; want nil result and error", result, err)
+	}
+}
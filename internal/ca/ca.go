@@ -0,0 +1,222 @@
+package ca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Names of the CA files, stored next to the config file
+const (
+	CertFile = "ca.crt"
+	KeyFile  = "ca.key"
+)
+
+const (
+	// commonName identifies the CA in certificate stores
+	commonName = "Network Blocker Local CA"
+
+	// rootValidity is how long the root certificate is valid
+	rootValidity = 10 * 365 * 24 * time.Hour
+
+	// leafValidity is how long an issued certificate is valid; leaves are
+	// reissued well before they expire
+	leafValidity = 7 * 24 * time.Hour
+
+	// maxCachedLeaves bounds the number of cached leaf certificates
+	maxCachedLeaves = 1000
+)
+
+// ErrExists is returned by Init if a CA was already generated
+var ErrExists = errors.New("CA already exists")
+
+// CertPath returns the CA certificate path for a config file
+func CertPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), CertFile)
+}
+
+// KeyPath returns the CA private key path for a config file
+func KeyPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), KeyFile)
+}
+
+// Init generates a root CA and writes its certificate and private key.
+// An existing CA is only replaced if force is set.
+func Init(certPath, keyPath string, force bool) error {
+	if !force {
+		if _, err := os.Stat(certPath); err == nil {
+			return ErrExists
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate CA key: %w", err)
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"Network Blocker"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(rootValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode CA key: %w", err)
+	}
+
+	// Write the key first, so a certificate never exists without it
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	if err := os.WriteFile(keyPath, keyPEM, 0600); err != nil {
+		return fmt.Errorf("failed to write CA key: %w", err)
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(certPath, certPEM, 0644); err != nil {
+		return fmt.Errorf("failed to write CA certificate: %w", err)
+	}
+	return nil
+}
+
+// Authority issues leaf certificates signed by the local CA
+type Authority struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	leafKey *ecdsa.PrivateKey // Shared by all leaves, so issuing is cheap
+
+	mu     sync.Mutex
+	leaves map[string]*tls.Certificate
+}
+
+// Load reads the CA certificate and private key
+func Load(certPath, keyPath string) (*Authority, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA key: %w", err)
+	}
+
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA files: %w", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA certificate: %w", err)
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok || !cert.IsCA {
+		return nil, fmt.Errorf("invalid CA files: not an ECDSA certificate authority")
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate leaf key: %w", err)
+	}
+
+	return &Authority{
+		cert:    cert,
+		key:     key,
+		leafKey: leafKey,
+		leaves:  make(map[string]*tls.Certificate),
+	}, nil
+}
+
+// Certificate returns a certificate for host signed by the CA, issuing a new
+// one if none is cached or the cached one expires within a day
+func (a *Authority) Certificate(host string) (*tls.Certificate, error) {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" {
+		return nil, fmt.Errorf("no host name")
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	if leaf, ok := a.leaves[host]; ok && now.Add(24*time.Hour).Before(leaf.Leaf.NotAfter) {
+		return leaf, nil
+	}
+
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: host},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(leafValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	} else {
+		tmpl.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, a.cert, &a.leafKey.PublicKey, a.key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to issue certificate for %s: %w", host, err)
+	}
+	parsed, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf := &tls.Certificate{
+		Certificate: [][]byte{der, a.cert.Raw},
+		PrivateKey:  a.leafKey,
+		Leaf:        parsed,
+	}
+	if len(a.leaves) >= maxCachedLeaves {
+		a.leaves = make(map[string]*tls.Certificate)
+	}
+	a.leaves[host] = leaf
+	return leaf, nil
+}
+
+// CertPool returns a pool holding the CA certificate, for clients that trust it
+func (a *Authority) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(a.cert)
+	return pool
+}
+
+// newSerial returns a random certificate serial number
+func newSerial() (*big.Int, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
@@ -0,0 +1,61 @@
+package ca
+
+import (
+	"crypto/x509"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInitAndIssue(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, CertFile), filepath.Join(dir, KeyFile)
+
+	if err := Init(certPath, keyPath, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := Init(certPath, keyPath, false); !errors.Is(err, ErrExists) {
+		t.Errorf("second Init() error = %v, want ErrExists", err)
+	}
+	if info, err := os.Stat(keyPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("key file mode = %v, %v, want 0600", info.Mode().Perm(), err)
+	}
+
+	a, err := Load(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, host := range []string{"www.example.com", "192.0.2.1"} {
+		leaf, err := a.Certificate(host)
+		if err != nil {
+			t.Fatalf("Certificate(%s) error = %v", host, err)
+		}
+		_, err = leaf.Leaf.Verify(x509.VerifyOptions{
+			DNSName: host,
+			Roots:   a.CertPool(),
+		})
+		if err != nil {
+			t.Errorf("Certificate(%s) does not verify: %v", host, err)
+		}
+
+		again, _ := a.Certificate(host)
+		if again != leaf {
+			t.Errorf("Certificate(%s) was issued again instead of cached", host)
+		}
+	}
+
+	// A new CA replaces the old one, so its leaves are no longer trusted
+	if err := Init(certPath, keyPath, true); err != nil {
+		t.Fatal(err)
+	}
+	b, err := Load(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := a.Certificate("www.example.com")
+	if _, err := leaf.Leaf.Verify(x509.VerifyOptions{DNSName: "www.example.com", Roots: b.CertPool()}); err == nil {
+		t.Errorf("leaf of the replaced CA verifies against the new one")
+	}
+}
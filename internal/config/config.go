@@ -2,24 +2,135 @@ package config
 
 import (
 	"fmt"
+	"log"
+	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
 	"sync"
+	"time"
 
+	"github.com/user/blocker/internal/blocker"
+	"github.com/user/blocker/internal/blocklist"
+	"github.com/user/blocker/internal/schedule"
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the application configuration
 type Config struct {
-	Proxy   ProxyConfig   `yaml:"proxy"`
-	Blacklist []string    `yaml:"blacklist"`
-	Logging LoggingConfig `yaml:"logging"`
+	Proxy     ProxyConfig   `yaml:"proxy"`
+	Blacklist []string      `yaml:"blacklist"`
+	Whitelist []string      `yaml:"whitelist,omitempty"`
+	Groups    []RuleGroup   `yaml:"groups,omitempty"`
+	Quotas    []Quota       `yaml:"quotas,omitempty"`
+	Lists     []ListConfig  `yaml:"lists,omitempty"`
+	Profiles  []Profile     `yaml:"profiles,omitempty"`
+	Logging   LoggingConfig `yaml:"logging"`
+	Admin     AdminConfig   `yaml:"admin"`
+	DNS       DNSConfig     `yaml:"dns,omitempty"`
+
+	// BlockIPLiterals blocks requests to raw IP addresses unless whitelisted
+	BlockIPLiterals bool `yaml:"block_ip_literals,omitempty"`
+
+	// ResolveIPs resolves hosts before connecting and checks the addresses
+	// against "ip:" rules, so domains on blocked ranges are blocked too
+	ResolveIPs bool `yaml:"resolve_ips,omitempty"`
 }
 
 // ProxyConfig represents proxy server settings
 type ProxyConfig struct {
-	Port int    `yaml:"port"`
-	Bind string `yaml:"bind"`
+	Port  int         `yaml:"port"`
+	Bind  string      `yaml:"bind"`
+	SOCKS SOCKSConfig `yaml:"socks,omitempty"`
+
+	// Transparent accepts connections redirected by the firewall (Linux only)
+	Transparent TransparentConfig `yaml:"transparent,omitempty"`
+
+	// PAC registers the proxy's PAC URL as the system proxy, so only hosts
+	// that may be blocked go through the proxy
+	PAC bool `yaml:"pac,omitempty"`
+
+	// HTTPSBlockPage shows the block page for blocked HTTPS sites, signed by
+	// the local CA created with "netblocker ca init"
+	HTTPSBlockPage bool `yaml:"https_block_page,omitempty"`
+}
+
+// SOCKSConfig represents the optional SOCKS5 listener, served on the proxy
+// bind address with optional username/password authentication
+type SOCKSConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username,omitempty"` // Empty disables authentication
+	Password string `yaml:"password,omitempty"`
+}
+
+// TransparentConfig represents the listener for connections the firewall
+// redirects to the blocker (Linux only)
+type TransparentConfig struct {
+	Enabled bool `yaml:"enabled"`
+	Port    int  `yaml:"port"`
+}
+
+// RuleGroup is a named set of patterns that is only blocked while its schedule is active
+type RuleGroup struct {
+	Name     string         `yaml:"name"`
+	Patterns []string       `yaml:"patterns"`
+	Schedule ScheduleConfig `yaml:"schedule"`
+}
+
+// ScheduleConfig represents when a rule group is active
+type ScheduleConfig struct {
+	Days     []string `yaml:"days,omitempty"`     // e.g. "mon-fri", "sat"; empty means every day
+	Times    []string `yaml:"times,omitempty"`    // e.g. "09:00-17:30"; empty means all day
+	Timezone string   `yaml:"timezone,omitempty"` // IANA name; empty means local time
+}
+
+// Parse converts the schedule config into a schedule
+func (s ScheduleConfig) Parse() (*schedule.Schedule, error) {
+	return schedule.Parse(s.Days, s.Times, s.Timezone)
+}
+
+// Quota limits the daily usage of domains matching a pattern instead of
+// blocking them outright. Zero values mean unlimited.
+type Quota struct {
+	Pattern string        `yaml:"pattern"`
+	Time    time.Duration `yaml:"time,omitempty"`   // e.g. "30m" of connection time per day
+	Visits  int           `yaml:"visits,omitempty"` // Visits per day
+}
+
+// ListConfig represents a subscribed remote blocklist
+type ListConfig struct {
+	Name    string        `yaml:"name"`
+	URL     string        `yaml:"url"`               // http(s):// or file:// URL
+	Format  string        `yaml:"format"`            // hosts, adblock or plain
+	Refresh time.Duration `yaml:"refresh,omitempty"` // Defaults to 24h
+	Enabled bool          `yaml:"enabled"`
+}
+
+// Subscription converts the list config into a blocklist subscription
+func (l ListConfig) Subscription() (blocklist.Subscription, error) {
+	format, err := blocklist.ParseFormat(l.Format)
+	if err != nil {
+		return blocklist.Subscription{}, err
+	}
+
+	return blocklist.Subscription{
+		Name:    l.Name,
+		URL:     l.URL,
+		Format:  format,
+		Refresh: l.Refresh,
+	}, nil
+}
+
+// Profile is a named rule set such as "focus" or "weekend" that adds
+// patterns to the base blacklist and whitelist while it is active
+type Profile struct {
+	Name      string   `yaml:"name"`
+	Inherits  string   `yaml:"inherits,omitempty"` // Profile whose patterns are included too
+	Blacklist []string `yaml:"blacklist,omitempty"`
+	Whitelist []string `yaml:"whitelist,omitempty"`
 }
 
 // LoggingConfig represents logging settings
@@ -29,6 +140,36 @@ type LoggingConfig struct {
 	LogAllowed bool   `yaml:"log_allowed"`
 }
 
+// AdminConfig represents the local admin API settings.
+// The admin API always listens on 127.0.0.1.
+type AdminConfig struct {
+	Enabled bool `yaml:"enabled"`
+	Port    int  `yaml:"port"`
+}
+
+// DNSConfig represents the DNS sinkhole settings
+type DNSConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	Bind     string `yaml:"bind,omitempty"` // Defaults to 127.0.0.1
+	Port     int    `yaml:"port,omitempty"` // Defaults to 53
+	Upstream string `yaml:"upstream"`       // Resolver IP, optionally with a port
+	Mode     string `yaml:"mode,omitempty"` // DNSModeZero (default) or DNSModeNXDomain
+}
+
+// DNS sinkhole answers for blocked names
+const (
+	DNSModeZero     = "zero"     // 0.0.0.0 for A and :: for AAAA queries
+	DNSModeNXDomain = "nxdomain" // NXDOMAIN for every query type
+)
+
+// UpstreamAddr returns the upstream resolver as ip:port
+func (d DNSConfig) UpstreamAddr() string {
+	if addr, err := netip.ParseAddr(d.Upstream); err == nil {
+		return netip.AddrPortFrom(addr, 53).String()
+	}
+	return d.Upstream
+}
+
 // Manager handles configuration loading and access
 type Manager struct {
 	config     *Config
@@ -48,14 +189,33 @@ func (m *Manager) Load() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	data, err := os.ReadFile(m.configPath)
+	cfg, err := ReadFile(m.configPath)
 	if err != nil {
-		return fmt.Errorf("failed to read config file: %w", err)
+		return err
+	}
+
+	// Reject invalid configs, keeping the previously loaded one
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	logLintIssues(cfg)
+
+	m.config = cfg
+	return nil
+}
+
+// ReadFile reads and parses a config file and fills in defaults, without
+// validating it
+func ReadFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
 	var cfg Config
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
-		return fmt.Errorf("failed to parse config file: %w", err)
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
 
 	// Set defaults
@@ -68,11 +228,567 @@ func (m *Manager) Load() error {
 	if cfg.Logging.Level == "" {
 		cfg.Logging.Level = "info"
 	}
+	if cfg.Admin.Port == 0 {
+		cfg.Admin.Port = 8889
+	}
+	if cfg.DNS.Enabled {
+		if cfg.DNS.Bind == "" {
+			cfg.DNS.Bind = "127.0.0.1"
+		}
+		if cfg.DNS.Port == 0 {
+			cfg.DNS.Port = 53
+		}
+		if cfg.DNS.Mode == "" {
+			cfg.DNS.Mode = DNSModeZero
+		}
+	}
+	for i := range cfg.Lists {
+		if cfg.Lists[i].Refresh == 0 {
+			cfg.Lists[i].Refresh = 24 * time.Hour
+		}
+	}
+
+	return &cfg, nil
+}
+
+// Validate checks the configuration for invalid values
+func (c *Config) Validate() error {
+	if c.Proxy.Port < 1 || c.Proxy.Port > 65535 {
+		return fmt.Errorf("proxy port %d out of range", c.Proxy.Port)
+	}
+	if c.Admin.Port < 1 || c.Admin.Port > 65535 {
+		return fmt.Errorf("admin port %d out of range", c.Admin.Port)
+	}
+	if c.Admin.Enabled && c.Admin.Port == c.Proxy.Port {
+		return fmt.Errorf("admin port %d conflicts with proxy port", c.Admin.Port)
+	}
+	if err := c.Proxy.SOCKS.validate(c); err != nil {
+		return fmt.Errorf("socks: %w", err)
+	}
+	if err := c.Proxy.Transparent.validate(c); err != nil {
+		return fmt.Errorf("transparent: %w", err)
+	}
+	if err := c.DNS.validate(c); err != nil {
+		return fmt.Errorf("dns: %w", err)
+	}
+
+	if err := validatePatterns(c.Blacklist); err != nil {
+		return fmt.Errorf("blacklist: %w", err)
+	}
+	if err := validatePatterns(c.Whitelist); err != nil {
+		return fmt.Errorf("whitelist: %w", err)
+	}
+
+	names := make(map[string]bool, len(c.Groups))
+	for _, g := range c.Groups {
+		if g.Name == "" {
+			return fmt.Errorf("rule group without a name")
+		}
+		if names[g.Name] {
+			return fmt.Errorf("duplicate rule group %q", g.Name)
+		}
+		names[g.Name] = true
+
+		if _, err := g.Schedule.Parse(); err != nil {
+			return fmt.Errorf("rule group %q: %w", g.Name, err)
+		}
+		if err := validatePatterns(g.Patterns); err != nil {
+			return fmt.Errorf("rule group %q: %w", g.Name, err)
+		}
+	}
+
+	for _, q := range c.Quotas {
+		if q.Pattern == "" {
+			return fmt.Errorf("quota without a pattern")
+		}
+		if q.Time < 0 || q.Visits < 0 || (q.Time == 0 && q.Visits == 0) {
+			return fmt.Errorf("quota %q needs a positive time or visits limit", q.Pattern)
+		}
+		if err := blocker.ValidatePattern(q.Pattern); err != nil {
+			return fmt.Errorf("quota: %w", err)
+		}
+	}
+
+	lists := make(map[string]bool, len(c.Lists))
+	for _, l := range c.Lists {
+		if !validListName(l.Name) {
+			return fmt.Errorf("invalid list name %q: use letters, digits, '-' and '_'", l.Name)
+		}
+		if lists[l.Name] {
+			return fmt.Errorf("duplicate list %q", l.Name)
+		}
+		lists[l.Name] = true
+
+		u, err := url.Parse(l.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "file") {
+			return fmt.Errorf("list %q: URL must be http, https or file", l.Name)
+		}
+		if _, err := blocklist.ParseFormat(l.Format); err != nil {
+			return fmt.Errorf("list %q: %w", l.Name, err)
+		}
+		if l.Refresh < time.Minute {
+			return fmt.Errorf("list %q: refresh interval must be at least 1m", l.Name)
+		}
+	}
+
+	if err := c.validateProfiles(); err != nil {
+		return err
+	}
+
+	switch c.Logging.Level {
+	case "debug", "info", "warn", "error":
+	default:
+		return fmt.Errorf("unknown log level %q", c.Logging.Level)
+	}
 
-	m.config = &cfg
 	return nil
 }
 
+// validateProfiles checks profile names, patterns and inheritance
+func (c *Config) validateProfiles() error {
+	names := make(map[string]bool, len(c.Profiles))
+	for _, p := range c.Profiles {
+		if p.Name == "" {
+			return fmt.Errorf("profile without a name")
+		}
+		if names[p.Name] {
+			return fmt.Errorf("duplicate profile %q", p.Name)
+		}
+		names[p.Name] = true
+
+		if err := validatePatterns(p.Blacklist); err != nil {
+			return fmt.Errorf("profile %q: blacklist: %w", p.Name, err)
+		}
+		if err := validatePatterns(p.Whitelist); err != nil {
+			return fmt.Errorf("profile %q: whitelist: %w", p.Name, err)
+		}
+	}
+
+	for _, p := range c.Profiles {
+		if _, _, err := c.ProfileRules(p.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Profile returns the profile with the given name, or nil
+func (c *Config) Profile(name string) *Profile {
+	for i := range c.Profiles {
+		if c.Profiles[i].Name == name {
+			return &c.Profiles[i]
+		}
+	}
+	return nil
+}
+
+// ProfileRules returns the patterns a profile adds to the base blacklist and
+// whitelist, including those of the profiles it inherits from
+func (c *Config) ProfileRules(name string) (blacklist, whitelist []string, err error) {
+	var chain []*Profile
+	visited := make(map[string]bool)
+	for name != "" {
+		if visited[name] {
+			return nil, nil, fmt.Errorf("profile %q inherits from itself", name)
+		}
+		visited[name] = true
+
+		p := c.Profile(name)
+		if p == nil {
+			if len(chain) > 0 {
+				return nil, nil, fmt.Errorf("profile %q inherits from unknown profile %q", chain[len(chain)-1].Name, name)
+			}
+			return nil, nil, fmt.Errorf("unknown profile %q", name)
+		}
+		chain = append(chain, p)
+		name = p.Inherits
+	}
+
+	// Ancestors first, so the list reads from general to specific
+	for i := len(chain) - 1; i >= 0; i-- {
+		blacklist = append(blacklist, chain[i].Blacklist...)
+		whitelist = append(whitelist, chain[i].Whitelist...)
+	}
+	return blacklist, whitelist, nil
+}
+
+// ProfileSwitchWeakens describes what switching from one profile to another
+// stops blocking, like Weakens. An empty name stands for the base rules only.
+func (c *Config) ProfileSwitchWeakens(from, to string) []string {
+	oldBlack, oldWhite, _ := c.ProfileRules(from)
+	newBlack, newWhite, _ := c.ProfileRules(to)
+	return Weakens(&Config{Blacklist: oldBlack, Whitelist: oldWhite}, &Config{Blacklist: newBlack, Whitelist: newWhite})
+}
+
+// validatePatterns returns the error of the first invalid pattern
+func validatePatterns(patterns []string) error {
+	for _, p := range patterns {
+		if err := blocker.ValidatePattern(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LintIssue is a problem with a pattern in one of the config's pattern lists
+type LintIssue struct {
+	List string `json:"list"` // e.g. "blacklist", `rule group "name"` or `profile "name" blacklist`
+	blocker.Issue
+}
+
+// Lint reports duplicate, shadowed, malformed and overly broad patterns.
+// Each pattern list is checked on its own.
+func (c *Config) Lint() []LintIssue {
+	var issues []LintIssue
+	add := func(list string, patterns []string) {
+		for _, issue := range blocker.Lint(patterns) {
+			issues = append(issues, LintIssue{List: list, Issue: issue})
+		}
+	}
+
+	add("blacklist", c.Blacklist)
+	add("whitelist", c.Whitelist)
+	for _, g := range c.Groups {
+		add(fmt.Sprintf("rule group %q", g.Name), g.Patterns)
+	}
+	for _, p := range c.Profiles {
+		add(fmt.Sprintf("profile %q blacklist", p.Name), p.Blacklist)
+		add(fmt.Sprintf("profile %q whitelist", p.Name), p.Whitelist)
+	}
+	return issues
+}
+
+// maxLintWarnings is how many lint issues Load logs before summarizing the rest
+const maxLintWarnings = 10
+
+// logLintIssues logs the first few lint issues of a loaded config
+func logLintIssues(cfg *Config) {
+	issues := cfg.Lint()
+	for i, issue := range issues {
+		if i == maxLintWarnings {
+			log.Printf("[config] Warning: %d more pattern issues, run 'blocker lint' to see all", len(issues)-i)
+			break
+		}
+		log.Printf("[config] Warning: %s: %s", issue.List, issue.Issue)
+	}
+}
+
+// validListName reports whether a list name is safe to use as a file name
+func validListName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlnum && c != '-' && c != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// validate checks the SOCKS settings of a config
+func (s SOCKSConfig) validate(c *Config) error {
+	if !s.Enabled {
+		return nil
+	}
+	if s.Port < 1 || s.Port > 65535 {
+		return fmt.Errorf("port %d out of range", s.Port)
+	}
+	if s.Port == c.Proxy.Port {
+		return fmt.Errorf("port %d conflicts with proxy port", s.Port)
+	}
+	if c.Admin.Enabled && s.Port == c.Admin.Port {
+		return fmt.Errorf("port %d conflicts with admin port", s.Port)
+	}
+	if (s.Username == "") != (s.Password == "") {
+		return fmt.Errorf("username and password must be set together")
+	}
+	// RFC 1929 sends both with a one byte length
+	if len(s.Username) > 255 || len(s.Password) > 255 {
+		return fmt.Errorf("username and password must be at most 255 bytes")
+	}
+	return nil
+}
+
+// validate checks the transparent listener settings of a config
+func (t TransparentConfig) validate(c *Config) error {
+	if !t.Enabled {
+		return nil
+	}
+	// The original destination is recovered from netfilter
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("only supported on Linux")
+	}
+	if t.Port < 1 || t.Port > 65535 {
+		return fmt.Errorf("port %d out of range", t.Port)
+	}
+	if t.Port == c.Proxy.Port {
+		return fmt.Errorf("port %d conflicts with proxy port", t.Port)
+	}
+	if c.Admin.Enabled && t.Port == c.Admin.Port {
+		return fmt.Errorf("port %d conflicts with admin port", t.Port)
+	}
+	if c.Proxy.SOCKS.Enabled && t.Port == c.Proxy.SOCKS.Port {
+		return fmt.Errorf("port %d conflicts with socks port", t.Port)
+	}
+	return nil
+}
+
+// validate checks the DNS settings of a config
+func (d DNSConfig) validate(c *Config) error {
+	if !d.Enabled {
+		return nil
+	}
+	if d.Port < 1 || d.Port > 65535 {
+		return fmt.Errorf("port %d out of range", d.Port)
+	}
+	if d.Port == c.Proxy.Port {
+		return fmt.Errorf("port %d conflicts with proxy port", d.Port)
+	}
+	if c.Admin.Enabled && d.Port == c.Admin.Port {
+		return fmt.Errorf("port %d conflicts with admin port", d.Port)
+	}
+	if c.Proxy.SOCKS.Enabled && d.Port == c.Proxy.SOCKS.Port {
+		return fmt.Errorf("port %d conflicts with socks port", d.Port)
+	}
+	if c.Proxy.Transparent.Enabled && d.Port == c.Proxy.Transparent.Port {
+		return fmt.Errorf("port %d conflicts with transparent port", d.Port)
+	}
+	if d.Mode != DNSModeZero && d.Mode != DNSModeNXDomain {
+		return fmt.Errorf("unknown mode %q (use %s or %s)", d.Mode, DNSModeZero, DNSModeNXDomain)
+	}
+
+	// A host name would have to be resolved, possibly through ourselves
+	upstream, err := netip.ParseAddrPort(d.UpstreamAddr())
+	if err != nil {
+		return fmt.Errorf("upstream %q must be an IP address, optionally with a port", d.Upstream)
+	}
+	if bind, err := netip.ParseAddr(d.Bind); err == nil && upstream.Port() == uint16(d.Port) &&
+		(upstream.Addr() == bind || bind.IsUnspecified() && upstream.Addr().IsLoopback()) {
+		return fmt.Errorf("upstream %s is the DNS server itself", upstream)
+	}
+	return nil
+}
+
+// Changes returns a human readable list of differences between two configs
+func Changes(old, new *Config) []string {
+	var changes []string
+	if old == nil || new == nil {
+		return changes
+	}
+
+	if old.Proxy.Bind != new.Proxy.Bind || old.Proxy.Port != new.Proxy.Port {
+		changes = append(changes, fmt.Sprintf("proxy address %s:%d -> %s:%d (requires restart)",
+			old.Proxy.Bind, old.Proxy.Port, new.Proxy.Bind, new.Proxy.Port))
+	}
+	if old.Proxy.PAC != new.Proxy.PAC {
+		changes = append(changes, fmt.Sprintf("proxy pac: %v -> %v (requires restart)", old.Proxy.PAC, new.Proxy.PAC))
+	}
+	if old.Proxy.HTTPSBlockPage != new.Proxy.HTTPSBlockPage {
+		changes = append(changes, fmt.Sprintf("proxy https_block_page: %v -> %v (requires restart)", old.Proxy.HTTPSBlockPage, new.Proxy.HTTPSBlockPage))
+	}
+	if old.Proxy.SOCKS != new.Proxy.SOCKS {
+		changes = append(changes, "socks: updated (requires restart)")
+	}
+	if old.Proxy.Transparent != new.Proxy.Transparent {
+		changes = append(changes, "transparent: updated (requires restart)")
+	}
+	if old.DNS != new.DNS {
+		changes = append(changes, "dns: updated (requires restart)")
+	}
+	changes = append(changes, listChanges("blacklist", old.Blacklist, new.Blacklist)...)
+	changes = append(changes, listChanges("whitelist", old.Whitelist, new.Whitelist)...)
+	if old.BlockIPLiterals != new.BlockIPLiterals {
+		changes = append(changes, fmt.Sprintf("block_ip_literals: %v -> %v", old.BlockIPLiterals, new.BlockIPLiterals))
+	}
+	if old.ResolveIPs != new.ResolveIPs {
+		changes = append(changes, fmt.Sprintf("resolve_ips: %v -> %v", old.ResolveIPs, new.ResolveIPs))
+	}
+	changes = append(changes, groupChanges(old.Groups, new.Groups)...)
+	if !reflect.DeepEqual(old.Quotas, new.Quotas) {
+		changes = append(changes, fmt.Sprintf("quotas: updated (%d rules)", len(new.Quotas)))
+	}
+	if !reflect.DeepEqual(old.Lists, new.Lists) {
+		changes = append(changes, fmt.Sprintf("lists: updated (%d subscriptions)", len(new.Lists)))
+	}
+	if !reflect.DeepEqual(old.Profiles, new.Profiles) {
+		changes = append(changes, fmt.Sprintf("profiles: updated (%d profiles)", len(new.Profiles)))
+	}
+	if old.Logging != new.Logging {
+		changes = append(changes, fmt.Sprintf("logging %+v -> %+v", old.Logging, new.Logging))
+	}
+	if old.Admin != new.Admin {
+		changes = append(changes, fmt.Sprintf("admin API %+v -> %+v (requires restart)", old.Admin, new.Admin))
+	}
+
+	return changes
+}
+
+// groupChanges describes the rule groups added, removed and modified
+func groupChanges(old, new []RuleGroup) []string {
+	oldGroups := make(map[string]RuleGroup, len(old))
+	for _, g := range old {
+		oldGroups[g.Name] = g
+	}
+	newGroups := make(map[string]RuleGroup, len(new))
+	for _, g := range new {
+		newGroups[g.Name] = g
+	}
+
+	var changes []string
+	for _, g := range new {
+		prev, ok := oldGroups[g.Name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("groups: added %s", g.Name))
+		} else if !reflect.DeepEqual(prev, g) {
+			changes = append(changes, fmt.Sprintf("groups: modified %s", g.Name))
+		}
+	}
+	for _, g := range old {
+		if _, ok := newGroups[g.Name]; !ok {
+			changes = append(changes, fmt.Sprintf("groups: removed %s", g.Name))
+		}
+	}
+	return changes
+}
+
+// listChanges describes the patterns added to and removed from a list
+func listChanges(name string, old, new []string) []string {
+	oldSet := make(map[string]bool, len(old))
+	for _, p := range old {
+		oldSet[p] = true
+	}
+	newSet := make(map[string]bool, len(new))
+	for _, p := range new {
+		newSet[p] = true
+	}
+
+	var changes []string
+	for _, p := range new {
+		if !oldSet[p] {
+			changes = append(changes, fmt.Sprintf("%s: added %s", name, p))
+		}
+	}
+	for _, p := range old {
+		if !newSet[p] {
+			changes = append(changes, fmt.Sprintf("%s: removed %s", name, p))
+		}
+	}
+	return changes
+}
+
+// Weakens describes the ways new blocks less than old: removed blacklist
+// patterns, added whitelist patterns, removed or loosened groups, quotas,
+// lists and profiles, disabled IP checks and disabled DNS, SOCKS or
+// transparent listeners. It returns nil if new blocks at least everything
+// old does.
+func Weakens(old, new *Config) []string {
+	var weaker []string
+	for _, p := range missing(old.Blacklist, new.Blacklist) {
+		weaker = append(weaker, fmt.Sprintf("blacklist: removed %s", p))
+	}
+	for _, p := range missing(new.Whitelist, old.Whitelist) {
+		weaker = append(weaker, fmt.Sprintf("whitelist: added %s", p))
+	}
+
+	newGroups := make(map[string]RuleGroup, len(new.Groups))
+	for _, g := range new.Groups {
+		newGroups[g.Name] = g
+	}
+	for _, g := range old.Groups {
+		ng, ok := newGroups[g.Name]
+		switch {
+		case !ok:
+			weaker = append(weaker, fmt.Sprintf("groups: removed %s", g.Name))
+		case !reflect.DeepEqual(g.Schedule, ng.Schedule):
+			weaker = append(weaker, fmt.Sprintf("groups: changed schedule of %s", g.Name))
+		default:
+			for _, p := range missing(g.Patterns, ng.Patterns) {
+				weaker = append(weaker, fmt.Sprintf("groups: removed %s from %s", p, g.Name))
+			}
+		}
+	}
+
+	newQuotas := make(map[string]Quota, len(new.Quotas))
+	for _, q := range new.Quotas {
+		newQuotas[q.Pattern] = q
+	}
+	for _, q := range old.Quotas {
+		nq, ok := newQuotas[q.Pattern]
+		switch {
+		case !ok:
+			weaker = append(weaker, fmt.Sprintf("quotas: removed %s", q.Pattern))
+		case raised(int64(q.Time), int64(nq.Time)) || raised(int64(q.Visits), int64(nq.Visits)):
+			weaker = append(weaker, fmt.Sprintf("quotas: raised the limit of %s", q.Pattern))
+		}
+	}
+
+	newLists := make(map[string]ListConfig, len(new.Lists))
+	for _, l := range new.Lists {
+		newLists[l.Name] = l
+	}
+	for _, l := range old.Lists {
+		if nl, ok := newLists[l.Name]; l.Enabled && (!ok || !nl.Enabled || nl.URL != l.URL || nl.Format != l.Format) {
+			weaker = append(weaker, fmt.Sprintf("lists: disabled or changed %s", l.Name))
+		}
+	}
+
+	for _, p := range old.Profiles {
+		oldBlack, oldWhite, _ := old.ProfileRules(p.Name)
+		newBlack, newWhite, err := new.ProfileRules(p.Name)
+		if err != nil {
+			weaker = append(weaker, fmt.Sprintf("profiles: removed %s", p.Name))
+			continue
+		}
+		for _, pattern := range missing(oldBlack, newBlack) {
+			weaker = append(weaker, fmt.Sprintf("profiles: removed %s from %s", pattern, p.Name))
+		}
+		for _, pattern := range missing(newWhite, oldWhite) {
+			weaker = append(weaker, fmt.Sprintf("profiles: allowed %s in %s", pattern, p.Name))
+		}
+	}
+
+	if old.BlockIPLiterals && !new.BlockIPLiterals {
+		weaker = append(weaker, "block_ip_literals: disabled")
+	}
+	if old.ResolveIPs && !new.ResolveIPs {
+		weaker = append(weaker, "resolve_ips: disabled")
+	}
+	if old.DNS.Enabled && !new.DNS.Enabled {
+		weaker = append(weaker, "dns: disabled")
+	}
+	if old.Proxy.SOCKS.Enabled && !new.Proxy.SOCKS.Enabled {
+		weaker = append(weaker, "proxy.socks: disabled")
+	}
+	if old.Proxy.Transparent.Enabled && !new.Proxy.Transparent.Enabled {
+		weaker = append(weaker, "proxy.transparent: disabled")
+	}
+
+	return weaker
+}
+
+// missing returns the patterns of a that are not in b
+func missing(a, b []string) []string {
+	set := make(map[string]bool, len(b))
+	for _, p := range b {
+		set[p] = true
+	}
+
+	var result []string
+	for _, p := range a {
+		if !set[p] {
+			result = append(result, p)
+		}
+	}
+	return result
+}
+
+// raised reports whether a quota limit was loosened; zero means unlimited
+func raised(old, new int64) bool {
+	return old > 0 && (new == 0 || new > old)
+}
+
 // Get returns the current configuration (thread-safe)
 func (m *Manager) Get() *Config {
 	m.mu.RLock()
@@ -90,30 +806,123 @@ func (m *Manager) GetBlacklist() []string {
 	return m.config.Blacklist
 }
 
+// GetWhitelist returns the current whitelist (thread-safe)
+func (m *Manager) GetWhitelist() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.config == nil {
+		return nil
+	}
+	return m.config.Whitelist
+}
+
 // AddToBlacklist adds a domain to the blacklist and saves
 func (m *Manager) AddToBlacklist(domain string) error {
+	return m.update(func(cfg *Config) (err error) {
+		cfg.Blacklist, err = addPattern(cfg.Blacklist, domain, "blacklist")
+		return err
+	})
+}
+
+// RemoveFromBlacklist removes a domain from the blacklist and saves
+func (m *Manager) RemoveFromBlacklist(domain string) error {
+	return m.update(func(cfg *Config) (err error) {
+		cfg.Blacklist, err = removePattern(cfg.Blacklist, domain, "blacklist")
+		return err
+	})
+}
+
+// AddToWhitelist adds a domain to the whitelist and saves
+func (m *Manager) AddToWhitelist(domain string) error {
+	return m.update(func(cfg *Config) (err error) {
+		cfg.Whitelist, err = addPattern(cfg.Whitelist, domain, "whitelist")
+		return err
+	})
+}
+
+// RemoveFromWhitelist removes a domain from the whitelist and saves
+func (m *Manager) RemoveFromWhitelist(domain string) error {
+	return m.update(func(cfg *Config) (err error) {
+		cfg.Whitelist, err = removePattern(cfg.Whitelist, domain, "whitelist")
+		return err
+	})
+}
+
+// AddPatterns adds many patterns to the blacklist and whitelist with a single
+// save. Patterns already present are skipped. It returns the number of
+// patterns added to each list.
+func (m *Manager) AddPatterns(blacklist, whitelist []string) (addedBlack, addedWhite int, err error) {
+	err = m.update(func(cfg *Config) error {
+		cfg.Blacklist, addedBlack = mergePatterns(cfg.Blacklist, blacklist)
+		cfg.Whitelist, addedWhite = mergePatterns(cfg.Whitelist, whitelist)
+		return nil
+	})
+	return addedBlack, addedWhite, err
+}
+
+// update applies fn to a copy of the current config and saves the result.
+// Configs previously returned by Get are never modified.
+func (m *Manager) update(fn func(cfg *Config) error) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	// Check if already exists
-	for _, d := range m.config.Blacklist {
+	if m.config == nil {
+		return fmt.Errorf("config not loaded")
+	}
+
+	cfg := *m.config
+	if err := fn(&cfg); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	if err := m.save(&cfg); err != nil {
+		return err
+	}
+
+	m.config = &cfg
+	return nil
+}
+
+// addPattern returns list with domain appended, or an error if it is already present
+func addPattern(list []string, domain, name string) ([]string, error) {
+	for _, d := range list {
 		if d == domain {
-			return fmt.Errorf("domain %s already in blacklist", domain)
+			return nil, fmt.Errorf("domain %s already in %s", domain, name)
 		}
 	}
 
-	m.config.Blacklist = append(m.config.Blacklist, domain)
-	return m.save()
+	newList := make([]string, 0, len(list)+1)
+	newList = append(newList, list...)
+	return append(newList, domain), nil
 }
 
-// RemoveFromBlacklist removes a domain from the blacklist and saves
-func (m *Manager) RemoveFromBlacklist(domain string) error {
-	m.mu.Lock()
-	defer m.mu.Unlock()
+// mergePatterns returns list with all new patterns appended that it does
+// not contain yet, and the number of patterns appended
+func mergePatterns(list, patterns []string) ([]string, int) {
+	existing := make(map[string]bool, len(list))
+	for _, d := range list {
+		existing[d] = true
+	}
 
+	merged := make([]string, 0, len(list)+len(patterns))
+	merged = append(merged, list...)
+	for _, p := range patterns {
+		if !existing[p] {
+			existing[p] = true
+			merged = append(merged, p)
+		}
+	}
+	return merged, len(merged) - len(list)
+}
+
+// removePattern returns list without domain, or an error if it is not present
+func removePattern(list []string, domain, name string) ([]string, error) {
 	found := false
-	newList := make([]string, 0, len(m.config.Blacklist))
-	for _, d := range m.config.Blacklist {
+	newList := make([]string, 0, len(list))
+	for _, d := range list {
 		if d == domain {
 			found = true
 			continue
@@ -122,21 +931,25 @@ func (m *Manager) RemoveFromBlacklist(domain string) error {
 	}
 
 	if !found {
-		return fmt.Errorf("domain %s not found in blacklist", domain)
+		return nil, fmt.Errorf("domain %s not found in %s", domain, name)
 	}
 
-	m.config.Blacklist = newList
-	return m.save()
+	return newList, nil
+}
+
+// save writes the given configuration to file
+func (m *Manager) save(cfg *Config) error {
+	return WriteFile(m.configPath, cfg)
 }
 
-// save writes the current configuration to file
-func (m *Manager) save() error {
-	data, err := yaml.Marshal(m.config)
+// WriteFile writes a config file
+func WriteFile(path string, cfg *Config) error {
+	data, err := yaml.Marshal(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	return os.WriteFile(m.configPath, data, 0644)
+	return os.WriteFile(path, data, 0644)
 }
 
 // GetConfigPath returns the default config path
@@ -197,6 +1010,10 @@ func EnsureConfigExists(configPath string) error {
 			LogBlocked: true,
 			LogAllowed: false,
 		},
+		Admin: AdminConfig{
+			Enabled: true,
+			Port:    8889,
+		},
 	}
 
 	data, err := yaml.Marshal(defaultConfig)
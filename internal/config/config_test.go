@@ -0,0 +1,235 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadKeepsLastGoodConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	if err := os.WriteFile(path, []byte("blacklist:\n  - facebook.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(path)
+	if err := m.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	invalid := []string{
+		"blacklist: [unterminated\n",
+		"proxy:\n  port: 70000\nblacklist:\n  - twitter.com\n",
+		"logging:\n  level: verbose\n",
+		"proxy:\n  socks:\n    enabled: true\n    port: 8080\n",
+		"proxy:\n  socks:\n    enabled: true\n    port: 1080\n    username: alice\n",
+		"dns:\n  enabled: true\n  upstream: dns.example\n",
+		"proxy:\n  transparent:\n    enabled: true\n    port: 8080\n",
+		"dns:\n  enabled: true\n  upstream: 127.0.0.1\n",
+	}
+	if runtime.GOOS != "linux" {
+		invalid = append(invalid, "proxy:\n  transparent:\n    enabled: true\n    port: 8443\n")
+	}
+
+	for _, data := range invalid {
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Load(); err == nil {
+			t.Errorf("Load(%q) succeeded, want error", data)
+		}
+
+		got := m.GetBlacklist()
+		if len(got) != 1 || got[0] != "facebook.com" {
+			t.Errorf("after Load(%q) blacklist = %v, want [facebook.com]", data, got)
+		}
+	}
+}
+
+func TestAddPatterns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("blacklist:\n  - facebook.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := NewManager(path)
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	addedBlack, addedWhite, err := m.AddPatterns(
+		[]string{"facebook.com", "twitter.com", "reddit.com"},
+		[]string{"old.reddit.com"},
+	)
+	if err != nil {
+		t.Fatalf("AddPatterns() error = %v", err)
+	}
+	if addedBlack != 2 || addedWhite != 1 {
+		t.Errorf("AddPatterns() added %d, %d; want 2, 1", addedBlack, addedWhite)
+	}
+
+	reloaded := NewManager(path)
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if got := reloaded.GetBlacklist(); len(got) != 3 {
+		t.Errorf("saved blacklist = %v, want 3 entries", got)
+	}
+	if got := reloaded.GetWhitelist(); len(got) != 1 {
+		t.Errorf("saved whitelist = %v, want 1 entry", got)
+	}
+}
+
+func TestValidateNamesInvalidPattern(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	tests := []struct {
+		data    string
+		pattern string
+	}{
+		{"blacklist:\n  - \"re:ads(\"\n", "re:ads("},
+		{"whitelist:\n  - \"docs..google.com\"\n", "docs..google.com"},
+		{"groups:\n  - name: work\n    patterns: [\"*.\"]\n", "*."},
+	}
+
+	for _, tt := range tests {
+		if err := os.WriteFile(path, []byte(tt.data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := NewManager(path).Load()
+		if err == nil || !strings.Contains(err.Error(), strconv.Quote(tt.pattern)) {
+			t.Errorf("Load(%q) error = %v, want error naming %q", tt.data, err, tt.pattern)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("blacklist:\n  - facebook.com\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m := NewManager(path)
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.AddToBlacklist("re:[a-"); err == nil {
+		t.Errorf("AddToBlacklist(invalid regex) succeeded, want error")
+	}
+	if got := m.GetBlacklist(); len(got) != 1 {
+		t.Errorf("blacklist = %v, want [facebook.com]", got)
+	}
+}
+
+func TestLintNamesList(t *testing.T) {
+	cfg := &Config{
+		Blacklist: []string{"facebook.com", "www.facebook.com"},
+		Whitelist: []string{"docs.google.com"},
+		Groups: []RuleGroup{
+			{Name: "work", Patterns: []string{"reddit.com", "reddit.com"}},
+		},
+	}
+
+	issues := cfg.Lint()
+	if len(issues) != 2 {
+		t.Fatalf("Lint() = %v, want 2 issues", issues)
+	}
+	if issues[0].List != "blacklist" || issues[0].Pattern != "www.facebook.com" {
+		t.Errorf("issues[0] = %+v, want shadowed www.facebook.com in blacklist", issues[0])
+	}
+	if issues[1].List != `rule group "work"` || issues[1].Pattern != "reddit.com" {
+		t.Errorf("issues[1] = %+v, want duplicate reddit.com in rule group \"work\"", issues[1])
+	}
+}
+
+func TestProfileRules(t *testing.T) {
+	cfg := &Config{
+		Proxy:     ProxyConfig{Port: 8080},
+		Admin:     AdminConfig{Port: 8889},
+		Logging:   LoggingConfig{Level: "info"},
+		Blacklist: []string{"facebook.com"},
+		Profiles: []Profile{
+			{Name: "work", Blacklist: []string{"reddit.com"}, Whitelist: []string{"docs.google.com"}},
+			{Name: "focus", Inherits: "work", Blacklist: []string{"youtube.com"}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	blacklist, whitelist, err := cfg.ProfileRules("focus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(blacklist, []string{"reddit.com", "youtube.com"}) {
+		t.Errorf("blacklist = %v, want inherited patterns first", blacklist)
+	}
+	if !reflect.DeepEqual(whitelist, []string{"docs.google.com"}) {
+		t.Errorf("whitelist = %v, want inherited whitelist", whitelist)
+	}
+
+	if weaker := cfg.ProfileSwitchWeakens("work", "focus"); weaker != nil {
+		t.Errorf("ProfileSwitchWeakens(work, focus) = %v, want nil", weaker)
+	}
+	if weaker := cfg.ProfileSwitchWeakens("focus", ""); len(weaker) != 2 {
+		t.Errorf("ProfileSwitchWeakens(focus, base) = %v, want 2 removed patterns", weaker)
+	}
+
+	if _, _, err := cfg.ProfileRules("weekend"); err == nil {
+		t.Errorf("ProfileRules(unknown) succeeded, want error")
+	}
+
+	cfg.Profiles[0].Inherits = "focus"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "inherits from itself") {
+		t.Errorf("Validate() with an inheritance cycle = %v, want error", err)
+	}
+
+	cfg.Profiles[0].Inherits = "base"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), `unknown profile "base"`) {
+		t.Errorf("Validate() with an unknown parent = %v, want error", err)
+	}
+}
+
+func TestWeakens(t *testing.T) {
+	base := Config{
+		Blacklist: []string{"facebook.com", "reddit.com"},
+		Whitelist: []string{"docs.google.com"},
+		Quotas:    []Quota{{Pattern: "youtube.com", Time: 30 * time.Minute}},
+		Profiles:  []Profile{{Name: "focus", Blacklist: []string{"news.ycombinator.com"}}},
+		DNS:       DNSConfig{Enabled: true},
+	}
+	base.Proxy.SOCKS.Enabled = true
+	base.Proxy.Transparent.Enabled = true
+
+	stricter := base
+	stricter.Blacklist = append([]string{"twitter.com"}, base.Blacklist...)
+	stricter.Whitelist = nil
+	stricter.Quotas = []Quota{{Pattern: "youtube.com", Time: 15 * time.Minute}}
+	if weaker := Weakens(&base, &stricter); weaker != nil {
+		t.Errorf("Weakens(stricter) = %v, want nil", weaker)
+	}
+
+	weaker := base
+	weaker.Blacklist = []string{"facebook.com"}
+	weaker.Whitelist = []string{"docs.google.com", "reddit.com"}
+	weaker.Quotas = []Quota{{Pattern: "youtube.com", Time: time.Hour}}
+	weaker.Profiles = nil
+	weaker.DNS.Enabled = false
+	weaker.Proxy.SOCKS.Enabled = false
+	weaker.Proxy.Transparent.Enabled = false
+
+	want := []string{
+		"blacklist: removed reddit.com",
+		"whitelist: added reddit.com",
+		"quotas: raised the limit of youtube.com",
+		"profiles: removed focus",
+		"dns: disabled",
+		"proxy.socks: disabled",
+		"proxy.transparent: disabled",
+	}
+	if got := Weakens(&base, &weaker); !reflect.DeepEqual(got, want) {
+		t.Errorf("Weakens() = %q, want %q", got, want)
+	}
+}
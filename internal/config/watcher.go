@@ -0,0 +1,78 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"os"
+	"sync"
+	"time"
+)
+
+// Watcher polls a file and invokes a callback whenever its contents change
+type Watcher struct {
+	path     string
+	interval time.Duration
+	onChange func()
+	lastSum  []byte
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// NewWatcher creates a new file watcher. The callback is not invoked for
+// the contents present when Start is called.
+func NewWatcher(path string, interval time.Duration, onChange func()) *Watcher {
+	return &Watcher{
+		path:     path,
+		interval: interval,
+		onChange: onChange,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start begins polling in the background
+func (w *Watcher) Start() {
+	w.lastSum = w.checksum()
+
+	go func() {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-ticker.C:
+				w.poll()
+			}
+		}
+	}()
+}
+
+// Stop stops polling
+func (w *Watcher) Stop() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+}
+
+// poll invokes the callback if the file changed since the last poll
+func (w *Watcher) poll() {
+	sum := w.checksum()
+	if bytes.Equal(sum, w.lastSum) {
+		return
+	}
+
+	w.lastSum = sum
+	w.onChange()
+}
+
+// checksum returns a hash of the file contents (nil if it can't be read)
+func (w *Watcher) checksum() []byte {
+	data, err := os.ReadFile(w.path)
+	if err != nil {
+		return nil
+	}
+
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
@@ -0,0 +1,117 @@
+package dns
+
+import (
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+// DNS message constants from RFC 1035 and RFC 3596
+const (
+	headerSize = 12
+	maxNameLen = 255
+
+	flagQR     = 1 << 15
+	flagRD     = 1 << 8
+	flagRA     = 1 << 7
+	opcodeMask = 0xf << 11
+
+	rcodeSuccess  = 0
+	rcodeFormErr  = 1
+	rcodeServFail = 2
+	rcodeNXDomain = 3
+
+	typeA    = 1
+	typeAAAA = 28
+	classIN  = 1
+)
+
+// errMalformed is returned for messages that cannot be parsed
+var errMalformed = errors.New("malformed DNS message")
+
+// query is the part of a DNS query the server needs to answer it
+type query struct {
+	id       uint16
+	flags    uint16
+	name     string // Lowercase, without the trailing dot; empty for the root
+	qtype    uint16
+	qclass   uint16
+	question []byte // Raw question entry, copied into responses
+}
+
+// opcode returns the opcode of the query, 0 for a standard query
+func (q *query) opcode() uint16 {
+	return q.flags & opcodeMask
+}
+
+// parseQuery parses a query with exactly one question
+func parseQuery(msg []byte) (*query, error) {
+	if len(msg) < headerSize {
+		return nil, errMalformed
+	}
+
+	q := &query{
+		id:    binary.BigEndian.Uint16(msg[0:]),
+		flags: binary.BigEndian.Uint16(msg[2:]),
+	}
+	if q.flags&flagQR != 0 || binary.BigEndian.Uint16(msg[4:]) != 1 {
+		return q, errMalformed
+	}
+
+	// Names in the question are never compressed, since nothing precedes them
+	var labels []string
+	off, size := headerSize, 0
+	for {
+		if off >= len(msg) {
+			return q, errMalformed
+		}
+		n := int(msg[off])
+		off++
+		if n == 0 {
+			break
+		}
+		if n > 63 || off+n > len(msg) {
+			return q, errMalformed
+		}
+		size += n + 1
+		if size > maxNameLen {
+			return q, errMalformed
+		}
+		labels = append(labels, string(msg[off:off+n]))
+		off += n
+	}
+	if off+4 > len(msg) {
+		return q, errMalformed
+	}
+
+	q.name = strings.ToLower(strings.Join(labels, "."))
+	q.qtype = binary.BigEndian.Uint16(msg[off:])
+	q.qclass = binary.BigEndian.Uint16(msg[off+2:])
+	q.question = msg[headerSize : off+4]
+	return q, nil
+}
+
+// response builds a response to a query with the given rcode and, if rdata
+// is not nil, one answer of the query's type and class
+func response(q *query, rcode uint16, ttl uint32, rdata []byte) []byte {
+	flags := flagQR | flagRA | q.opcode() | q.flags&flagRD | rcode
+
+	msg := make([]byte, headerSize, headerSize+len(q.question)+16+len(rdata))
+	binary.BigEndian.PutUint16(msg[0:], q.id)
+	binary.BigEndian.PutUint16(msg[2:], flags)
+	if q.question != nil {
+		binary.BigEndian.PutUint16(msg[4:], 1)
+		msg = append(msg, q.question...)
+	}
+	if rdata == nil {
+		return msg
+	}
+
+	binary.BigEndian.PutUint16(msg[6:], 1)
+	msg = append(msg, 0xc0, headerSize) // Pointer to the question name
+	msg = binary.BigEndian.AppendUint16(msg, q.qtype)
+	msg = binary.BigEndian.AppendUint16(msg, q.qclass)
+	msg = binary.BigEndian.AppendUint32(msg, ttl)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(len(rdata)))
+	return append(msg, rdata...)
+}
@@ -0,0 +1,280 @@
+package dns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/user/blocker/internal/blocker"
+	"github.com/user/blocker/internal/config"
+)
+
+const (
+	// blockedTTL is the TTL of sinkhole answers, kept short so snoozes and
+	// rule changes reach clients quickly
+	blockedTTL = 60
+
+	// upstreamTimeout bounds a forwarded query
+	upstreamTimeout = 5 * time.Second
+
+	// tcpIdleTimeout closes TCP clients that stop sending queries
+	tcpIdleTimeout = 30 * time.Second
+
+	maxMessageSize = 65535
+)
+
+// Server is a DNS sinkhole for clients that ignore the system proxy. Queries
+// for blocked names are answered locally; everything else is forwarded to the
+// upstream resolver over the same transport.
+type Server struct {
+	addr     string
+	upstream string
+	mode     string
+	blocker  *blocker.Blocker
+
+	mu     sync.Mutex
+	conn   net.PacketConn
+	ln     net.Listener
+	closed bool
+}
+
+// New creates a new DNS server forwarding allowed queries to upstream
+// (host:port) and answering blocked ones as mode, one of the config.DNSMode
+// constants
+func New(bind string, port int, upstream, mode string, b *blocker.Blocker) *Server {
+	return &Server{
+		addr:     net.JoinHostPort(bind, strconv.Itoa(port)),
+		upstream: upstream,
+		mode:     mode,
+		blocker:  b,
+	}
+}
+
+// Start listens for UDP and TCP queries on the server address
+func (s *Server) Start() error {
+	log.Printf("[dns] Starting DNS server on %s, forwarding to %s", s.addr, s.upstream)
+
+	conn, err := net.ListenPacket("udp", s.addr)
+	if err != nil {
+		return fmt.Errorf("dns server error: %w", err)
+	}
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("dns server error: %w", err)
+	}
+	return s.Serve(conn, ln)
+}
+
+// Serve answers queries on conn and ln until the server is stopped
+func (s *Server) Serve(conn net.PacketConn, ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		ln.Close()
+		return nil
+	}
+	s.conn, s.ln = conn, ln
+	s.mu.Unlock()
+
+	errc := make(chan error, 2)
+	go func() { errc <- s.serveUDP(conn) }()
+	go func() { errc <- s.serveTCP(ln) }()
+
+	// If one transport fails, take the other one down with it
+	err := <-errc
+	conn.Close()
+	ln.Close()
+	if err2 := <-errc; err == nil {
+		err = err2
+	}
+	return err
+}
+
+// Stop stops answering queries
+func (s *Server) Stop() error {
+	log.Println("[dns] Stopping DNS server...")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closed = true
+	if s.conn != nil {
+		s.conn.Close()
+	}
+	if s.ln != nil {
+		s.ln.Close()
+	}
+	return nil
+}
+
+// Addr returns the server address
+func (s *Server) Addr() string {
+	return s.addr
+}
+
+// isClosed reports whether Stop was called
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// serveUDP answers queries arriving on conn
+func (s *Server) serveUDP(conn net.PacketConn) error {
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			return fmt.Errorf("dns server error: %w", err)
+		}
+
+		msg := append([]byte(nil), buf[:n]...)
+		go func() {
+			if resp := s.handle(msg, "udp"); resp != nil {
+				conn.WriteTo(resp, addr)
+			}
+		}()
+	}
+}
+
+// serveTCP accepts TCP clients on ln
+func (s *Server) serveTCP(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return nil
+			}
+			return fmt.Errorf("dns server error: %w", err)
+		}
+		go s.serveTCPConn(conn)
+	}
+}
+
+// serveTCPConn answers length-prefixed queries until the client goes quiet
+func (s *Server) serveTCPConn(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		conn.SetDeadline(time.Now().Add(tcpIdleTimeout))
+		msg, err := readTCPMessage(conn)
+		if err != nil {
+			return
+		}
+		resp := s.handle(msg, "tcp")
+		if resp == nil {
+			return
+		}
+		if err := writeTCPMessage(conn, resp); err != nil {
+			return
+		}
+	}
+}
+
+// handle answers a query, returning nil if it should be dropped
+func (s *Server) handle(msg []byte, network string) []byte {
+	q, err := parseQuery(msg)
+	if err != nil {
+		if q == nil || q.flags&flagQR != 0 {
+			return nil // Not even a header to reply to, or not a query
+		}
+		q.question = nil
+		return response(q, rcodeFormErr, 0, nil)
+	}
+
+	if q.opcode() == 0 && q.qclass == classIN && q.name != "" {
+		decision := s.blocker.CheckRequest(blocker.Request{
+			Host:   q.name,
+			Method: blocker.MethodDNS,
+		})
+		if decision.Blocked {
+			return s.sinkhole(q)
+		}
+	}
+
+	resp, err := s.forward(msg, network)
+	if err != nil {
+		log.Printf("[dns] Failed to forward query for %s: %v", q.name, err)
+		return response(q, rcodeServFail, 0, nil)
+	}
+	return resp
+}
+
+// sinkhole answers a query for a blocked name
+func (s *Server) sinkhole(q *query) []byte {
+	if s.mode == config.DNSModeNXDomain {
+		return response(q, rcodeNXDomain, 0, nil)
+	}
+
+	switch q.qtype {
+	case typeA:
+		return response(q, rcodeSuccess, blockedTTL, net.IPv4zero.To4())
+	case typeAAAA:
+		return response(q, rcodeSuccess, blockedTTL, net.IPv6zero)
+	default:
+		// No records of other types, e.g. HTTPS, so clients fall back to A
+		return response(q, rcodeSuccess, 0, nil)
+	}
+}
+
+// forward sends a query to the upstream resolver and returns its response
+func (s *Server) forward(msg []byte, network string) ([]byte, error) {
+	conn, err := net.DialTimeout(network, s.upstream, upstreamTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(upstreamTimeout))
+
+	if network == "tcp" {
+		if err := writeTCPMessage(conn, msg); err != nil {
+			return nil, err
+		}
+		return readTCPMessage(conn)
+	}
+
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Skip stray responses that do not belong to this query
+		if n >= headerSize && buf[0] == msg[0] && buf[1] == msg[1] {
+			return buf[:n], nil
+		}
+	}
+}
+
+// readTCPMessage reads a message with a two byte length prefix
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeTCPMessage writes a message with a two byte length prefix
+func writeTCPMessage(w io.Writer, msg []byte) error {
+	buf := binary.BigEndian.AppendUint16(make([]byte, 0, 2+len(msg)), uint16(len(msg)))
+	_, err := w.Write(append(buf, msg...))
+	return err
+}
@@ -0,0 +1,230 @@
+package dns
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/blocker/internal/blocker"
+	"github.com/user/blocker/internal/config"
+)
+
+// upstreamAddr is the address the stub upstream answers every A query with
+var upstreamAddr = netip.MustParseAddr("192.0.2.1")
+
+// startServer starts a server on UDP and TCP ports of 127.0.0.1
+func startServer(t *testing.T, s *Server) (udpAddr, tcpAddr string) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(conn, ln)
+	t.Cleanup(func() { s.Stop() })
+	return conn.LocalAddr().String(), ln.Addr().String()
+}
+
+// newStubUpstream starts a resolver that answers A queries with upstreamAddr
+// and everything else with NXDOMAIN, on the same UDP and TCP port
+func newStubUpstream(t *testing.T) string {
+	t.Helper()
+
+	for {
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ln, err := net.Listen("tcp", conn.LocalAddr().String())
+		if err != nil {
+			conn.Close()
+			continue // TCP port taken, try another
+		}
+
+		t.Cleanup(func() {
+			conn.Close()
+			ln.Close()
+		})
+
+		answer := func(msg []byte) []byte {
+			q, err := parseQuery(msg)
+			if err != nil {
+				return nil
+			}
+			if q.qtype == typeA {
+				return response(q, rcodeSuccess, 300, upstreamAddr.AsSlice())
+			}
+			return response(q, rcodeNXDomain, 0, nil)
+		}
+		go func() {
+			buf := make([]byte, maxMessageSize)
+			for {
+				n, addr, err := conn.ReadFrom(buf)
+				if err != nil {
+					return
+				}
+				conn.WriteTo(answer(buf[:n]), addr)
+			}
+		}()
+		go func() {
+			for {
+				c, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				msg, err := readTCPMessage(c)
+				if err == nil {
+					writeTCPMessage(c, answer(msg))
+				}
+				c.Close()
+			}
+		}()
+		return conn.LocalAddr().String()
+	}
+}
+
+// newQuery builds a standard query for name
+func newQuery(id uint16, name string, qtype uint16) []byte {
+	msg := make([]byte, headerSize)
+	binary.BigEndian.PutUint16(msg[0:], id)
+	binary.BigEndian.PutUint16(msg[2:], flagRD)
+	binary.BigEndian.PutUint16(msg[4:], 1)
+	for _, label := range strings.Split(name, ".") {
+		msg = append(msg, byte(len(label)))
+		msg = append(msg, label...)
+	}
+	msg = append(msg, 0)
+	msg = binary.BigEndian.AppendUint16(msg, qtype)
+	return binary.BigEndian.AppendUint16(msg, classIN)
+}
+
+// exchange sends a query over network and returns the response's rcode and
+// the address in its single answer, if any
+func exchange(t *testing.T, network, addr, name string, qtype uint16) (rcode int, answer netip.Addr) {
+	t.Helper()
+
+	conn, err := net.DialTimeout(network, addr, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	query := newQuery(0x1234, name, qtype)
+	var resp []byte
+	if network == "tcp" {
+		if err := writeTCPMessage(conn, query); err != nil {
+			t.Fatal(err)
+		}
+		resp, err = readTCPMessage(conn)
+	} else {
+		conn.Write(query)
+		buf := make([]byte, maxMessageSize)
+		var n int
+		n, err = conn.Read(buf)
+		resp = buf[:n]
+	}
+	if err != nil {
+		t.Fatalf("%s query for %s: %v", network, name, err)
+	}
+
+	if len(resp) < headerSize || binary.BigEndian.Uint16(resp) != 0x1234 {
+		t.Fatalf("%s query for %s: unexpected response %x", network, name, resp)
+	}
+	flags := binary.BigEndian.Uint16(resp[2:])
+	if binary.BigEndian.Uint16(resp[6:]) == 1 {
+		// The answer is last, so its address ends the message
+		rdlen := 4
+		if qtype == typeAAAA {
+			rdlen = 16
+		}
+		answer, _ = netip.AddrFromSlice(resp[len(resp)-rdlen:])
+	}
+	return int(flags & 0xf), answer
+}
+
+func TestSinkhole(t *testing.T) {
+	b := blocker.New()
+	b.Apply(blocker.Ruleset{
+		Blacklist: []string{"blocked.test", "https://scoped.test"},
+		Whitelist: []string{"ok.blocked.test"},
+	})
+
+	s := New("127.0.0.1", 0, newStubUpstream(t), config.DNSModeZero, b)
+	udpAddr, tcpAddr := startServer(t, s)
+
+	tests := []struct {
+		network string
+		name    string
+		qtype   uint16
+		rcode   int
+		answer  netip.Addr
+	}{
+		{"udp", "allowed.test", typeA, rcodeSuccess, upstreamAddr},
+		{"tcp", "allowed.test", typeA, rcodeSuccess, upstreamAddr},
+		{"udp", "allowed.test", typeAAAA, rcodeNXDomain, netip.Addr{}},
+		{"udp", "www.Blocked.test", typeA, rcodeSuccess, netip.IPv4Unspecified()},
+		{"tcp", "blocked.test", typeAAAA, rcodeSuccess, netip.IPv6Unspecified()},
+		{"udp", "blocked.test", 65, rcodeSuccess, netip.Addr{}}, // HTTPS record: no data
+		{"udp", "ok.blocked.test", typeA, rcodeSuccess, upstreamAddr},
+		{"udp", "scoped.test", typeA, rcodeSuccess, upstreamAddr}, // Lookups have no scheme
+	}
+
+	for _, tt := range tests {
+		addr := udpAddr
+		if tt.network == "tcp" {
+			addr = tcpAddr
+		}
+		rcode, answer := exchange(t, tt.network, addr, tt.name, tt.qtype)
+		if rcode != tt.rcode || answer != tt.answer {
+			t.Errorf("%s %s type %d = rcode %d answer %v, want rcode %d answer %v",
+				tt.network, tt.name, tt.qtype, rcode, answer, tt.rcode, tt.answer)
+		}
+	}
+	// Lookups are counted apart from the requests that follow them
+	if blocked, allowed := b.LookupStats(); blocked != 3 || allowed != 5 {
+		t.Errorf("LookupStats() = %d, %d, want 3, 5", blocked, allowed)
+	}
+	if blocked, allowed := b.Stats(); blocked != 0 || allowed != 0 || len(b.RecentDecisions()) != 0 {
+		t.Errorf("Stats() = %d, %d with %d decisions, want no requests", blocked, allowed, len(b.RecentDecisions()))
+	}
+}
+
+func TestSinkholeNXDomain(t *testing.T) {
+	b := blocker.New()
+	b.Apply(blocker.Ruleset{Blacklist: []string{"blocked.test"}})
+
+	s := New("127.0.0.1", 0, newStubUpstream(t), config.DNSModeNXDomain, b)
+	udpAddr, _ := startServer(t, s)
+
+	if rcode, _ := exchange(t, "udp", udpAddr, "blocked.test", typeA); rcode != rcodeNXDomain {
+		t.Errorf("blocked.test rcode = %d, want NXDOMAIN", rcode)
+	}
+	if rcode, answer := exchange(t, "udp", udpAddr, "allowed.test", typeA); rcode != rcodeSuccess || answer != upstreamAddr {
+		t.Errorf("allowed.test = rcode %d answer %v, want upstream answer", rcode, answer)
+	}
+}
+
+func TestUpstreamFailure(t *testing.T) {
+	// Nothing listens on the upstream port
+	l, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	upstream := l.LocalAddr().String()
+	l.Close()
+
+	s := New("127.0.0.1", 0, upstream, config.DNSModeZero, blocker.New())
+	_, tcpAddr := startServer(t, s)
+
+	if rcode, _ := exchange(t, "tcp", tcpAddr, "allowed.test", typeA); rcode != rcodeServFail {
+		t.Errorf("rcode = %d, want SERVFAIL", rcode)
+	}
+}
@@ -0,0 +1,148 @@
+package passphrase
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FileName is the name of the passphrase file, stored next to the config file
+const FileName = "passphrase"
+
+// ApprovedConfigFileName is the name of the copy of the config last applied
+// with the passphrase, stored next to the config file
+const ApprovedConfigFileName = "approved-config.yaml"
+
+// Hashing parameters. The iteration count is stored with each hash, so it
+// can be raised without invalidating existing passphrases.
+const (
+	scheme     = "pbkdf2-sha256"
+	iterations = 600000
+	saltSize   = 16
+	keySize    = 32
+)
+
+// ErrIncorrect is returned by Verify for a wrong passphrase
+var ErrIncorrect = errors.New("incorrect passphrase")
+
+// Path returns the passphrase file path for a config file
+func Path(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), FileName)
+}
+
+// ApprovedConfigPath returns the path of the approved config copy for a config file
+func ApprovedConfigPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), ApprovedConfigFileName)
+}
+
+// IsSet reports whether a passphrase file exists
+func IsSet(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// Set stores a salted hash of the passphrase, replacing any existing one
+func Set(path, passphrase string) error {
+	if passphrase == "" {
+		return fmt.Errorf("passphrase must not be empty")
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key := pbkdf2([]byte(passphrase), salt, iterations, keySize)
+	line := strings.Join([]string{
+		scheme,
+		strconv.Itoa(iterations),
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	}, "$")
+
+	if err := os.WriteFile(path, []byte(line+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write passphrase file: %w", err)
+	}
+	return nil
+}
+
+// Verify checks a passphrase against the stored hash and returns
+// ErrIncorrect if it does not match
+func Verify(path, passphrase string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read passphrase file: %w", err)
+	}
+
+	parts := strings.Split(strings.TrimSpace(string(data)), "$")
+	if len(parts) != 4 || parts[0] != scheme {
+		return fmt.Errorf("invalid passphrase file %s", path)
+	}
+	iter, err := strconv.Atoi(parts[1])
+	if err != nil || iter < 1 {
+		return fmt.Errorf("invalid passphrase file %s", path)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("invalid passphrase file %s", path)
+	}
+	want, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil || len(want) == 0 {
+		return fmt.Errorf("invalid passphrase file %s", path)
+	}
+
+	got := pbkdf2([]byte(passphrase), salt, iter, len(want))
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return ErrIncorrect
+	}
+	return nil
+}
+
+// Remove deletes the passphrase file
+func Remove(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove passphrase file: %w", err)
+	}
+	return nil
+}
+
+// pbkdf2 derives a key with PBKDF2-HMAC-SHA256 as described in RFC 8018
+func pbkdf2(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	size := prf.Size()
+	blocks := (keyLen + size - 1) / size
+
+	var counter [4]byte
+	key := make([]byte, 0, blocks*size)
+	u := make([]byte, size)
+	for block := 1; block <= blocks; block++ {
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write(counter[:])
+		u = prf.Sum(u[:0])
+
+		t := make([]byte, size)
+		copy(t, u)
+		for n := 1; n < iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range t {
+				t[i] ^= u[i]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
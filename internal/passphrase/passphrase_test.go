@@ -0,0 +1,55 @@
+package passphrase
+
+import (
+	"encoding/hex"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestPBKDF2(t *testing.T) {
+	// PBKDF2-HMAC-SHA256 test vectors for P = "password", S = "salt"
+	tests := []struct {
+		iter int
+		want string
+	}{
+		{1, "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{2, "ae4d0c95af6b46d32d0adff928f06dd02a303f8ef3c251dfd6e2d85a95474c43"},
+		{4096, "c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"},
+	}
+
+	for _, tt := range tests {
+		got := hex.EncodeToString(pbkdf2([]byte("password"), []byte("salt"), tt.iter, 32))
+		if got != tt.want {
+			t.Errorf("pbkdf2(iter=%d) = %s, want %s", tt.iter, got, tt.want)
+		}
+	}
+}
+
+func TestSetAndVerify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+
+	if IsSet(path) {
+		t.Fatalf("IsSet() = true before Set")
+	}
+	if err := Set(path, "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if !IsSet(path) {
+		t.Fatalf("IsSet() = false after Set")
+	}
+
+	if err := Verify(path, "correct horse"); err != nil {
+		t.Errorf("Verify(correct) = %v, want nil", err)
+	}
+	if err := Verify(path, "battery staple"); !errors.Is(err, ErrIncorrect) {
+		t.Errorf("Verify(wrong) = %v, want ErrIncorrect", err)
+	}
+
+	if err := Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if IsSet(path) {
+		t.Errorf("IsSet() = true after Remove")
+	}
+}
@@ -1,36 +1,127 @@
 package proxy
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/user/blocker/internal/blocker"
+	"github.com/user/blocker/internal/ca"
 )
 
+// Resolver looks up the addresses of a host; *net.Resolver implements it
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
 // Handler handles proxy requests
 type Handler struct {
 	blocker   *blocker.Blocker
+	resolver  Resolver
+	dialer    *net.Dialer
 	transport *http.Transport
+	ca        *ca.Authority // Serves the block page over HTTPS if set
 }
 
+// PACPath is the path the proxy serves its Proxy Auto-Config script on
+const PACPath = "/proxy.pac"
+
+// blockPageTimeout bounds the TLS handshake and request of a blocked
+// CONNECT tunnel that is shown the block page
+const blockPageTimeout = 10 * time.Second
+
+// pinnedAddrsKey is the context key of the resolved addresses a request
+// must be dialed to
+type pinnedAddrsKey struct{}
+
 // NewHandler creates a new proxy handler
 func NewHandler(b *blocker.Blocker) *Handler {
-	return &Handler{
-		blocker: b,
-		transport: &http.Transport{
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-			MaxIdleConns:          100,
-			IdleConnTimeout:       90 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
+	h := &Handler{
+		blocker:  b,
+		resolver: net.DefaultResolver,
+		dialer: &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
 		},
 	}
+	h.transport = &http.Transport{
+		DialContext:           h.dialContext,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	return h
+}
+
+// SetResolver replaces the resolver used when IP resolution is enabled.
+// It must be called before the handler serves requests.
+func (h *Handler) SetResolver(r Resolver) {
+	h.resolver = r
+}
+
+// SetCA makes blocked CONNECT requests show the block page, using
+// certificates issued by a. It must be called before the handler serves
+// requests.
+func (h *Handler) SetCA(a *ca.Authority) {
+	h.ca = a
+}
+
+// resolve looks up the addresses of a host if the rule set asks for it.
+// IP literals and disabled resolution return no addresses.
+func (h *Handler) resolve(ctx context.Context, hostport string) ([]netip.Addr, error) {
+	if !h.blocker.ResolveIPs() {
+		return nil, nil
+	}
+	host, _ := blocker.SplitHostPort(hostport)
+	if _, err := netip.ParseAddr(host); err == nil {
+		return nil, nil
+	}
+
+	addrs, err := h.resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", host)
+	}
+	return addrs, nil
+}
+
+// dialContext dials the addresses pinned in ctx, if any, so the connection
+// goes to an address that was checked against the rules
+func (h *Handler) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	addrs, ok := ctx.Value(pinnedAddrsKey{}).([]netip.Addr)
+	if !ok {
+		return h.dialer.DialContext(ctx, network, addr)
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	return h.dialAddrs(ctx, network, addrs, port)
+}
+
+// dialAddrs dials each address in turn until a connection succeeds
+func (h *Handler) dialAddrs(ctx context.Context, network string, addrs []netip.Addr, port string) (net.Conn, error) {
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := h.dialer.DialContext(ctx, network, net.JoinHostPort(addr.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
 }
 
 // ServeHTTP handles incoming proxy requests
@@ -39,9 +130,35 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		h.handleConnect(w, r)
 		return
 	}
+	// Proxied requests carry an absolute URL, so a bare path is meant for us
+	if r.URL.Host == "" && r.URL.Path == PACPath {
+		h.servePAC(w, r)
+		return
+	}
 	h.handleHTTP(w, r)
 }
 
+// servePAC serves a PAC script that sends only hosts that may be blocked
+// through the proxy, at the address the script was fetched from
+func (h *Handler) servePAC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	addr := r.Host
+	if addr == "" {
+		if local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+			addr = local.String()
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(h.blocker.PAC(addr))
+}
+
 // handleHTTP handles regular HTTP requests
 func (h *Handler) handleHTTP(w http.ResponseWriter, r *http.Request) {
 	// Extract host
@@ -50,16 +167,42 @@ func (h *Handler) handleHTTP(w http.ResponseWriter, r *http.Request) {
 		host = r.URL.Host
 	}
 
-	// Check if blocked
-	if h.blocker.IsBlocked(host) {
+	// Resolve before checking, so "ip:" rules apply to the address we dial
+	addrs, err := h.resolve(r.Context(), host)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to resolve: %v", err), http.StatusBadGateway)
+		return
+	}
+
+	// Absolute-form https:// requests default to port 443
+	port := r.URL.Port()
+	if port == "" && r.URL.Scheme == "https" {
+		port = "443"
+	}
+
+	// Check if blocked, including path, port and scheme rules
+	decision := h.blocker.CheckRequest(blocker.Request{
+		Host:   host,
+		Port:   port,
+		Method: r.Method,
+		Path:   blocker.RequestPath(r.URL),
+		Addrs:  addrs,
+	})
+	if decision.Blocked {
 		h.serveBlocked(w, r)
 		return
 	}
 
+	// Account the request to its quota, if any
+	defer h.blocker.BeginUsage(decision)()
+
 	// Create outgoing request
 	outReq := new(http.Request)
 	*outReq = *r
 	outReq.RequestURI = ""
+	if addrs != nil {
+		outReq = outReq.WithContext(context.WithValue(r.Context(), pinnedAddrsKey{}, addrs))
+	}
 
 	// Ensure URL is absolute
 	if outReq.URL.Scheme == "" {
@@ -97,28 +240,49 @@ func (h *Handler) handleHTTP(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) handleConnect(w http.ResponseWriter, r *http.Request) {
 	host := r.Host
 
-	// Check if blocked
-	if h.blocker.IsBlocked(host) {
-		http.Error(w, "Blocked", http.StatusForbidden)
+	// Resolve before checking, so "ip:" rules apply to the address we dial
+	addrs, err := h.resolve(r.Context(), host)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to resolve: %v", err), http.StatusBadGateway)
 		return
 	}
 
-	// Connect to destination
-	destConn, err := net.DialTimeout("tcp", host, 30*time.Second)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to connect: %v", err), http.StatusBadGateway)
+	// Check if blocked; the path is encrypted, so only host-level rules apply
+	decision := h.blocker.CheckRequest(blocker.Request{
+		Host:   host,
+		Method: http.MethodConnect,
+		Addrs:  addrs,
+	})
+	if decision.Blocked {
+		if h.ca == nil {
+			http.Error(w, "Blocked", http.StatusForbidden)
+			return
+		}
+		clientConn, err := hijack(w)
+		if err != nil {
+			http.Error(w, "Blocked", http.StatusForbidden)
+			return
+		}
+		clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+		go h.serveBlockedTLS(clientConn, host)
 		return
 	}
 
-	// Hijack the connection
-	hijacker, ok := w.(http.Hijacker)
-	if !ok {
-		http.Error(w, "Hijacking not supported", http.StatusInternalServerError)
-		destConn.Close()
+	// Connect to destination, using the checked addresses if resolved
+	var destConn net.Conn
+	if addrs != nil {
+		_, port := blocker.SplitHostPort(host)
+		destConn, err = h.dialAddrs(r.Context(), "tcp", addrs, port)
+	} else {
+		destConn, err = net.DialTimeout("tcp", host, 30*time.Second)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to connect: %v", err), http.StatusBadGateway)
 		return
 	}
 
-	clientConn, _, err := hijacker.Hijack()
+	// Hijack the connection
+	clientConn, err := hijack(w)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Hijack failed: %v", err), http.StatusInternalServerError)
 		destConn.Close()
@@ -129,15 +293,56 @@ func (h *Handler) handleConnect(w http.ResponseWriter, r *http.Request) {
 	clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
 
 	// Tunnel data between client and destination
-	go transfer(destConn, clientConn)
-	go transfer(clientConn, destConn)
+	go h.tunnel(clientConn, destConn, decision)
 }
 
 // serveBlocked returns a blocked response
 func (h *Handler) serveBlocked(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
 	w.WriteHeader(http.StatusForbidden)
-	w.Write([]byte(`<!DOCTYPE html>
+	w.Write([]byte(blockPage))
+}
+
+// serveBlockedTLS terminates TLS on a hijacked CONNECT tunnel with a
+// certificate for host, so the browser shows the block page instead of a
+// proxy error
+func (h *Handler) serveBlockedTLS(conn net.Conn, host string) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(blockPageTimeout))
+
+	// Only the checked CONNECT host gets a certificate, whatever the client
+	// asks for in SNI, so the CA never vouches for an unblocked host
+	name, _ := blocker.SplitHostPort(host)
+	tlsConn := tls.Server(conn, &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return h.ca.Certificate(name)
+		},
+		NextProtos: []string{"http/1.1"},
+	})
+	if err := tlsConn.Handshake(); err != nil {
+		return // Typically a client that does not trust the CA
+	}
+
+	req, err := http.ReadRequest(bufio.NewReader(tlsConn))
+	if err != nil {
+		return
+	}
+	resp := &http.Response{
+		StatusCode:    http.StatusForbidden,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Request:       req,
+		Header:        http.Header{"Content-Type": {"text/html; charset=utf-8"}},
+		Body:          io.NopCloser(strings.NewReader(blockPage)),
+		ContentLength: int64(len(blockPage)),
+		Close:         true,
+	}
+	resp.Write(tlsConn)
+	tlsConn.Close()
+}
+
+// blockPage is the page shown for blocked requests
+const blockPage = `<!DOCTYPE html>
 <html>
 <head>
     <title>Blocked</title>
@@ -168,7 +373,42 @@ func (h *Handler) serveBlocked(w http.ResponseWriter, r *http.Request) {
         <p>This website has been blocked by Network Blocker.</p>
     </div>
 </body>
-</html>`))
+</html>`
+
+// hijack takes over the client connection of a request
+func hijack(w http.ResponseWriter) (net.Conn, error) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("hijacking not supported")
+	}
+	conn, _, err := hijacker.Hijack()
+	return conn, err
+}
+
+// tunnel copies data between client and dest until both directions are
+// done and closes them. The tunnel lifetime is accounted to the quota of d,
+// and the tunnel is cut off when its time budget runs out.
+func (h *Handler) tunnel(client, dest net.Conn, d blocker.Decision) {
+	end := h.blocker.BeginUsage(d)
+	defer end()
+
+	if left, ok := h.blocker.UsageRemaining(d); ok {
+		deadline := time.Now().Add(left)
+		client.SetDeadline(deadline)
+		dest.SetDeadline(deadline)
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		transfer(dest, client)
+	}()
+	go func() {
+		defer wg.Done()
+		transfer(client, dest)
+	}()
+	wg.Wait()
 }
 
 // transfer copies data from src to dst and closes both when done
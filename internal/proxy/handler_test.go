@@ -0,0 +1,332 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/user/blocker/internal/blocker"
+	"github.com/user/blocker/internal/ca"
+	"github.com/user/blocker/internal/quota"
+)
+
+// stubResolver resolves hosts from a fixed table
+type stubResolver map[string][]netip.Addr
+
+func (r stubResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, fmt.Errorf("no such host %s", host)
+	}
+	return addrs, nil
+}
+
+// newTestProxy starts a proxy with the given rules and a stub resolver that
+// maps allowed.test to the loopback origin and blocked.test to a blocked range
+func newTestProxy(t *testing.T, rs blocker.Ruleset) (*blocker.Blocker, *httptest.Server) {
+	t.Helper()
+
+	b := blocker.New()
+	b.Apply(rs)
+
+	h := NewHandler(b)
+	h.SetResolver(stubResolver{
+		"allowed.test": {netip.MustParseAddr("127.0.0.1")},
+		"blocked.test": {netip.MustParseAddr("198.51.100.1"), netip.MustParseAddr("203.0.113.5")},
+	})
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return b, srv
+}
+
+func TestHTTPDialsResolvedAddress(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "origin")
+	}))
+	defer origin.Close()
+	_, port, _ := net.SplitHostPort(origin.Listener.Addr().String())
+
+	b, srv := newTestProxy(t, blocker.Ruleset{
+		Blacklist:  []string{"ip:203.0.113.0/24"},
+		ResolveIPs: true,
+	})
+
+	proxyURL, _ := url.Parse(srv.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	// allowed.test only exists in the stub resolver, so reaching the origin
+	// proves the proxy dialed the resolved address
+	resp, err := client.Get("http://allowed.test:" + port + "/")
+	if err != nil {
+		t.Fatalf("GET allowed.test: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "origin" {
+		t.Errorf("GET allowed.test = %d %q, want 200 \"origin\"", resp.StatusCode, body)
+	}
+
+	resp, err = client.Get("http://blocked.test/")
+	if err != nil {
+		t.Fatalf("GET blocked.test: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("GET blocked.test = %d, want 403", resp.StatusCode)
+	}
+
+	d := b.RecentDecisions()[0]
+	if d.Domain != "blocked.test" || d.ResolvedIP != "203.0.113.5" {
+		t.Errorf("decision = %s resolved %q, want blocked.test resolved 203.0.113.5", d.Domain, d.ResolvedIP)
+	}
+}
+
+func TestConnectDialsResolvedAddress(t *testing.T) {
+	origin, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer origin.Close()
+	go func() {
+		conn, err := origin.Accept()
+		if err != nil {
+			return
+		}
+		io.WriteString(conn, "hello")
+		conn.Close()
+	}()
+	_, port, _ := net.SplitHostPort(origin.Addr().String())
+
+	_, srv := newTestProxy(t, blocker.Ruleset{
+		Blacklist:  []string{"ip:203.0.113.0/24"},
+		ResolveIPs: true,
+	})
+
+	connect := func(target string) (*http.Response, *bufio.Reader) {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("CONNECT %s: %v", target, err)
+		}
+		return resp, br
+	}
+
+	resp, br := connect("allowed.test:" + port)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT allowed.test = %d, want 200", resp.StatusCode)
+	}
+	data, _ := io.ReadAll(br)
+	if string(data) != "hello" {
+		t.Errorf("tunnel read %q, want \"hello\"", data)
+	}
+
+	resp, _ = connect("blocked.test:443")
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("CONNECT blocked.test = %d, want 403", resp.StatusCode)
+	}
+}
+
+func TestHTTPPathRulesNormalized(t *testing.T) {
+	_, srv := newTestProxy(t, blocker.Ruleset{Blacklist: []string{"blocked.test/games/"}})
+
+	// Sent raw, since clients may normalize the path before sending it
+	for _, uri := range []string{"/%67ames/", "/./games/", "/news/../games/tetris", "//games/"} {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		fmt.Fprintf(conn, "GET http://blocked.test%s HTTP/1.1\r\nHost: blocked.test\r\n\r\n", uri)
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		conn.Close()
+		if err != nil {
+			t.Fatalf("GET %s: %v", uri, err)
+		}
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("GET %s = %d, want 403", uri, resp.StatusCode)
+		}
+	}
+}
+
+func TestTunnelOutlivingQuota(t *testing.T) {
+	echo := newEchoServer(t)
+	target := net.JoinHostPort("allowed.test", strconv.Itoa(echo.Port))
+
+	b, srv := newTestProxy(t, blocker.Ruleset{Quotas: []string{"allowed.test"}, ResolveIPs: true})
+	usage := quota.NewTracker(filepath.Join(t.TempDir(), quota.FileName))
+	usage.SetLimits(map[string]quota.Limit{"allowed.test": {Time: 300 * time.Millisecond}})
+	b.SetUsageTracker(usage)
+
+	connect := func() (net.Conn, *bufio.Reader, int) {
+		conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", target, target)
+		br := bufio.NewReader(conn)
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			t.Fatalf("CONNECT %s: %v", target, err)
+		}
+		return conn, br, resp.StatusCode
+	}
+
+	conn, br, status := connect()
+	if status != http.StatusOK {
+		t.Fatalf("CONNECT %s = %d, want 200", target, status)
+	}
+	start := time.Now()
+	io.WriteString(conn, "ping")
+	data := make([]byte, 4)
+	if _, err := io.ReadFull(br, data); err != nil {
+		t.Fatalf("tunnel read: %v", err)
+	}
+
+	// The tunnel is closed once the budget is used up, even while idle
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := br.ReadByte(); err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("tunnel read after the budget = %v, want closed", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Errorf("tunnel closed after %v, before its budget ran out", elapsed)
+	}
+
+	if _, _, status := connect(); status != http.StatusForbidden {
+		t.Errorf("CONNECT after the budget = %d, want 403", status)
+	}
+}
+
+func TestResolutionDisabled(t *testing.T) {
+	b, srv := newTestProxy(t, blocker.Ruleset{Blacklist: []string{"ip:203.0.113.0/24"}})
+
+	// Without resolution blocked.test is not checked against "ip:" rules,
+	// and the real resolver cannot find it
+	proxyURL, _ := url.Parse(srv.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	resp, err := client.Get("http://blocked.test/")
+	if err != nil {
+		t.Fatalf("GET blocked.test: %v", err)
+	}
+	resp.Body.Close()
+
+	if d := b.RecentDecisions()[0]; d.Blocked {
+		t.Errorf("blocked.test was blocked with resolution disabled")
+	}
+}
+
+func TestServePAC(t *testing.T) {
+	_, srv := newTestProxy(t, blocker.Ruleset{Blacklist: []string{"blocked.test"}})
+
+	resp, err := http.Get(srv.URL + PACPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/x-ns-proxy-autoconfig" {
+		t.Errorf("Content-Type = %q, want application/x-ns-proxy-autoconfig", ct)
+	}
+
+	// The script points at the address it was fetched from
+	proxyURL, _ := url.Parse(srv.URL)
+	for _, want := range []string{`"PROXY ` + proxyURL.Host + `"`, `"blocked.test": true`} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("PAC script does not contain %s:\n%s", want, body)
+		}
+	}
+}
+
+func TestConnectBlockPage(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, ca.CertFile), filepath.Join(dir, ca.KeyFile)
+	if err := ca.Init(certPath, keyPath, false); err != nil {
+		t.Fatal(err)
+	}
+	authority, err := ca.Load(certPath, keyPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := blocker.New()
+	b.Apply(blocker.Ruleset{Blacklist: []string{"blocked.test"}})
+	h := NewHandler(b)
+	h.SetCA(authority)
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	// A client trusting the CA sees the block page for blocked hosts
+	proxyURL, _ := url.Parse(srv.URL)
+	client := &http.Client{Transport: &http.Transport{
+		Proxy:           http.ProxyURL(proxyURL),
+		TLSClientConfig: &tls.Config{RootCAs: authority.CertPool()},
+	}}
+	resp, err := client.Get("https://www.blocked.test/page")
+	if err != nil {
+		t.Fatalf("GET https://www.blocked.test: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden || string(body) != blockPage {
+		t.Errorf("GET https://www.blocked.test = %d %q, want 403 with the block page", resp.StatusCode, body)
+	}
+
+	// The certificate is for the CONNECT host, not the SNI the client sends
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "CONNECT www.blocked.test:443 HTTP/1.1\r\nHost: www.blocked.test:443\r\n\r\n")
+	if resp, err := http.ReadResponse(bufio.NewReader(conn), nil); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT www.blocked.test:443 = %v, %v, want 200", resp, err)
+	}
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: "bank.example.com", RootCAs: authority.CertPool()})
+	if err := tlsConn.Handshake(); err == nil {
+		t.Error("handshake with SNI bank.example.com succeeded, want a certificate for www.blocked.test only")
+	}
+
+	// Allowed tunnels are not intercepted
+	echo := newEchoServer(t)
+	conn, err = net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", echo, echo)
+	br := bufio.NewReader(conn)
+	resp, err = http.ReadResponse(br, nil)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("CONNECT %s = %v, %v, want 200", echo, resp, err)
+	}
+	io.WriteString(conn, "ping")
+	data := make([]byte, 4)
+	if _, err := io.ReadFull(br, data); err != nil || string(data) != "ping" {
+		t.Errorf("tunnel read %q, %v, want \"ping\"", data, err)
+	}
+}
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+// connServer accepts raw connections for the servers that do not speak
+// HTTP, like the SOCKS5 and transparent servers
+type connServer struct {
+	name string // Used in errors, e.g. "socks server"
+
+	mu       sync.Mutex
+	listener net.Listener
+	closed   bool
+}
+
+// serve accepts connections on l and handles each one in its own goroutine
+// until stop is called
+func (c *connServer) serve(l net.Listener, handle func(conn net.Conn)) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		l.Close()
+		return nil
+	}
+	c.listener = l
+	c.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			c.mu.Lock()
+			closed := c.closed
+			c.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return fmt.Errorf("%s error: %w", c.name, err)
+		}
+		go handle(conn)
+	}
+}
+
+// stop stops accepting new connections; established ones are left to finish
+func (c *connServer) stop() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	if c.listener != nil {
+		return c.listener.Close()
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/user/blocker/internal/blocker"
+	"github.com/user/blocker/internal/ca"
 )
 
 // Server represents the proxy server
@@ -62,3 +63,8 @@ func (s *Server) Stop() error {
 func (s *Server) Addr() string {
 	return s.addr
 }
+
+// SetCA makes blocked HTTPS requests show the block page, see Handler.SetCA
+func (s *Server) SetCA(a *ca.Authority) {
+	s.handler.SetCA(a)
+}
@@ -0,0 +1,326 @@
+package proxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/user/blocker/internal/blocker"
+)
+
+// SOCKS5 protocol constants from RFC 1928 and RFC 1929
+const (
+	socksVersion     = 0x05
+	socksAuthVersion = 0x01
+
+	socksAuthNone     = 0x00
+	socksAuthPassword = 0x02
+	socksAuthNoAccept = 0xff
+
+	socksCmdConnect = 0x01
+
+	socksAtypIPv4   = 0x01
+	socksAtypDomain = 0x03
+	socksAtypIPv6   = 0x04
+
+	socksSucceeded           = 0x00
+	socksNotAllowed          = 0x02 // Connection not allowed by ruleset
+	socksHostUnreachable     = 0x04
+	socksConnectionRefused   = 0x05
+	socksCommandNotSupported = 0x07
+	socksAtypNotSupported    = 0x08
+)
+
+// socksHandshakeTimeout bounds the time a client has to send its request
+const socksHandshakeTimeout = 30 * time.Second
+
+// SOCKSServer is a SOCKS5 proxy for clients that cannot use an HTTP proxy.
+// CONNECT targets go through the same blocker checks as HTTPS tunnels of the
+// HTTP proxy; blocked targets get the "connection not allowed by ruleset" reply.
+type SOCKSServer struct {
+	addr     string
+	handler  *Handler
+	username string // Empty if no authentication is required
+	password string
+
+	connServer
+}
+
+// NewSOCKSServer creates a new SOCKS5 server. If username is not empty,
+// clients must authenticate with it and the password.
+func NewSOCKSServer(bind string, port int, b *blocker.Blocker, username, password string) *SOCKSServer {
+	return &SOCKSServer{
+		addr:       net.JoinHostPort(bind, strconv.Itoa(port)),
+		handler:    NewHandler(b),
+		username:   username,
+		password:   password,
+		connServer: connServer{name: "socks server"},
+	}
+}
+
+// Start listens on the server address and serves SOCKS clients
+func (s *SOCKSServer) Start() error {
+	log.Printf("[socks] Starting SOCKS5 server on %s", s.addr)
+
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("socks server error: %w", err)
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts SOCKS clients on l until the server is stopped
+func (s *SOCKSServer) Serve(l net.Listener) error {
+	return s.serve(l, s.serveConn)
+}
+
+// Stop stops accepting new clients; established tunnels are left to finish
+func (s *SOCKSServer) Stop() error {
+	log.Println("[socks] Stopping SOCKS5 server...")
+	return s.stop()
+}
+
+// Addr returns the server address
+func (s *SOCKSServer) Addr() string {
+	return s.addr
+}
+
+// serveConn runs the SOCKS handshake for one client and tunnels its connection
+func (s *SOCKSServer) serveConn(conn net.Conn) {
+	conn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+
+	if err := s.negotiate(conn); err != nil {
+		log.Printf("[socks] %s: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+
+	host, err := readSOCKSRequest(conn)
+	if err != nil {
+		var re *socksError
+		if errors.As(err, &re) {
+			writeSOCKSReply(conn, re.reply, nil)
+		}
+		conn.Close()
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), socksHandshakeTimeout)
+	defer cancel()
+
+	// Resolve before checking, so "ip:" rules apply to the address we dial
+	addrs, err := s.handler.resolve(ctx, host)
+	if err != nil {
+		writeSOCKSReply(conn, socksHostUnreachable, nil)
+		conn.Close()
+		return
+	}
+
+	// SOCKS carries no path, so it is checked like an HTTPS tunnel
+	decision := s.handler.blocker.CheckRequest(blocker.Request{
+		Host:   host,
+		Method: http.MethodConnect,
+		Addrs:  addrs,
+	})
+	if decision.Blocked {
+		writeSOCKSReply(conn, socksNotAllowed, nil)
+		conn.Close()
+		return
+	}
+
+	var destConn net.Conn
+	if addrs != nil {
+		_, port := blocker.SplitHostPort(host)
+		destConn, err = s.handler.dialAddrs(ctx, "tcp", addrs, port)
+	} else {
+		destConn, err = s.handler.dialer.DialContext(ctx, "tcp", host)
+	}
+	if err != nil {
+		reply := byte(socksHostUnreachable)
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			reply = socksConnectionRefused
+		}
+		writeSOCKSReply(conn, reply, nil)
+		conn.Close()
+		return
+	}
+
+	if err := writeSOCKSReply(conn, socksSucceeded, destConn.LocalAddr()); err != nil {
+		destConn.Close()
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	// Tunnel data between client and destination
+	s.handler.tunnel(conn, destConn, decision)
+}
+
+// negotiate selects the authentication method and authenticates the client
+func (s *SOCKSServer) negotiate(conn net.Conn) error {
+	var header [2]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return fmt.Errorf("failed to read greeting: %w", err)
+	}
+	if header[0] != socksVersion {
+		return fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return fmt.Errorf("failed to read greeting: %w", err)
+	}
+
+	want := byte(socksAuthNone)
+	if s.username != "" {
+		want = socksAuthPassword
+	}
+	offered := false
+	for _, m := range methods {
+		if m == want {
+			offered = true
+		}
+	}
+	if !offered {
+		conn.Write([]byte{socksVersion, socksAuthNoAccept})
+		return fmt.Errorf("no acceptable authentication method")
+	}
+	if _, err := conn.Write([]byte{socksVersion, want}); err != nil {
+		return err
+	}
+
+	if want == socksAuthPassword {
+		return s.authenticate(conn)
+	}
+	return nil
+}
+
+// authenticate checks username/password credentials as described in RFC 1929
+func (s *SOCKSServer) authenticate(conn net.Conn) error {
+	var version [1]byte
+	if _, err := io.ReadFull(conn, version[:]); err != nil {
+		return fmt.Errorf("failed to read credentials: %w", err)
+	}
+	if version[0] != socksAuthVersion {
+		return fmt.Errorf("unsupported authentication version %d", version[0])
+	}
+	username, err := readSOCKSString(conn)
+	if err != nil {
+		return fmt.Errorf("failed to read credentials: %w", err)
+	}
+	password, err := readSOCKSString(conn)
+	if err != nil {
+		return fmt.Errorf("failed to read credentials: %w", err)
+	}
+
+	userOK := subtle.ConstantTimeCompare([]byte(username), []byte(s.username)) == 1
+	passOK := subtle.ConstantTimeCompare([]byte(password), []byte(s.password)) == 1
+	if !userOK || !passOK {
+		conn.Write([]byte{socksAuthVersion, 0x01})
+		return fmt.Errorf("authentication failed for user %q", username)
+	}
+
+	_, err = conn.Write([]byte{socksAuthVersion, 0x00})
+	return err
+}
+
+// socksError is a request error that is reported to the client with a reply code
+type socksError struct {
+	reply byte
+	msg   string
+}
+
+// Error returns the error message
+func (e *socksError) Error() string {
+	return e.msg
+}
+
+// readSOCKSRequest reads a CONNECT request and returns its target as host:port
+func readSOCKSRequest(conn net.Conn) (string, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return "", fmt.Errorf("failed to read request: %w", err)
+	}
+	if header[0] != socksVersion {
+		return "", fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+	if header[1] != socksCmdConnect {
+		return "", &socksError{socksCommandNotSupported, fmt.Sprintf("unsupported command %d", header[1])}
+	}
+
+	var host string
+	switch header[3] {
+	case socksAtypIPv4, socksAtypIPv6:
+		size := 4
+		if header[3] == socksAtypIPv6 {
+			size = 16
+		}
+		ip := make([]byte, size)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", fmt.Errorf("failed to read request: %w", err)
+		}
+		addr, _ := netip.AddrFromSlice(ip)
+		host = addr.String()
+	case socksAtypDomain:
+		domain, err := readSOCKSString(conn)
+		if err != nil {
+			return "", fmt.Errorf("failed to read request: %w", err)
+		}
+		host = domain
+	default:
+		return "", &socksError{socksAtypNotSupported, fmt.Sprintf("unsupported address type %d", header[3])}
+	}
+
+	var port [2]byte
+	if _, err := io.ReadFull(conn, port[:]); err != nil {
+		return "", fmt.Errorf("failed to read request: %w", err)
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// readSOCKSString reads a length-prefixed string
+func readSOCKSString(r io.Reader) (string, error) {
+	var size [1]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return "", err
+	}
+	buf := make([]byte, size[0])
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// writeSOCKSReply sends a reply with the bound address, or 0.0.0.0:0 if bound is nil
+func writeSOCKSReply(conn net.Conn, reply byte, bound net.Addr) error {
+	addr := netip.IPv4Unspecified()
+	port := 0
+	if tcp, ok := bound.(*net.TCPAddr); ok {
+		if a, ok := netip.AddrFromSlice(tcp.IP); ok {
+			addr = a.Unmap()
+		}
+		port = tcp.Port
+	}
+
+	msg := []byte{socksVersion, reply, 0x00}
+	if addr.Is4() {
+		msg = append(msg, socksAtypIPv4)
+	} else {
+		msg = append(msg, socksAtypIPv6)
+	}
+	msg = append(msg, addr.AsSlice()...)
+	msg = binary.BigEndian.AppendUint16(msg, uint16(port))
+
+	_, err := conn.Write(msg)
+	return err
+}
@@ -0,0 +1,206 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/user/blocker/internal/blocker"
+)
+
+// newTestSOCKS starts a SOCKS server with the given rules and credentials
+func newTestSOCKS(t *testing.T, rs blocker.Ruleset, username, password string) string {
+	t.Helper()
+
+	b := blocker.New()
+	b.Apply(rs)
+
+	s := NewSOCKSServer("127.0.0.1", 0, b, username, password)
+	s.handler.SetResolver(stubResolver{
+		"allowed.test":     {netip.MustParseAddr("127.0.0.1")},
+		"www.blocked.test": {netip.MustParseAddr("203.0.113.5")},
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { s.Stop() })
+	return l.Addr().String()
+}
+
+// newEchoServer starts a TCP server that echoes what it receives
+func newEchoServer(t *testing.T) *net.TCPAddr {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().(*net.TCPAddr)
+}
+
+// socksConnect sends a CONNECT request with the given address type and
+// address and returns the reply code
+func socksConnect(t *testing.T, conn net.Conn, atyp byte, addr []byte, port int) byte {
+	t.Helper()
+
+	req := []byte{socksVersion, socksCmdConnect, 0x00, atyp}
+	if atyp == socksAtypDomain {
+		req = append(req, byte(len(addr)))
+	}
+	req = append(req, addr...)
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		t.Fatal(err)
+	}
+
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(conn, reply[:4]); err != nil {
+		t.Fatal(err)
+	}
+	size := 4
+	if reply[3] == socksAtypIPv6 {
+		size = 16
+	}
+	rest := make([]byte, size+2)
+	if _, err := io.ReadFull(conn, rest); err != nil {
+		t.Fatal(err)
+	}
+	return reply[1]
+}
+
+// dialSOCKS connects to the SOCKS server and negotiates no authentication
+func dialSOCKS(t *testing.T, addr string) net.Conn {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	conn.Write([]byte{socksVersion, 1, socksAuthNone})
+	var resp [2]byte
+	if _, err := io.ReadFull(conn, resp[:]); err != nil || resp[1] != socksAuthNone {
+		t.Fatalf("method selection = %v, %v; want no authentication", resp, err)
+	}
+	return conn
+}
+
+func TestSOCKSConnect(t *testing.T) {
+	echo := newEchoServer(t)
+	addr := newTestSOCKS(t, blocker.Ruleset{
+		Blacklist:  []string{"blocked.test", "ip:2001:db8::/32"},
+		ResolveIPs: true,
+	}, "", "")
+
+	// IPv4 target, tunneled to the echo server
+	conn := dialSOCKS(t, addr)
+	if got := socksConnect(t, conn, socksAtypIPv4, echo.IP.To4(), echo.Port); got != socksSucceeded {
+		t.Fatalf("CONNECT IPv4 reply = %d, want %d", got, socksSucceeded)
+	}
+	conn.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || !bytes.Equal(buf, []byte("ping")) {
+		t.Errorf("tunnel echoed %q, %v; want ping", buf, err)
+	}
+
+	// Domain target, resolved to the echo server
+	conn = dialSOCKS(t, addr)
+	if got := socksConnect(t, conn, socksAtypDomain, []byte("allowed.test"), echo.Port); got != socksSucceeded {
+		t.Errorf("CONNECT allowed.test reply = %d, want %d", got, socksSucceeded)
+	}
+
+	// Blocked domain and IPv6 targets get "not allowed by ruleset"
+	conn = dialSOCKS(t, addr)
+	if got := socksConnect(t, conn, socksAtypDomain, []byte("www.blocked.test"), 443); got != socksNotAllowed {
+		t.Errorf("CONNECT www.blocked.test reply = %d, want %d", got, socksNotAllowed)
+	}
+	conn = dialSOCKS(t, addr)
+	if got := socksConnect(t, conn, socksAtypIPv6, netip.MustParseAddr("2001:db8::1").AsSlice(), 443); got != socksNotAllowed {
+		t.Errorf("CONNECT [2001:db8::1] reply = %d, want %d", got, socksNotAllowed)
+	}
+}
+
+func TestSOCKSUnsupportedCommand(t *testing.T) {
+	addr := newTestSOCKS(t, blocker.Ruleset{}, "", "")
+	conn := dialSOCKS(t, addr)
+
+	// BIND
+	conn.Write([]byte{socksVersion, 0x02, 0x00, socksAtypIPv4, 127, 0, 0, 1, 0, 80})
+	reply := make([]byte, 10)
+	if _, err := io.ReadFull(conn, reply); err != nil || reply[1] != socksCommandNotSupported {
+		t.Errorf("BIND reply = %v, %v; want code %d", reply, err, socksCommandNotSupported)
+	}
+}
+
+func TestSOCKSAuthentication(t *testing.T) {
+	echo := newEchoServer(t)
+	addr := newTestSOCKS(t, blocker.Ruleset{}, "alice", "secret")
+
+	auth := func(username, password string) (net.Conn, byte) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+
+		conn.Write([]byte{socksVersion, 2, socksAuthNone, socksAuthPassword})
+		var resp [2]byte
+		if _, err := io.ReadFull(conn, resp[:]); err != nil || resp[1] != socksAuthPassword {
+			t.Fatalf("method selection = %v, %v; want username/password", resp, err)
+		}
+
+		req := []byte{socksAuthVersion, byte(len(username))}
+		req = append(req, username...)
+		req = append(req, byte(len(password)))
+		req = append(req, password...)
+		conn.Write(req)
+		if _, err := io.ReadFull(conn, resp[:]); err != nil {
+			t.Fatal(err)
+		}
+		return conn, resp[1]
+	}
+
+	if _, status := auth("alice", "wrong"); status == 0x00 {
+		t.Errorf("wrong password accepted")
+	}
+
+	conn, status := auth("alice", "secret")
+	if status != 0x00 {
+		t.Fatalf("correct credentials rejected with status %d", status)
+	}
+	if got := socksConnect(t, conn, socksAtypIPv4, echo.IP.To4(), echo.Port); got != socksSucceeded {
+		t.Errorf("CONNECT after authentication reply = %d, want %d", got, socksSucceeded)
+	}
+
+	// Clients that don't offer username/password are refused
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte{socksVersion, 1, socksAuthNone})
+	var resp [2]byte
+	if _, err := io.ReadFull(conn, resp[:]); err != nil || resp[1] != socksAuthNoAccept {
+		t.Errorf("method selection without credentials = %v, %v; want no acceptable method", resp, err)
+	}
+}
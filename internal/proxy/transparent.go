@@ -0,0 +1,234 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/user/blocker/internal/blocker"
+	"github.com/user/blocker/internal/sni"
+)
+
+const (
+	// peekTimeout bounds the time a client has to send its ClientHello or request
+	peekTimeout = 10 * time.Second
+
+	// maxPeekSize bounds the bytes buffered while looking for the host name
+	maxPeekSize = 64 << 10
+)
+
+// errTransparentUnsupported is returned on platforms without a way to
+// recover the original destination of a redirected connection
+var errTransparentUnsupported = errors.New("transparent mode is only supported on Linux")
+
+// httpMethodPrefixes start plain HTTP requests, so their Host header can be awaited
+var httpMethodPrefixes = []string{"GET ", "HEAD ", "POST ", "PUT ", "PATCH ", "DELETE ", "OPTIONS ", "TRACE ", "CONNECT "}
+
+// TransparentServer accepts connections the firewall redirected to it, e.g.
+// with an iptables REDIRECT rule, for apps that ignore the proxy settings.
+// Each connection is checked by the TLS server name, or the Host header of
+// plain HTTP, falling back to its destination address. Allowed connections
+// are spliced to their original destination and blocked ones are reset.
+type TransparentServer struct {
+	addr    string
+	handler *Handler
+
+	// originalDst recovers the destination of a redirected connection
+	originalDst func(conn net.Conn) (netip.AddrPort, error)
+
+	connServer
+}
+
+// NewTransparentServer creates a new transparent proxy server
+func NewTransparentServer(bind string, port int, b *blocker.Blocker) *TransparentServer {
+	return &TransparentServer{
+		addr:        net.JoinHostPort(bind, strconv.Itoa(port)),
+		handler:     NewHandler(b),
+		originalDst: originalDst,
+		connServer:  connServer{name: "transparent server"},
+	}
+}
+
+// Start listens on the server address and serves redirected connections
+func (s *TransparentServer) Start() error {
+	if !TransparentSupported {
+		return fmt.Errorf("transparent server error: %w", errTransparentUnsupported)
+	}
+
+	log.Printf("[transparent] Starting transparent proxy on %s", s.addr)
+
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("transparent server error: %w", err)
+	}
+	return s.Serve(l)
+}
+
+// Serve accepts redirected connections on l until the server is stopped
+func (s *TransparentServer) Serve(l net.Listener) error {
+	return s.serve(l, s.serveConn)
+}
+
+// Stop stops accepting new connections; established ones are left to finish
+func (s *TransparentServer) Stop() error {
+	log.Println("[transparent] Stopping transparent proxy...")
+	return s.stop()
+}
+
+// Addr returns the server address
+func (s *TransparentServer) Addr() string {
+	return s.addr
+}
+
+// serveConn checks one redirected connection and splices or resets it
+func (s *TransparentServer) serveConn(conn net.Conn) {
+	dst, err := s.originalDst(conn)
+	if err != nil {
+		log.Printf("[transparent] %s: %v", conn.RemoteAddr(), err)
+		reset(conn)
+		return
+	}
+
+	// Connections made to the listener itself were not redirected, and
+	// dialing their destination would loop
+	if local, ok := conn.LocalAddr().(*net.TCPAddr); ok && local.AddrPort() == dst {
+		reset(conn)
+		return
+	}
+
+	conn.SetReadDeadline(time.Now().Add(peekTimeout))
+	peeked, req := peek(conn, dst)
+	conn.SetReadDeadline(time.Time{})
+
+	// The destination address is known, so "ip:" rules always apply to it
+	// without a lookup, whatever server name the client sends
+	req.Addrs = []netip.Addr{dst.Addr().Unmap()}
+	decision := s.handler.blocker.CheckRequest(req)
+	if decision.Blocked {
+		reset(conn)
+		return
+	}
+
+	// Always dial the original destination, never the name the client sent
+	ctx, cancel := context.WithTimeout(context.Background(), peekTimeout)
+	destConn, err := s.handler.dialer.DialContext(ctx, "tcp", dst.String())
+	cancel()
+	if err != nil {
+		reset(conn)
+		return
+	}
+	if _, err := destConn.Write(peeked); err != nil {
+		destConn.Close()
+		reset(conn)
+		return
+	}
+
+	s.handler.tunnel(conn, destConn, decision)
+}
+
+// peek reads the start of a connection until it reveals the host the client
+// wants, and returns the bytes read and the request to check. Without a
+// host name, the destination address is checked instead.
+func peek(conn net.Conn, dst netip.AddrPort) ([]byte, blocker.Request) {
+	port := strconv.Itoa(int(dst.Port()))
+	req := blocker.Request{
+		Host:   dst.Addr().Unmap().String(),
+		Port:   port,
+		Method: http.MethodConnect,
+	}
+
+	buf := make([]byte, 0, 4096)
+	for len(buf) < maxPeekSize {
+		if len(buf) == cap(buf) {
+			buf = append(buf, make([]byte, cap(buf))...)[:len(buf)]
+		}
+		n, err := conn.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+
+		if name, done := peekServerName(buf); done {
+			if name != "" {
+				req.Host = name
+			}
+			return buf, req
+		}
+		if r, done := peekHTTPRequest(buf); done {
+			if r != nil && r.Host != "" {
+				req.Host = r.Host
+				req.Method = r.Method
+				req.Path = blocker.RequestPath(r.URL)
+			}
+			return buf, req
+		}
+		if err != nil {
+			break
+		}
+	}
+	return buf, req
+}
+
+// peekServerName returns the TLS server name in buf, or "" if there is none.
+// done is false while more data is needed.
+func peekServerName(buf []byte) (name string, done bool) {
+	name, err := sni.ServerName(buf)
+	switch {
+	case err == nil:
+		return name, true
+	case errors.Is(err, sni.ErrIncomplete):
+		return "", false
+	case errors.Is(err, sni.ErrNotTLS):
+		if len(buf) < 3 {
+			return "", false // Could still be TLS
+		}
+		return "", !mayBeHTTP(buf)
+	default:
+		return "", true
+	}
+}
+
+// peekHTTPRequest parses the plain HTTP request header in buf, returning nil
+// if it cannot be parsed. done is false while more data is needed.
+func peekHTTPRequest(buf []byte) (r *http.Request, done bool) {
+	if !mayBeHTTP(buf) {
+		return nil, false
+	}
+	if !bytes.Contains(buf, []byte("\r\n\r\n")) {
+		return nil, false
+	}
+	r, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(buf)))
+	if err != nil {
+		return nil, true
+	}
+	return r, true
+}
+
+// mayBeHTTP reports whether buf starts with, or is the start of, an HTTP
+// request line
+func mayBeHTTP(buf []byte) bool {
+	if len(buf) == 0 {
+		return false
+	}
+	for _, prefix := range httpMethodPrefixes {
+		n := min(len(buf), len(prefix))
+		if strings.HasPrefix(prefix, string(buf[:n])) {
+			return true
+		}
+	}
+	return false
+}
+
+// reset closes a connection with a TCP reset, so the client fails fast
+func reset(conn net.Conn) {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	conn.Close()
+}
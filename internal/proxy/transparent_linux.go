@@ -0,0 +1,65 @@
+//go:build linux
+
+package proxy
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"net/netip"
+
+	"golang.org/x/sys/unix"
+)
+
+// TransparentSupported reports whether transparent mode works on this platform
+const TransparentSupported = true
+
+// ip6tSOOriginalDst is IP6T_SO_ORIGINAL_DST from linux/netfilter_ipv6/ip6_tables.h
+const ip6tSOOriginalDst = 80
+
+// originalDst returns the destination a connection had before netfilter
+// redirected it to us
+func originalDst(conn net.Conn) (netip.AddrPort, error) {
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return netip.AddrPort{}, fmt.Errorf("not a TCP connection")
+	}
+	raw, err := tcp.SyscallConn()
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	local, _ := conn.LocalAddr().(*net.TCPAddr)
+
+	var dst netip.AddrPort
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		if local != nil && local.IP.To4() != nil {
+			// The option fills a sockaddr_in, which fits this 16 byte struct
+			mreq, err := unix.GetsockoptIPv6Mreq(int(fd), unix.IPPROTO_IP, unix.SO_ORIGINAL_DST)
+			if err != nil {
+				sockErr = err
+				return
+			}
+			addr := netip.AddrFrom4([4]byte(mreq.Multiaddr[4:8]))
+			dst = netip.AddrPortFrom(addr, binary.BigEndian.Uint16(mreq.Multiaddr[2:4]))
+			return
+		}
+
+		// The option fills a sockaddr_in6, which starts this struct
+		info, err := unix.GetsockoptIPv6MTUInfo(int(fd), unix.IPPROTO_IPV6, ip6tSOOriginalDst)
+		if err != nil {
+			sockErr = err
+			return
+		}
+		var port [2]byte
+		binary.NativeEndian.PutUint16(port[:], info.Addr.Port)
+		dst = netip.AddrPortFrom(netip.AddrFrom16(info.Addr.Addr), binary.BigEndian.Uint16(port[:]))
+	})
+	if err == nil {
+		err = sockErr
+	}
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("failed to get original destination: %w", err)
+	}
+	return dst, nil
+}
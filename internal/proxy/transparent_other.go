@@ -0,0 +1,16 @@
+//go:build !linux
+
+package proxy
+
+import (
+	"net"
+	"net/netip"
+)
+
+// TransparentSupported reports whether transparent mode works on this platform
+const TransparentSupported = false
+
+// originalDst is not available without netfilter
+func originalDst(conn net.Conn) (netip.AddrPort, error) {
+	return netip.AddrPort{}, errTransparentUnsupported
+}
@@ -0,0 +1,128 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/user/blocker/internal/blocker"
+)
+
+// newTestTransparent starts a transparent server that treats every
+// connection as redirected from dst
+func newTestTransparent(t *testing.T, rs blocker.Ruleset, dst *net.TCPAddr) (*blocker.Blocker, string) {
+	t.Helper()
+
+	b := blocker.New()
+	b.Apply(rs)
+
+	s := NewTransparentServer("127.0.0.1", 0, b)
+	s.originalDst = func(net.Conn) (netip.AddrPort, error) {
+		return dst.AddrPort(), nil
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { s.Stop() })
+	return b, l.Addr().String()
+}
+
+// tlsClientHello returns the first flight of a TLS client asking for serverName
+func tlsClientHello(t *testing.T, serverName string) []byte {
+	t.Helper()
+
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		tls.Client(client, &tls.Config{ServerName: serverName}).Handshake()
+		client.Close()
+	}()
+
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(server, header); err != nil {
+		t.Fatal(err)
+	}
+	record := make([]byte, binary.BigEndian.Uint16(header[3:]))
+	if _, err := io.ReadFull(server, record); err != nil {
+		t.Fatal(err)
+	}
+	return append(header, record...)
+}
+
+// roundTrip sends data through the transparent server and returns what the
+// echoing destination sent back, or nil if the connection was reset
+func roundTrip(t *testing.T, addr string, data []byte) []byte {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	conn.Write(data)
+	buf := make([]byte, len(data))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return nil
+	}
+	return buf
+}
+
+func TestTransparent(t *testing.T) {
+	echo := newEchoServer(t)
+	b, addr := newTestTransparent(t, blocker.Ruleset{
+		Blacklist: []string{"blocked.test", "allowed.test/private/"},
+	}, echo)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		domain  string
+		blocked bool
+	}{
+		{"TLS allowed", tlsClientHello(t, "allowed.test"), "allowed.test", false},
+		{"TLS blocked", tlsClientHello(t, "www.blocked.test"), "www.blocked.test", true},
+		{"HTTP allowed", []byte("GET / HTTP/1.1\r\nHost: allowed.test\r\n\r\n"), "allowed.test", false},
+		{"HTTP blocked", []byte("GET / HTTP/1.1\r\nHost: blocked.test\r\n\r\n"), "blocked.test", true},
+		{"HTTP path", []byte("GET /private/x HTTP/1.1\r\nHost: allowed.test\r\n\r\n"), "allowed.test", true},
+		{"other protocol", []byte("SSH-2.0-OpenSSH_9.6\r\n"), "127.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		got := roundTrip(t, addr, tt.data)
+		if blocked := got == nil; blocked != tt.blocked {
+			t.Errorf("%s: blocked = %v, want %v", tt.name, blocked, tt.blocked)
+		} else if !tt.blocked && string(got) != string(tt.data) {
+			t.Errorf("%s: destination received %q, want %q", tt.name, got, tt.data)
+		}
+
+		if d := b.RecentDecisions()[0]; d.Domain != tt.domain || d.Blocked != tt.blocked {
+			t.Errorf("%s: decision = %s blocked %v, want %s blocked %v", tt.name, d.Domain, d.Blocked, tt.domain, tt.blocked)
+		}
+	}
+}
+
+func TestTransparentIPRules(t *testing.T) {
+	echo := newEchoServer(t)
+
+	// The server name is allowed, but the destination address is not, with
+	// or without resolve_ips
+	for _, resolve := range []bool{true, false} {
+		_, addr := newTestTransparent(t, blocker.Ruleset{
+			Blacklist:  []string{"ip:127.0.0.0/8"},
+			ResolveIPs: resolve,
+		}, echo)
+
+		if got := roundTrip(t, addr, tlsClientHello(t, "allowed.test")); got != nil {
+			t.Errorf("resolve_ips %v: connection to a blocked address was spliced", resolve)
+		}
+	}
+}
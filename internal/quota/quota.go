@@ -0,0 +1,324 @@
+package quota
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the usage file, stored next to the config file
+const FileName = "usage.yaml"
+
+// VisitGap is how long a pattern must be idle before new activity counts
+// as a new visit. Browsers open many connections per page, so counting
+// every connection would exhaust a visit budget immediately.
+const VisitGap = 5 * time.Minute
+
+// dayFormat identifies the day usage is accounted for
+const dayFormat = "2006-01-02"
+
+// Limit is a daily budget; zero values mean unlimited
+type Limit struct {
+	Time   time.Duration `json:"time"`
+	Visits int           `json:"visits"`
+}
+
+// Usage reports the usage of a quota pattern for the current day
+type Usage struct {
+	Pattern string        `json:"pattern"`
+	Used    time.Duration `json:"used"`
+	Visits  int           `json:"visits"`
+	Limit   Limit         `json:"limit"`
+}
+
+// Remaining returns the time left in the budget (0 if there is no time limit)
+func (u Usage) Remaining() time.Duration {
+	if u.Limit.Time <= 0 || u.Used >= u.Limit.Time {
+		return 0
+	}
+	return u.Limit.Time - u.Used
+}
+
+// usage tracks the usage of a single pattern
+type usage struct {
+	used   time.Duration // Time accounted for finished activity
+	visits int
+	active int       // Number of open connections
+	since  time.Time // When the current activity started
+	last   time.Time // When activity was last seen
+}
+
+// Tracker accounts daily usage per quota pattern and persists it to disk.
+// Overlapping connections for the same pattern are only counted once.
+type Tracker struct {
+	path   string
+	now    func() time.Time
+	day    string
+	limits map[string]Limit
+	usage  map[string]*usage
+	mu     sync.Mutex
+}
+
+// fileData is the on-disk representation of a day's usage
+type fileData struct {
+	Day   string               `yaml:"day"`
+	Usage map[string]fileUsage `yaml:"usage"`
+}
+
+// fileUsage is the on-disk usage of a single pattern
+type fileUsage struct {
+	Time   time.Duration `yaml:"time"`
+	Visits int           `yaml:"visits"`
+}
+
+// Path returns the usage file path for a config file
+func Path(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), FileName)
+}
+
+// NewTracker creates a new usage tracker persisting to path
+func NewTracker(path string) *Tracker {
+	return &Tracker{
+		path:   path,
+		now:    time.Now,
+		limits: make(map[string]Limit),
+		usage:  make(map[string]*usage),
+	}
+}
+
+// SetClock replaces the clock used for accounting (for testing)
+func (t *Tracker) SetClock(now func() time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.now = now
+}
+
+// SetLimits replaces the daily limits by pattern
+func (t *Tracker) SetLimits(limits map[string]Limit) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.limits = limits
+}
+
+// Load reads today's usage from disk. A missing file or a file from
+// another day yields empty usage.
+func (t *Tracker) Load() error {
+	data, err := os.ReadFile(t.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read usage file: %w", err)
+	}
+
+	var fd fileData
+	if err := yaml.Unmarshal(data, &fd); err != nil {
+		return fmt.Errorf("failed to parse usage file: %w", err)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.rollover(t.now())
+	if fd.Day != t.day {
+		return nil
+	}
+
+	for pattern, fu := range fd.Usage {
+		u := t.get(pattern)
+		u.used = fu.Time
+		u.visits = fu.Visits
+	}
+	return nil
+}
+
+// Save writes today's usage to disk
+func (t *Tracker) Save() error {
+	t.mu.Lock()
+	now := t.now()
+	t.rollover(now)
+
+	fd := fileData{
+		Day:   t.day,
+		Usage: make(map[string]fileUsage, len(t.usage)),
+	}
+	for pattern, u := range t.usage {
+		fd.Usage[pattern] = fileUsage{Time: u.total(now), Visits: u.visits}
+	}
+	t.mu.Unlock()
+
+	data, err := yaml.Marshal(fd)
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage: %w", err)
+	}
+
+	return os.WriteFile(t.path, data, 0644)
+}
+
+// Begin records the start of activity for a pattern and returns a function
+// that must be called when the activity ends
+func (t *Tracker) Begin(pattern string) (end func()) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.rollover(now)
+
+	u := t.get(pattern)
+	if u.active == 0 {
+		if u.last.IsZero() || now.Sub(u.last) >= VisitGap {
+			u.visits++
+		}
+		u.since = now
+	}
+	u.active++
+	u.last = now
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			t.end(pattern)
+		})
+	}
+}
+
+// end records the end of activity for a pattern
+func (t *Tracker) end(pattern string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.rollover(now)
+
+	u := t.get(pattern)
+	if u.active == 0 {
+		return
+	}
+	u.active--
+	u.last = now
+	if u.active == 0 {
+		u.used += now.Sub(u.since)
+	}
+}
+
+// Exhausted reports whether the daily budget of a pattern is used up.
+// An exhausted visit budget still allows activity that belongs to the
+// current visit.
+func (t *Tracker) Exhausted(pattern string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	limit, ok := t.limits[pattern]
+	if !ok {
+		return false
+	}
+
+	now := t.now()
+	t.rollover(now)
+	u := t.get(pattern)
+
+	if limit.Time > 0 && u.total(now) >= limit.Time {
+		return true
+	}
+	if limit.Visits > 0 && u.visits >= limit.Visits {
+		inVisit := u.active > 0 || (!u.last.IsZero() && now.Sub(u.last) < VisitGap)
+		return !inVisit
+	}
+	return false
+}
+
+// Remaining returns the time left in the daily time budget of a pattern.
+// ok is false if the pattern has no time limit.
+func (t *Tracker) Remaining(pattern string) (left time.Duration, ok bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	limit, ok := t.limits[pattern]
+	if !ok || limit.Time <= 0 {
+		return 0, false
+	}
+
+	now := t.now()
+	t.rollover(now)
+	return Usage{Used: t.get(pattern).total(now), Limit: limit}.Remaining(), true
+}
+
+// Usage returns today's usage for every pattern with a limit, sorted by pattern
+func (t *Tracker) Usage() []Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.rollover(now)
+
+	result := make([]Usage, 0, len(t.limits))
+	for pattern, limit := range t.limits {
+		u := t.get(pattern)
+		result = append(result, Usage{
+			Pattern: pattern,
+			Used:    u.total(now),
+			Visits:  u.visits,
+			Limit:   limit,
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Pattern < result[j].Pattern
+	})
+	return result
+}
+
+// LoadUsage reads the usage file and reports it against the given limits,
+// for use when no tracker is running
+func LoadUsage(path string, limits map[string]Limit) ([]Usage, error) {
+	t := NewTracker(path)
+	t.SetLimits(limits)
+	if err := t.Load(); err != nil {
+		return nil, err
+	}
+	return t.Usage(), nil
+}
+
+// rollover resets usage when the day changes. Ongoing activity is counted
+// for the new day from midnight.
+func (t *Tracker) rollover(now time.Time) {
+	day := now.Format(dayFormat)
+	if day == t.day {
+		return
+	}
+
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for pattern, u := range t.usage {
+		if u.active == 0 {
+			delete(t.usage, pattern)
+			continue
+		}
+		u.used = 0
+		u.visits = 1
+		u.since = midnight
+	}
+	t.day = day
+}
+
+// get returns the usage of a pattern, creating it if needed
+func (t *Tracker) get(pattern string) *usage {
+	u, ok := t.usage[pattern]
+	if !ok {
+		u = &usage{}
+		t.usage[pattern] = u
+	}
+	return u
+}
+
+// total returns the accounted time including ongoing activity
+func (u *usage) total(now time.Time) time.Duration {
+	if u.active > 0 {
+		return u.used + now.Sub(u.since)
+	}
+	return u.used
+}
@@ -0,0 +1,116 @@
+package quota
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTimeQuota(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2024-01-08T10:00:00Z")
+
+	tr := NewTracker(filepath.Join(t.TempDir(), FileName))
+	tr.SetClock(func() time.Time { return now })
+	tr.SetLimits(map[string]Limit{"youtube.com": {Time: 30 * time.Minute}})
+
+	// Two overlapping connections count once
+	end1 := tr.Begin("youtube.com")
+	now = now.Add(10 * time.Minute)
+	end2 := tr.Begin("youtube.com")
+	now = now.Add(10 * time.Minute)
+	end1()
+	now = now.Add(5 * time.Minute)
+	end2()
+
+	usage := tr.Usage()
+	if len(usage) != 1 || usage[0].Used != 25*time.Minute {
+		t.Fatalf("Usage() = %+v, want 25m used", usage)
+	}
+	if tr.Exhausted("youtube.com") {
+		t.Error("Exhausted() = true with 5m left")
+	}
+	if left, ok := tr.Remaining("youtube.com"); !ok || left != 5*time.Minute {
+		t.Errorf("Remaining() = %v, %v, want 5m", left, ok)
+	}
+	if _, ok := tr.Remaining("example.com"); ok {
+		t.Error("Remaining() of a pattern without a limit is ok")
+	}
+
+	end := tr.Begin("youtube.com")
+	now = now.Add(5 * time.Minute)
+	if !tr.Exhausted("youtube.com") {
+		t.Error("Exhausted() = false during activity past the limit")
+	}
+	end()
+
+	// Budget resets the next day
+	now = now.Add(24 * time.Hour)
+	if tr.Exhausted("youtube.com") {
+		t.Error("Exhausted() = true on the next day")
+	}
+}
+
+func TestVisitQuota(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2024-01-08T10:00:00Z")
+
+	tr := NewTracker(filepath.Join(t.TempDir(), FileName))
+	tr.SetClock(func() time.Time { return now })
+	tr.SetLimits(map[string]Limit{"news.ycombinator.com": {Visits: 2}})
+
+	for i := 0; i < 2; i++ {
+		// Several connections within one visit
+		tr.Begin("news.ycombinator.com")()
+		now = now.Add(time.Minute)
+		tr.Begin("news.ycombinator.com")()
+		now = now.Add(VisitGap)
+	}
+
+	if got := tr.Usage()[0].Visits; got != 2 {
+		t.Errorf("Visits = %d, want 2", got)
+	}
+	if !tr.Exhausted("news.ycombinator.com") {
+		t.Error("Exhausted() = false after 2 of 2 visits")
+	}
+}
+
+func TestTrackerPersistence(t *testing.T) {
+	now, _ := time.Parse(time.RFC3339, "2024-01-08T10:00:00Z")
+	path := filepath.Join(t.TempDir(), FileName)
+	limits := map[string]Limit{"youtube.com": {Time: 30 * time.Minute, Visits: 5}}
+
+	tr := NewTracker(path)
+	tr.SetClock(func() time.Time { return now })
+	tr.SetLimits(limits)
+
+	end := tr.Begin("youtube.com")
+	now = now.Add(12 * time.Minute)
+	end()
+
+	if err := tr.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded := NewTracker(path)
+	loaded.SetClock(func() time.Time { return now })
+	loaded.SetLimits(limits)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	usage := loaded.Usage()
+	if len(usage) != 1 || usage[0].Used != 12*time.Minute || usage[0].Visits != 1 {
+		t.Fatalf("Usage() = %+v, want 12m and 1 visit", usage)
+	}
+	if usage[0].Remaining() != 18*time.Minute {
+		t.Errorf("Remaining() = %v, want 18m", usage[0].Remaining())
+	}
+
+	// Usage from another day is ignored
+	now = now.Add(24 * time.Hour)
+	if err := loaded.Load(); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := loaded.Usage()[0].Used; got != 0 {
+		t.Errorf("Used on the next day = %v, want 0", got)
+	}
+}
@@ -0,0 +1,189 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxLookahead bounds the search for the next transition
+const maxLookahead = 8 * 24 * time.Hour
+
+// dayNames maps day abbreviations to weekdays
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Schedule describes recurring weekly time windows
+type Schedule struct {
+	days   [7]bool
+	ranges []timeRange
+	loc    *time.Location
+}
+
+// timeRange is a daily window in minutes since midnight.
+// If end <= start the window wraps past midnight into the next day.
+type timeRange struct {
+	start int
+	end   int
+}
+
+// Parse creates a schedule from day and time range specs.
+//
+// Days are abbreviations like "mon" or ranges like "mon-fri"; no days means
+// every day. Times are ranges like "09:00-17:30" or "22:00-02:00"; no times
+// means all day. An empty timezone means local time.
+func Parse(days, times []string, timezone string) (*Schedule, error) {
+	s := &Schedule{loc: time.Local}
+
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", timezone, err)
+		}
+		s.loc = loc
+	}
+
+	if len(days) == 0 {
+		for i := range s.days {
+			s.days[i] = true
+		}
+	}
+	for _, spec := range days {
+		if err := s.addDays(spec); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(times) == 0 {
+		s.ranges = []timeRange{{start: 0, end: 24 * 60}}
+	}
+	for _, spec := range times {
+		r, err := parseRange(spec)
+		if err != nil {
+			return nil, err
+		}
+		s.ranges = append(s.ranges, r)
+	}
+
+	return s, nil
+}
+
+// addDays enables a single day or a day range like "mon-fri"
+func (s *Schedule) addDays(spec string) error {
+	spec = strings.ToLower(strings.TrimSpace(spec))
+
+	from, to, isRange := strings.Cut(spec, "-")
+	start, ok := dayNames[from]
+	if !ok {
+		return fmt.Errorf("invalid day %q", spec)
+	}
+	end := start
+	if isRange {
+		if end, ok = dayNames[to]; !ok {
+			return fmt.Errorf("invalid day %q", spec)
+		}
+	}
+
+	for d := start; ; d = (d + 1) % 7 {
+		s.days[d] = true
+		if d == end {
+			break
+		}
+	}
+	return nil
+}
+
+// parseRange parses a time range like "09:00-17:30"
+func parseRange(spec string) (timeRange, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(spec), "-")
+	if !ok {
+		return timeRange{}, fmt.Errorf("invalid time range %q: expected HH:MM-HH:MM", spec)
+	}
+
+	start, err := parseClock(from)
+	if err != nil {
+		return timeRange{}, fmt.Errorf("invalid time range %q: %w", spec, err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return timeRange{}, fmt.Errorf("invalid time range %q: %w", spec, err)
+	}
+	if start == end {
+		return timeRange{}, fmt.Errorf("invalid time range %q: start equals end", spec)
+	}
+
+	return timeRange{start: start, end: end}, nil
+}
+
+// parseClock parses "HH:MM" into minutes since midnight ("24:00" is allowed)
+func parseClock(s string) (int, error) {
+	hh, mm, ok := strings.Cut(strings.TrimSpace(s), ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+
+	h, err := strconv.Atoi(hh)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	m, err := strconv.Atoi(mm)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	if h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+
+	return h*60 + m, nil
+}
+
+// Active reports whether t falls inside the schedule
+func (s *Schedule) Active(t time.Time) bool {
+	t = t.In(s.loc)
+	day := t.Weekday()
+	prev := (day + 6) % 7
+	minute := t.Hour()*60 + t.Minute()
+
+	for _, r := range s.ranges {
+		if r.start < r.end {
+			if s.days[day] && minute >= r.start && minute < r.end {
+				return true
+			}
+			continue
+		}
+
+		// Overnight window: started today or continues from yesterday
+		if s.days[day] && minute >= r.start {
+			return true
+		}
+		if s.days[prev] && minute < r.end {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NextTransition returns the next time after t at which the schedule becomes
+// active or inactive, or the zero time if it never changes
+func (s *Schedule) NextTransition(t time.Time) time.Time {
+	current := s.Active(t)
+	start := t.Truncate(time.Minute)
+
+	for d := time.Minute; d <= maxLookahead; d += time.Minute {
+		next := start.Add(d)
+		if s.Active(next) != current {
+			return next
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,110 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleActive(t *testing.T) {
+	s, err := Parse([]string{"mon-fri"}, []string{"09:00-17:30"}, "UTC")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		time     string
+		expected bool
+	}{
+		{"2024-01-08T09:00:00Z", true},  // Monday
+		{"2024-01-08T17:29:59Z", true},  // Monday
+		{"2024-01-08T17:30:00Z", false}, // Monday, end is exclusive
+		{"2024-01-08T08:59:00Z", false}, // Monday
+		{"2024-01-12T12:00:00Z", true},  // Friday
+		{"2024-01-13T12:00:00Z", false}, // Saturday
+		{"2024-01-14T12:00:00Z", false}, // Sunday
+	}
+
+	for _, tt := range tests {
+		ts, _ := time.Parse(time.RFC3339, tt.time)
+		if got := s.Active(ts); got != tt.expected {
+			t.Errorf("Active(%s) = %v, want %v", tt.time, got, tt.expected)
+		}
+	}
+}
+
+func TestScheduleOvernight(t *testing.T) {
+	s, err := Parse([]string{"fri"}, []string{"22:00-02:00"}, "UTC")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		time     string
+		expected bool
+	}{
+		{"2024-01-12T21:59:00Z", false}, // Friday
+		{"2024-01-12T23:00:00Z", true},  // Friday
+		{"2024-01-13T01:59:00Z", true},  // Saturday, continues from Friday
+		{"2024-01-13T02:00:00Z", false}, // Saturday
+		{"2024-01-13T23:00:00Z", false}, // Saturday
+		{"2024-01-12T01:00:00Z", false}, // Friday, Thursday not scheduled
+	}
+
+	for _, tt := range tests {
+		ts, _ := time.Parse(time.RFC3339, tt.time)
+		if got := s.Active(ts); got != tt.expected {
+			t.Errorf("Active(%s) = %v, want %v", tt.time, got, tt.expected)
+		}
+	}
+}
+
+func TestScheduleNextTransition(t *testing.T) {
+	s, err := Parse([]string{"mon-fri"}, []string{"09:00-17:30"}, "UTC")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		time     string
+		expected string
+	}{
+		{"2024-01-08T12:00:30Z", "2024-01-08T17:30:00Z"}, // Monday, active
+		{"2024-01-08T18:00:00Z", "2024-01-09T09:00:00Z"}, // Monday evening
+		{"2024-01-12T18:00:00Z", "2024-01-15T09:00:00Z"}, // Friday evening -> Monday
+	}
+
+	for _, tt := range tests {
+		ts, _ := time.Parse(time.RFC3339, tt.time)
+		want, _ := time.Parse(time.RFC3339, tt.expected)
+		if got := s.NextTransition(ts); !got.Equal(want) {
+			t.Errorf("NextTransition(%s) = %s, want %s", tt.time, got.UTC().Format(time.RFC3339), tt.expected)
+		}
+	}
+
+	always, _ := Parse(nil, nil, "UTC")
+	if got := always.NextTransition(time.Now()); !got.IsZero() {
+		t.Errorf("NextTransition() of always-active schedule = %v, want zero", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		days     []string
+		times    []string
+		timezone string
+	}{
+		{[]string{"funday"}, nil, ""},
+		{[]string{"mon-xyz"}, nil, ""},
+		{nil, []string{"9-17"}, ""},
+		{nil, []string{"09:00"}, ""},
+		{nil, []string{"25:00-26:00"}, ""},
+		{nil, []string{"09:00-09:00"}, ""},
+		{nil, nil, "Mars/Olympus"},
+	}
+
+	for _, tt := range tests {
+		if _, err := Parse(tt.days, tt.times, tt.timezone); err == nil {
+			t.Errorf("Parse(%v, %v, %q) succeeded, want error", tt.days, tt.times, tt.timezone)
+		}
+	}
+}
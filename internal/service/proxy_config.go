@@ -9,6 +9,10 @@ import (
 type ProxyConfig struct {
 	Host string
 	Port int
+
+	// PACURL, if set, is registered as the auto proxy configuration URL
+	// instead of Host and Port
+	PACURL string
 }
 
 // NewProxyConfig creates a new ProxyConfig instance
@@ -50,6 +50,10 @@ func getNetworkServices() ([]string, error) {
 
 // enableDarwin enables the system proxy on macOS
 func (p *ProxyConfig) enableDarwin() error {
+	if p.PACURL != "" {
+		return p.enablePACDarwin()
+	}
+
 	services, err := getNetworkServices()
 	if err != nil {
 		return err
@@ -87,6 +91,10 @@ func (p *ProxyConfig) enableDarwin() error {
 		cmd = exec.Command("networksetup", "-setsecurewebproxystate", service, "on")
 		cmd.Run()
 
+		// Turn off a PAC URL from a previous install
+		cmd = exec.Command("networksetup", "-setautoproxystate", service, "off")
+		cmd.Run()
+
 		fmt.Printf("Configured proxy for: %s\n", service)
 		successCount++
 	}
@@ -98,6 +106,46 @@ func (p *ProxyConfig) enableDarwin() error {
 	return nil
 }
 
+// enablePACDarwin registers the PAC URL on macOS and turns off the fixed proxy
+func (p *ProxyConfig) enablePACDarwin() error {
+	services, err := getNetworkServices()
+	if err != nil {
+		return err
+	}
+
+	successCount := 0
+
+	for _, service := range services {
+		// Set the auto proxy URL
+		cmd := exec.Command("networksetup", "-setautoproxyurl", service, p.PACURL)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			if !strings.Contains(string(output), "not supported") {
+				fmt.Printf("Warning: failed to set auto proxy URL for %s: %v\n", service, err)
+			}
+			continue
+		}
+
+		// Enable auto proxy
+		cmd = exec.Command("networksetup", "-setautoproxystate", service, "on")
+		cmd.Run()
+
+		// The fixed proxy would take precedence for every host
+		cmd = exec.Command("networksetup", "-setwebproxystate", service, "off")
+		cmd.Run()
+		cmd = exec.Command("networksetup", "-setsecurewebproxystate", service, "off")
+		cmd.Run()
+
+		fmt.Printf("Configured auto proxy for: %s\n", service)
+		successCount++
+	}
+
+	if successCount == 0 {
+		return fmt.Errorf("failed to configure auto proxy for any network service")
+	}
+
+	return nil
+}
+
 // disableDarwin disables the system proxy on macOS
 func (p *ProxyConfig) disableDarwin() error {
 	services, err := getNetworkServices()
@@ -117,6 +165,12 @@ func (p *ProxyConfig) disableDarwin() error {
 		if err := cmd.Run(); err != nil {
 			fmt.Printf("Warning: failed to disable HTTPS proxy for %s: %v\n", service, err)
 		}
+
+		// Disable auto proxy, in case the PAC URL was registered
+		cmd = exec.Command("networksetup", "-setautoproxystate", service, "off")
+		if err := cmd.Run(); err != nil {
+			fmt.Printf("Warning: failed to disable auto proxy for %s: %v\n", service, err)
+		}
 	}
 
 	return nil
@@ -132,6 +186,21 @@ func (p *ProxyConfig) isEnabledDarwin() (bool, error) {
 	expectedAddr := fmt.Sprintf("%s:%d", p.Host, p.Port)
 
 	for _, service := range services {
+		if p.PACURL != "" {
+			cmd := exec.Command("networksetup", "-getautoproxyurl", service)
+			output, err := cmd.Output()
+			if err != nil {
+				continue
+			}
+
+			outputStr := string(output)
+			if strings.Contains(outputStr, "Enabled: Yes") &&
+				strings.Contains(outputStr, fmt.Sprintf("URL: %s", p.PACURL)) {
+				return true, nil
+			}
+			continue
+		}
+
 		// Check HTTP proxy
 		cmd := exec.Command("networksetup", "-getwebproxy", service)
 		output, err := cmd.Output()
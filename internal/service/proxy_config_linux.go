@@ -0,0 +1,31 @@
+//go:build linux
+
+package service
+
+import "fmt"
+
+// Darwin and Windows stubs for linux build. Linux has no system-wide proxy
+// setting; apps are configured directly or caught by transparent mode.
+func (p *ProxyConfig) enableDarwin() error {
+	return fmt.Errorf("macOS not supported on this platform")
+}
+
+func (p *ProxyConfig) disableDarwin() error {
+	return fmt.Errorf("macOS not supported on this platform")
+}
+
+func (p *ProxyConfig) isEnabledDarwin() (bool, error) {
+	return false, fmt.Errorf("macOS not supported on this platform")
+}
+
+func (p *ProxyConfig) enableWindows() error {
+	return fmt.Errorf("Windows not supported on this platform")
+}
+
+func (p *ProxyConfig) disableWindows() error {
+	return fmt.Errorf("Windows not supported on this platform")
+}
+
+func (p *ProxyConfig) isEnabledWindows() (bool, error) {
+	return false, fmt.Errorf("Windows not supported on this platform")
+}
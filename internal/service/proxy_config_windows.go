@@ -31,6 +31,15 @@ func (p *ProxyConfig) enableWindows() error {
 	}
 	defer key.Close()
 
+	if p.PACURL != "" {
+		return p.enablePACWindows(key)
+	}
+
+	// A PAC URL from a previous install would take precedence
+	if err := deleteValue(key, "AutoConfigURL"); err != nil {
+		return err
+	}
+
 	// Set proxy server address
 	proxyServer := fmt.Sprintf("%s:%d", p.Host, p.Port)
 	if err := key.SetStringValue("ProxyServer", proxyServer); err != nil {
@@ -54,6 +63,31 @@ func (p *ProxyConfig) enableWindows() error {
 	return nil
 }
 
+// enablePACWindows registers the PAC URL on Windows and turns off the fixed proxy
+func (p *ProxyConfig) enablePACWindows(key registry.Key) error {
+	if err := key.SetStringValue("AutoConfigURL", p.PACURL); err != nil {
+		return fmt.Errorf("failed to set AutoConfigURL: %w", err)
+	}
+
+	// The fixed proxy would take precedence for every host
+	if err := key.SetDWordValue("ProxyEnable", 0); err != nil {
+		return fmt.Errorf("failed to disable proxy: %w", err)
+	}
+
+	// Notify the system that proxy settings have changed
+	notifyProxyChange()
+
+	return nil
+}
+
+// deleteValue deletes a registry value that may not exist
+func deleteValue(key registry.Key, name string) error {
+	if err := key.DeleteValue(name); err != nil && err != registry.ErrNotExist {
+		return fmt.Errorf("failed to delete %s: %w", name, err)
+	}
+	return nil
+}
+
 // disableWindows disables the system proxy on Windows
 func (p *ProxyConfig) disableWindows() error {
 	key, err := registry.OpenKey(registry.CURRENT_USER, internetSettingsKey, registry.SET_VALUE)
@@ -67,6 +101,11 @@ func (p *ProxyConfig) disableWindows() error {
 		return fmt.Errorf("failed to disable proxy: %w", err)
 	}
 
+	// Remove the PAC URL, in case it was registered
+	if err := deleteValue(key, "AutoConfigURL"); err != nil {
+		return err
+	}
+
 	// Notify the system that proxy settings have changed
 	notifyProxyChange()
 
@@ -81,6 +120,14 @@ func (p *ProxyConfig) isEnabledWindows() (bool, error) {
 	}
 	defer key.Close()
 
+	if p.PACURL != "" {
+		url, _, err := key.GetStringValue("AutoConfigURL")
+		if err != nil {
+			return false, nil
+		}
+		return url == p.PACURL, nil
+	}
+
 	// Check if proxy is enabled
 	proxyEnable, _, err := key.GetIntegerValue("ProxyEnable")
 	if err != nil {
@@ -0,0 +1,55 @@
+//go:build linux
+
+package service
+
+import "fmt"
+
+// Darwin and Windows stubs for linux build. Running the service is left to
+// the init system, e.g. a systemd unit calling "blocker run".
+func (s *Service) installDarwin() error {
+	return fmt.Errorf("macOS not supported on this platform")
+}
+
+func (s *Service) uninstallDarwin() error {
+	return fmt.Errorf("macOS not supported on this platform")
+}
+
+func (s *Service) startDarwin() error {
+	return fmt.Errorf("macOS not supported on this platform")
+}
+
+func (s *Service) stopDarwin() error {
+	return fmt.Errorf("macOS not supported on this platform")
+}
+
+func (s *Service) statusDarwin() (string, error) {
+	return "", fmt.Errorf("macOS not supported on this platform")
+}
+
+func (s *Service) isInstalledDarwin() bool {
+	return false
+}
+
+func (s *Service) installWindows() error {
+	return fmt.Errorf("Windows not supported on this platform")
+}
+
+func (s *Service) uninstallWindows() error {
+	return fmt.Errorf("Windows not supported on this platform")
+}
+
+func (s *Service) startWindows() error {
+	return fmt.Errorf("Windows not supported on this platform")
+}
+
+func (s *Service) stopWindows() error {
+	return fmt.Errorf("Windows not supported on this platform")
+}
+
+func (s *Service) statusWindows() (string, error) {
+	return "", fmt.Errorf("Windows not supported on this platform")
+}
+
+func (s *Service) isInstalledWindows() bool {
+	return false
+}
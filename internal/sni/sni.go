@@ -0,0 +1,237 @@
+package sni
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// TLS constants from RFC 8446 and RFC 6066
+const (
+	recordHeaderSize    = 5
+	recordTypeHandshake = 0x16
+	maxRecordSize       = 1<<14 + 2048 // Largest record payload a peer may send
+
+	handshakeHeaderSize  = 4
+	handshakeClientHello = 0x01
+	maxHelloSize         = 1 << 16
+
+	extensionServerName = 0x0000
+	nameTypeHostName    = 0x00
+	maxHostNameLen      = 255
+)
+
+var (
+	// ErrIncomplete means data ends before the ClientHello does; read more and retry
+	ErrIncomplete = errors.New("incomplete ClientHello")
+
+	// ErrNotTLS means data does not start with a TLS handshake record
+	ErrNotTLS = errors.New("not a TLS handshake")
+
+	// ErrNoServerName means the ClientHello has no host name
+	ErrNoServerName = errors.New("no server name in ClientHello")
+
+	// ErrMalformed means the ClientHello cannot be parsed
+	ErrMalformed = errors.New("malformed ClientHello")
+)
+
+// ServerName returns the host name a client asks for in the ClientHello at
+// the start of data. The ClientHello may span several handshake records.
+// ErrIncomplete means data is a valid prefix and more of it is needed.
+func ServerName(data []byte) (string, error) {
+	hello, err := clientHello(data)
+	if err != nil {
+		return "", err
+	}
+	return parseClientHello(hello)
+}
+
+// clientHello reassembles the ClientHello message from handshake records
+func clientHello(data []byte) ([]byte, error) {
+	var msg []byte
+	for {
+		if len(data) == 0 {
+			return nil, ErrIncomplete
+		}
+		if data[0] != recordTypeHandshake {
+			if msg == nil {
+				return nil, ErrNotTLS
+			}
+			return nil, ErrMalformed
+		}
+		if len(data) < recordHeaderSize {
+			return nil, ErrIncomplete
+		}
+		if data[1] != 0x03 {
+			return nil, ErrNotTLS
+		}
+		size := int(binary.BigEndian.Uint16(data[3:]))
+		if size == 0 || size > maxRecordSize {
+			return nil, ErrMalformed
+		}
+
+		// A partial record may already hold the rest of the message
+		end := recordHeaderSize + size
+		if end > len(data) {
+			end = len(data)
+		}
+		msg = append(msg, data[recordHeaderSize:end]...)
+		data = data[end:]
+
+		if len(msg) > 0 && msg[0] != handshakeClientHello {
+			return nil, ErrMalformed
+		}
+		if len(msg) < handshakeHeaderSize {
+			continue
+		}
+		size = handshakeSize(msg)
+		if size > maxHelloSize {
+			return nil, ErrMalformed
+		}
+		if len(msg) >= size {
+			return msg[handshakeHeaderSize:size], nil
+		}
+	}
+}
+
+// handshakeSize returns the size of the handshake message at the start of msg,
+// including its header
+func handshakeSize(msg []byte) int {
+	return handshakeHeaderSize + (int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3]))
+}
+
+// parseClientHello finds the host name in the body of a ClientHello
+func parseClientHello(hello []byte) (string, error) {
+	r := reader(hello)
+
+	// Legacy version and random
+	if !r.skip(2 + 32) {
+		return "", ErrMalformed
+	}
+	// Session ID, cipher suites and compression methods
+	if _, ok := r.vector(1); !ok {
+		return "", ErrMalformed
+	}
+	if _, ok := r.vector(2); !ok {
+		return "", ErrMalformed
+	}
+	if _, ok := r.vector(1); !ok {
+		return "", ErrMalformed
+	}
+
+	if len(r) == 0 {
+		return "", ErrNoServerName // No extensions
+	}
+	extensions, ok := r.vector(2)
+	if !ok {
+		return "", ErrMalformed
+	}
+
+	for len(extensions) > 0 {
+		typ, ok := extensions.uint16()
+		if !ok {
+			return "", ErrMalformed
+		}
+		data, ok := extensions.vector(2)
+		if !ok {
+			return "", ErrMalformed
+		}
+		if typ == extensionServerName {
+			return parseServerNameList(data)
+		}
+	}
+	return "", ErrNoServerName
+}
+
+// parseServerNameList returns the host name in a server_name extension
+func parseServerNameList(data reader) (string, error) {
+	list, ok := data.vector(2)
+	if !ok || len(data) != 0 {
+		return "", ErrMalformed
+	}
+
+	for len(list) > 0 {
+		var nameType [1]byte
+		if !list.read(nameType[:]) {
+			return "", ErrMalformed
+		}
+		name, ok := list.vector(2)
+		if !ok {
+			return "", ErrMalformed
+		}
+		if nameType[0] != nameTypeHostName {
+			continue
+		}
+		if !validHostName(name) {
+			return "", ErrMalformed
+		}
+		return string(name), nil
+	}
+	return "", ErrNoServerName
+}
+
+// validHostName reports whether name looks like an ASCII host name, so
+// garbage never reaches rules or logs
+func validHostName(name []byte) bool {
+	if len(name) == 0 || len(name) > maxHostNameLen {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '-', c == '_':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// reader consumes a byte slice from the front
+type reader []byte
+
+// skip drops n bytes
+func (r *reader) skip(n int) bool {
+	if len(*r) < n {
+		return false
+	}
+	*r = (*r)[n:]
+	return true
+}
+
+// read fills buf
+func (r *reader) read(buf []byte) bool {
+	if len(*r) < len(buf) {
+		return false
+	}
+	copy(buf, *r)
+	*r = (*r)[len(buf):]
+	return true
+}
+
+// uint16 reads a big-endian 16-bit integer
+func (r *reader) uint16() (uint16, bool) {
+	var buf [2]byte
+	if !r.read(buf[:]) {
+		return 0, false
+	}
+	return binary.BigEndian.Uint16(buf[:]), true
+}
+
+// vector reads a vector with a length prefix of lenSize bytes
+func (r *reader) vector(lenSize int) (reader, bool) {
+	if len(*r) < lenSize {
+		return nil, false
+	}
+	n := 0
+	for _, b := range (*r)[:lenSize] {
+		n = n<<8 | int(b)
+	}
+	*r = (*r)[lenSize:]
+
+	if len(*r) < n {
+		return nil, false
+	}
+	v := (*r)[:n]
+	*r = (*r)[n:]
+	return v, true
+}
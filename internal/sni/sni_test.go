@@ -0,0 +1,125 @@
+package sni
+
+import (
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+// newClientHello returns the first flight of a TLS client asking for serverName
+func newClientHello(tb testing.TB, serverName string) []byte {
+	tb.Helper()
+
+	client, server := net.Pipe()
+	defer server.Close()
+	go func() {
+		tls.Client(client, &tls.Config{ServerName: serverName, InsecureSkipVerify: true}).Handshake()
+		client.Close()
+	}()
+
+	header := make([]byte, recordHeaderSize)
+	if _, err := io.ReadFull(server, header); err != nil {
+		tb.Fatal(err)
+	}
+	record := make([]byte, binary.BigEndian.Uint16(header[3:]))
+	if _, err := io.ReadFull(server, record); err != nil {
+		tb.Fatal(err)
+	}
+	return append(header, record...)
+}
+
+// fragment splits the handshake message of a single-record flight into
+// records of at most size bytes
+func fragment(record []byte, size int) []byte {
+	msg := record[recordHeaderSize:]
+	var out []byte
+	for len(msg) > 0 {
+		n := size
+		if n > len(msg) {
+			n = len(msg)
+		}
+		out = append(out, record[:3]...)
+		out = binary.BigEndian.AppendUint16(out, uint16(n))
+		out = append(out, msg[:n]...)
+		msg = msg[n:]
+	}
+	return out
+}
+
+func TestServerName(t *testing.T) {
+	hello := newClientHello(t, "www.example.com")
+
+	if name, err := ServerName(hello); err != nil || name != "www.example.com" {
+		t.Errorf("ServerName() = %q, %v, want www.example.com", name, err)
+	}
+
+	// Trailing application data is ignored
+	if name, err := ServerName(append(hello, 0x17, 0x03, 0x03)); err != nil || name != "www.example.com" {
+		t.Errorf("ServerName(hello + data) = %q, %v, want www.example.com", name, err)
+	}
+
+	// Handshake messages may be split across records
+	if name, err := ServerName(fragment(hello, 100)); err != nil || name != "www.example.com" {
+		t.Errorf("ServerName(fragmented) = %q, %v, want www.example.com", name, err)
+	}
+
+	// Every prefix asks for more data
+	for _, data := range [][]byte{hello, fragment(hello, 100)} {
+		for i := 0; i < len(data); i++ {
+			if _, err := ServerName(data[:i]); !errors.Is(err, ErrIncomplete) {
+				t.Fatalf("ServerName(first %d bytes) error = %v, want ErrIncomplete", i, err)
+			}
+		}
+	}
+}
+
+func TestServerNameErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"no SNI", newClientHello(t, ""), ErrNoServerName},
+		{"IP address", newClientHello(t, "192.0.2.1"), ErrNoServerName},
+		{"plain HTTP", []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"), ErrNotTLS},
+		{"SSH", []byte("SSH-2.0-OpenSSH_9.6\r\n"), ErrNotTLS},
+		{"not a ClientHello", []byte{0x16, 0x03, 0x01, 0x00, 0x04, 0x02, 0x00, 0x00, 0x00}, ErrMalformed},
+		{"empty record", []byte{0x16, 0x03, 0x01, 0x00, 0x00}, ErrMalformed},
+		{"truncated body", []byte{0x16, 0x03, 0x01, 0x00, 0x06, 0x01, 0x00, 0x00, 0x02, 0x03, 0x03}, ErrMalformed},
+	}
+
+	for _, tt := range tests {
+		if _, err := ServerName(tt.data); !errors.Is(err, tt.err) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func FuzzServerName(f *testing.F) {
+	hello := newClientHello(f, "www.example.com")
+	f.Add(hello)
+	f.Add(fragment(hello, 7))
+	f.Add(newClientHello(f, ""))
+	f.Add([]byte("GET / HTTP/1.1\r\n\r\n"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		name, err := ServerName(data)
+		if err != nil {
+			if name != "" {
+				t.Errorf("ServerName() = %q with error %v", name, err)
+			}
+			return
+		}
+		if !validHostName([]byte(name)) {
+			t.Errorf("ServerName() = %q, not a host name", name)
+		}
+
+		// Data after a complete ClientHello never changes the result
+		if more, err := ServerName(append(data[:len(data):len(data)], 0x16, 0x03)); err != nil || more != name {
+			t.Errorf("ServerName(data + more) = %q, %v, want %q", more, err, name)
+		}
+	})
+}
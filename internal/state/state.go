@@ -0,0 +1,125 @@
+package state
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the state file, stored next to the config file
+const FileName = "state.yaml"
+
+// FocusConfigFileName is the name of the copy of the config taken when a
+// focus session starts, stored next to the config file
+const FocusConfigFileName = "focus-config.yaml"
+
+// State holds runtime state that must survive service restarts
+type State struct {
+	Snoozes     []Snooze  `yaml:"snoozes,omitempty"`
+	PausedUntil time.Time `yaml:"paused_until,omitempty"`
+	Profile     string    `yaml:"profile,omitempty"` // Active profile; empty for the base rules only
+	Focus       *Focus    `yaml:"focus,omitempty"`
+}
+
+// Focus is a focus session that locks the rules until a deadline. While it
+// is active, changes that weaken blocking are refused.
+type Focus struct {
+	Until   time.Time `yaml:"until"`
+	Profile string    `yaml:"profile,omitempty"` // Profile enforced during the session
+}
+
+// Snooze temporarily exempts domains matching a pattern from blocking
+type Snooze struct {
+	Pattern string    `yaml:"pattern"`
+	Until   time.Time `yaml:"until"`
+}
+
+// Path returns the state file path for a config file
+func Path(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), FileName)
+}
+
+// FocusConfigPath returns the path of the focus session's config copy for a config file
+func FocusConfigPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), FocusConfigFileName)
+}
+
+// Load reads the state file. A missing file yields an empty state.
+func Load(path string) (*State, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &State{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var s State
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+	return &s, nil
+}
+
+// Save writes the state file
+func (s *State) Save(path string) error {
+	data, err := yaml.Marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
+
+// Prune removes expired snoozes, pauses and focus sessions
+func (s *State) Prune(now time.Time) {
+	active := make([]Snooze, 0, len(s.Snoozes))
+	for _, sn := range s.Snoozes {
+		if now.Before(sn.Until) {
+			active = append(active, sn)
+		}
+	}
+	s.Snoozes = active
+
+	if !now.Before(s.PausedUntil) {
+		s.PausedUntil = time.Time{}
+	}
+
+	if !s.Locked(now) {
+		s.Focus = nil
+	}
+}
+
+// Snooze exempts a pattern until the given time, replacing any existing
+// snooze for the same pattern
+func (s *State) Snooze(pattern string, until time.Time) {
+	for i, sn := range s.Snoozes {
+		if sn.Pattern == pattern {
+			s.Snoozes[i].Until = until
+			return
+		}
+	}
+	s.Snoozes = append(s.Snoozes, Snooze{Pattern: pattern, Until: until})
+}
+
+// Paused reports whether blocking is paused at the given time
+func (s *State) Paused(now time.Time) bool {
+	return now.Before(s.PausedUntil)
+}
+
+// Locked reports whether a focus session is active at the given time
+func (s *State) Locked(now time.Time) bool {
+	return s.Focus != nil && now.Before(s.Focus.Until)
+}
+
+// ActiveProfile returns the profile in effect at the given time: the focus
+// session's profile if it has one, otherwise the selected profile
+func (s *State) ActiveProfile(now time.Time) string {
+	if s.Locked(now) && s.Focus.Profile != "" {
+		return s.Focus.Profile
+	}
+	return s.Profile
+}
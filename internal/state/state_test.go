@@ -0,0 +1,69 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), FileName)
+	now := time.Now().Truncate(time.Second)
+
+	st, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() of missing file error = %v", err)
+	}
+
+	st.Snooze("reddit.com", now.Add(15*time.Minute))
+	st.Snooze("youtube.com", now.Add(-time.Minute))
+	st.Snooze("reddit.com", now.Add(30*time.Minute))
+	st.PausedUntil = now.Add(10 * time.Minute)
+	st.Prune(now)
+
+	if err := st.Save(path); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if len(loaded.Snoozes) != 1 || loaded.Snoozes[0].Pattern != "reddit.com" {
+		t.Fatalf("Snoozes = %+v, want only reddit.com", loaded.Snoozes)
+	}
+	if !loaded.Snoozes[0].Until.Equal(now.Add(30 * time.Minute)) {
+		t.Errorf("reddit.com snoozed until %v, want %v", loaded.Snoozes[0].Until, now.Add(30*time.Minute))
+	}
+	if !loaded.Paused(now) || loaded.Paused(now.Add(10*time.Minute)) {
+		t.Errorf("PausedUntil = %v, want %v", loaded.PausedUntil, now.Add(10*time.Minute))
+	}
+}
+
+func TestFocus(t *testing.T) {
+	now := time.Now()
+	st := &State{Profile: "work"}
+
+	if st.Locked(now) || st.ActiveProfile(now) != "work" {
+		t.Fatalf("state without focus: Locked = %v, ActiveProfile = %q", st.Locked(now), st.ActiveProfile(now))
+	}
+
+	st.Focus = &Focus{Until: now.Add(time.Hour), Profile: "deep-work"}
+	if !st.Locked(now) {
+		t.Errorf("Locked() = false during the session")
+	}
+	if got := st.ActiveProfile(now); got != "deep-work" {
+		t.Errorf("ActiveProfile() = %q during the session, want deep-work", got)
+	}
+
+	later := now.Add(2 * time.Hour)
+	if st.Locked(later) || st.ActiveProfile(later) != "work" {
+		t.Errorf("after the session: Locked = %v, ActiveProfile = %q", st.Locked(later), st.ActiveProfile(later))
+	}
+
+	st.Prune(later)
+	if st.Focus != nil {
+		t.Errorf("Prune() kept an expired focus session")
+	}
+}